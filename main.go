@@ -1,19 +1,40 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"embed"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -29,584 +50,8110 @@ type NetworkInterface struct {
 	Name    string   `json:"name"`
 	IPAddrs []string `json:"ip_addresses"`
 	Status  string   `json:"status"`
+	Type    string   `json:"type"`
+	MAC     string   `json:"mac,omitempty"`
+	Vendor  string   `json:"vendor"`
+	Managed *bool    `json:"managed,omitempty"`
+}
+
+type Neighbor struct {
+	IP        string `json:"ip"`
+	MAC       string `json:"mac"`
+	Vendor    string `json:"vendor"`
+	Interface string `json:"interface"`
+}
+
+type WireGuardPeer struct {
+	PublicKey           string   `json:"public_key"`
+	Endpoint            string   `json:"endpoint"`
+	AllowedIPs          []string `json:"allowed_ips"`
+	LatestHandshake     string   `json:"latest_handshake,omitempty"`
+	RxBytes             uint64   `json:"rx_bytes"`
+	TxBytes             uint64   `json:"tx_bytes"`
+	PersistentKeepalive int      `json:"persistent_keepalive"`
+}
+
+// WireGuardInterface deliberately leaves out the private key that `wg show dump` prints
+type WireGuardInterface struct {
+	Name       string          `json:"name"`
+	PublicKey  string          `json:"public_key"`
+	ListenPort int             `json:"listen_port"`
+	Peers      []WireGuardPeer `json:"peers"`
+}
+
+type InterfaceErrorCounters struct {
+	RxErrors   uint64 `json:"rx_errors"`
+	TxErrors   uint64 `json:"tx_errors"`
+	RxDropped  uint64 `json:"rx_dropped"`
+	TxDropped  uint64 `json:"tx_dropped"`
+	Collisions uint64 `json:"collisions"`
+}
+
+type InterfaceErrors struct {
+	Name            string                  `json:"name"`
+	Counters        InterfaceErrorCounters  `json:"counters"`
+	Deltas          *InterfaceErrorCounters `json:"deltas"`
+	IntervalSeconds float64                 `json:"interval_seconds,omitempty"`
+}
+
+type InterfaceBandwidth struct {
+	Name             string  `json:"name"`
+	RxBytesPerSecond float64 `json:"rx_bytes_per_second"`
+	TxBytesPerSecond float64 `json:"tx_bytes_per_second"`
+	Time             string  `json:"time"`
+}
+
+type WiFiErrorEntry struct {
+	Time    string `json:"time"`
+	Event   string `json:"event"`
+	SSID    string `json:"ssid,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type InterfaceTransition struct {
+	Interface string `json:"interface"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Time      string `json:"time"`
+}
+
+type InterfaceEvent struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Carrier bool   `json:"carrier"`
+	Time    string `json:"time"`
+}
+
+type interfaceState struct {
+	status  string
+	carrier bool
+}
+
+type interfaceErrorSample struct {
+	counters InterfaceErrorCounters
+	at       time.Time
 }
 
 type WiFiNetwork struct {
-	SSID     string `json:"ssid"`
-	Signal   string `json:"signal"`
-	Security string `json:"security"`
+	SSID        string `json:"ssid"`
+	Signal      string `json:"signal"`
+	Security    string `json:"security"`
+	Band        string `json:"band,omitempty"`
+	SignalDBM   int    `json:"signal_dbm"`
+	SignalLevel int    `json:"signal_level"`
+}
+
+type WiFiScanMeta struct {
+	DurationMs int64          `json:"duration_ms"`
+	APCount    int            `json:"ap_count"`
+	Bands      map[string]int `json:"bands"`
+	Security   map[string]int `json:"security"`
 }
 
 type CurrentWiFi struct {
-	SSID      string `json:"ssid"`
-	Signal    string `json:"signal"`
-	Security  string `json:"security"`
+	SSID        string `json:"ssid"`
+	Signal      string `json:"signal"`
+	SignalLevel int    `json:"signal_level"`
+	Security    string `json:"security"`
+	Connected   bool   `json:"connected"`
+	IPv4        string `json:"ipv4"`
+	IPv6        string `json:"ipv6"`
+}
+
+type WiFiLink struct {
 	Connected bool   `json:"connected"`
+	SSID      string `json:"ssid"`
+	BSSID     string `json:"bssid"`
+	Freq      int    `json:"freq"`
+	Channel   int    `json:"channel"`
+	RxRate    string `json:"rx_rate"`
+	TxRate    string `json:"tx_rate"`
+	SignalDBM int    `json:"signal_dbm"`
 }
 
 type Process struct {
-	PID     int    `json:"pid"`
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	CPU     string `json:"cpu"`
-	Memory  string `json:"memory"`
-	User    string `json:"user"`
-	Command string `json:"command"`
+	PID        int    `json:"pid"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	StatusText string `json:"status_text"`
+	CPU        string `json:"cpu"`
+	Memory     string `json:"memory"`
+	User       string `json:"user"`
+	Command    string `json:"command"`
+}
+
+// staleProcessList is the process list body when the last good snapshot is served after ps timed out
+type staleProcessList struct {
+	Stale     bool      `json:"stale"`
+	StaleAge  int       `json:"stale_age"`
+	Processes []Process `json:"processes"`
+}
+
+type AuthFailure struct {
+	Timestamp string `json:"timestamp"`
+	User      string `json:"user"`
+	SourceIP  string `json:"source_ip"`
+}
+
+type UserUsage struct {
+	User      string  `json:"user"`
+	Processes int     `json:"processes"`
+	CPU       float64 `json:"cpu"`
+	Memory    float64 `json:"memory"`
+}
+
+type ProcessChange struct {
+	PID          int     `json:"pid"`
+	Name         string  `json:"name"`
+	CPUBefore    float64 `json:"cpu_before"`
+	CPUAfter     float64 `json:"cpu_after"`
+	MemoryBefore float64 `json:"memory_before"`
+	MemoryAfter  float64 `json:"memory_after"`
+}
+
+type ProcessDiff struct {
+	BaselineAt string          `json:"baseline_at"`
+	Started    []Process       `json:"started"`
+	Exited     []Process       `json:"exited"`
+	Changed    []ProcessChange `json:"changed"`
+}
+
+type ProcessDetail struct {
+	PID         int    `json:"pid"`
+	Name        string `json:"name"`
+	Command     string `json:"command"`
+	Cgroup      string `json:"cgroup"`
+	ContainerID string `json:"container_id"`
+}
+
+type ProcessSocket struct {
+	Protocol      string `json:"protocol"`
+	LocalAddress  string `json:"local_address"`
+	RemoteAddress string `json:"remote_address"`
+	State         string `json:"state"`
+	Inode         string `json:"inode"`
+}
+
+type KillByNameRequest struct {
+	Name   string `json:"name"`
+	Signal string `json:"signal"`
+	Force  bool   `json:"force"`
+}
+
+type KillResult struct {
+	PID    int    `json:"pid"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
 type ConnectionRequest struct {
 	SSID     string `json:"ssid"`
 	Password string `json:"password"`
 	Security string `json:"security"`
+	BSSID    string `json:"bssid,omitempty"`
+	CloneMAC string `json:"clone_mac,omitempty"`
 }
 
-type SystemHealth struct {
-	Status       string `json:"status"`
-	Uptime       string `json:"uptime"`
-	NetworkCheck bool   `json:"network_check"`
-	LastCheck    string `json:"last_check"`
+type StaticIPv4Config struct {
+	Address string   `json:"address"`
+	Gateway string   `json:"gateway"`
+	DNS     []string `json:"dns"`
 }
 
-type TemplateData struct {
-	Title       string
-	ActiveNav   string
-	Version     string
-	PageContent string
+// MACPolicy is the global MAC address behavior NetworkManager applies to scans and new connections
+type MACPolicy struct {
+	Policy           string `json:"policy"`
+	ScanRandomMAC    bool   `json:"scan_rand_mac_address"`
+	ClonedMACAddress string `json:"cloned_mac_address"`
+	Configured       bool   `json:"configured"`
 }
 
-type App struct {
-	templates      *template.Template
-	nmcliAvailable bool
-	version        string
-	startTime      time.Time
+type ProvisionRequest struct {
+	SSID     string            `json:"ssid"`
+	Password string            `json:"password"`
+	Security string            `json:"security"`
+	IPv4     *StaticIPv4Config `json:"ipv4,omitempty"`
 }
 
-var nmcliAvailable bool
+type SavedConnection struct {
+	Name          string `json:"name"`
+	UUID          string `json:"uuid"`
+	Timestamp     int64  `json:"timestamp"`
+	InterfaceName string `json:"interface_name,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+}
 
-func checkNmcliAvailable() bool {
-	cmd := exec.Command("which", "nmcli")
-	err := cmd.Run()
-	return err == nil
+type SystemHealth struct {
+	Status        string           `json:"status"`
+	Uptime        string           `json:"uptime"`
+	NetworkCheck  bool             `json:"network_check"`
+	LastCheck     string           `json:"last_check"`
+	Maintenance   MaintenanceState `json:"maintenance"`
+	PendingReboot *PendingReboot   `json:"pending_reboot"`
+	OnBattery     bool             `json:"on_battery"`
+	Throttled     bool             `json:"throttled"`
+	Warnings      []string         `json:"warnings,omitempty"`
 }
 
-func readVersion() string {
-	data, err := staticFS.ReadFile("build/static/version.txt")
-	if err != nil {
-		return "unknown"
-	}
+// HealthCheck is one subsystem's result in the full health report
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
 
-	return strings.TrimSpace(string(data))
+type FullHealth struct {
+	Status    string        `json:"status"`
+	CheckedAt string        `json:"checked_at"`
+	Checks    []HealthCheck `json:"checks"`
 }
 
-func NewApp() *App {
-	templates := template.Must(template.ParseFS(templateFS, "src/templates/*.html"))
-	nmcliAvailable = checkNmcliAvailable()
-	version := readVersion()
-	return &App{
-		templates:      templates,
-		nmcliAvailable: nmcliAvailable,
-		version:        version,
-		startTime:      time.Now(),
-	}
+// Stats are lifetime operational counters, persisted across restarts when CM_STATS_FILE is set
+type Stats struct {
+	Starts              uint64 `json:"starts"`
+	WiFiConnects        uint64 `json:"wifi_connects"`
+	WiFiConnectFailures uint64 `json:"wifi_connect_failures"`
+	RebootsRequested    uint64 `json:"reboots_requested"`
+	UptimeSeconds       uint64 `json:"uptime_seconds"`
 }
 
-func (app *App) homeHandler(w http.ResponseWriter, r *http.Request) {
-	data := TemplateData{
-		Title:       "ControlMate Utils",
-		ActiveNav:   "network",
-		Version:     app.version,
-		PageContent: "network",
-	}
-	app.templates.ExecuteTemplate(w, "index.html", data)
+type BatteryStatus struct {
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+	Status   string `json:"status"`
 }
 
-func (app *App) getNmcliStatusHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"available": app.nmcliAvailable})
+type PowerStatus struct {
+	HasBattery bool            `json:"has_battery"`
+	ACOnline   *bool           `json:"ac_online"`
+	OnBattery  bool            `json:"on_battery"`
+	Batteries  []BatteryStatus `json:"batteries"`
 }
 
-func (app *App) getInterfacesHandler(w http.ResponseWriter, r *http.Request) {
-	interfaces, err := getNetworkInterfaces()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+type PendingReboot struct {
+	ScheduledAt string `json:"scheduled_at"`
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(interfaces)
+type MaintenanceState struct {
+	Enabled   bool   `json:"enabled"`
+	Message   string `json:"message"`
+	UpdatedAt string `json:"updated_at,omitempty"`
 }
 
-func (app *App) getWiFiNetworksHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+type SystemInfo struct {
+	Version     string `json:"version"`
+	DeviceLabel string `json:"device_label"`
+	Hostname    string `json:"hostname"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	InitSystem  string `json:"init_system"`
+	BootTime    string `json:"boot_time"`
+}
 
-	if !app.nmcliAvailable {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{"error": "nmcli is not installed or not available"})
-		return
-	}
+// MemoryInfo reports /proc/meminfo figures in bytes
+type MemoryInfo struct {
+	Total       uint64 `json:"total"`
+	Free        uint64 `json:"free"`
+	Available   uint64 `json:"available"`
+	Used        uint64 `json:"used"`
+	Buffers     uint64 `json:"buffers"`
+	Cached      uint64 `json:"cached"`
+	Slab        uint64 `json:"slab"`
+	Reclaimable uint64 `json:"reclaimable"`
+	Shmem       uint64 `json:"shmem"`
+}
 
-	networks, err := scanWiFiNetworks()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
-	}
+type EntropyStatus struct {
+	Available int  `json:"available"`
+	Threshold int  `json:"threshold"`
+	Low       bool `json:"low"`
+}
 
-	json.NewEncoder(w).Encode(networks)
+type KernelInfo struct {
+	System   string `json:"system"`
+	Release  string `json:"release"`
+	Version  string `json:"version"`
+	Machine  string `json:"machine"`
+	Hostname string `json:"hostname"`
 }
 
-func (app *App) connectWiFiHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+type PackageInfo struct {
+	Name      string `json:"name"`
+	Installed bool   `json:"installed"`
+	Version   string `json:"version"`
+}
 
-	if !app.nmcliAvailable {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{"error": "nmcli is not installed or not available"})
-		return
-	}
+type RebootRequired struct {
+	Required bool     `json:"required"`
+	Packages []string `json:"packages"`
+}
 
-	var req ConnectionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
-		return
-	}
+type CPUGovernor struct {
+	Governors map[string]string `json:"governors"`
+	Available []string          `json:"available"`
+}
 
-	err := connectToWiFi(req.SSID, req.Password, req.Security)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
-	}
+type DiskSmart struct {
+	Device             string `json:"device"`
+	Health             string `json:"health"`
+	ReallocatedSectors *int64 `json:"reallocated_sectors,omitempty"`
+	TemperatureC       *int   `json:"temperature_c,omitempty"`
+	PowerOnHours       *int64 `json:"power_on_hours,omitempty"`
+}
 
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+// smartctlOutput is the subset of `smartctl -j` output we report on
+type smartctlOutput struct {
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime *struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
 }
 
-func (app *App) getCurrentWiFiHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+type FirewallChain struct {
+	Table string `json:"table"`
+	Name  string `json:"name"`
+	Rules int    `json:"rules"`
+}
 
-	if !app.nmcliAvailable {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{"error": "nmcli is not installed or not available"})
-		return
-	}
+type FirewallRules struct {
+	Source string          `json:"source"`
+	Raw    string          `json:"raw"`
+	Chains []FirewallChain `json:"chains"`
+}
 
-	currentWiFi, err := getCurrentWiFi()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
-	}
+type ResolvedLink struct {
+	Interface     string   `json:"interface"`
+	CurrentServer string   `json:"current_server,omitempty"`
+	DNSServers    []string `json:"dns_servers"`
+	Domains       []string `json:"domains,omitempty"`
+	DNSSEC        string   `json:"dnssec,omitempty"`
+}
 
-	json.NewEncoder(w).Encode(currentWiFi)
+type ResolvedStatus struct {
+	Source    string         `json:"source"`
+	GlobalDNS []string       `json:"global_dns"`
+	DNSSEC    string         `json:"dnssec,omitempty"`
+	Links     []ResolvedLink `json:"links"`
 }
 
-func (app *App) getVersionHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"version": app.version})
+type Capabilities struct {
+	EUID               int  `json:"euid"`
+	CanReboot          bool `json:"can_reboot"`
+	CanKillAny         bool `json:"can_kill_any"`
+	CanModifyNetwork   bool `json:"can_modify_network"`
+	DestructiveEnabled bool `json:"destructive_actions_enabled"`
 }
 
-func (app *App) getSystemHealthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+type PublicIP struct {
+	IP        string `json:"ip"`
+	Family    string `json:"family"`
+	Source    string `json:"source"`
+	CheckedAt string `json:"checked_at"`
+	checked   time.Time
+}
 
-	// Check network connectivity
-	networkCheck := checkNetworkConnectivity()
+type IperfRequest struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Duration int    `json:"duration"`
+	UDP      bool   `json:"udp"`
+}
 
-	// Calculate uptime
-	uptime := time.Since(app.startTime)
-	uptimeStr := formatUptime(uptime)
+type PortCheckRequest struct {
+	Host      string `json:"host"`
+	Port      int    `json:"port"`
+	TimeoutMs int    `json:"timeout_ms"`
+}
 
-	// Determine overall status
-	status := "online"
-	if !networkCheck {
-		status = "degraded"
-	}
+type PortCheckResult struct {
+	Host      string  `json:"host"`
+	Port      int     `json:"port"`
+	Open      bool    `json:"open"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
 
-	health := SystemHealth{
-		Status:       status,
-		Uptime:       uptimeStr,
-		NetworkCheck: networkCheck,
-		LastCheck:    time.Now().Format(time.RFC3339),
-	}
+type DNSBenchmarkRequest struct {
+	Servers []string `json:"servers"`
+	Name    string   `json:"name"`
+}
 
-	json.NewEncoder(w).Encode(health)
+type DNSBenchmarkResult struct {
+	Server    string   `json:"server"`
+	Success   bool     `json:"success"`
+	LatencyMs float64  `json:"latency_ms"`
+	Addresses []string `json:"addresses,omitempty"`
+	Error     string   `json:"error,omitempty"`
 }
 
-func (app *App) processesHandler(w http.ResponseWriter, r *http.Request) {
-	data := TemplateData{
-		Title:       "Processes - ControlMate Utils",
-		ActiveNav:   "processes",
-		Version:     app.version,
-		PageContent: "processes",
-	}
-	app.templates.ExecuteTemplate(w, "processes.html", data)
+type IperfResult struct {
+	UploadMbps   float64  `json:"upload_mbps"`
+	DownloadMbps float64  `json:"download_mbps"`
+	Retransmits  int      `json:"retransmits"`
+	JitterMs     *float64 `json:"jitter_ms,omitempty"`
 }
 
-func (app *App) systemHandler(w http.ResponseWriter, r *http.Request) {
-	data := TemplateData{
-		Title:       "System - ControlMate Utils",
-		ActiveNav:   "system",
-		Version:     app.version,
-		PageContent: "system",
-	}
-	app.templates.ExecuteTemplate(w, "system.html", data)
+// iperfOutput is the subset of `iperf3 -J` output we report on
+type iperfOutput struct {
+	Error string `json:"error"`
+	End   struct {
+		SumSent *struct {
+			BitsPerSecond float64 `json:"bits_per_second"`
+			Retransmits   int     `json:"retransmits"`
+		} `json:"sum_sent"`
+		SumReceived *struct {
+			BitsPerSecond float64 `json:"bits_per_second"`
+		} `json:"sum_received"`
+		// UDP tests report a single sum including jitter
+		Sum *struct {
+			BitsPerSecond float64 `json:"bits_per_second"`
+			JitterMs      float64 `json:"jitter_ms"`
+		} `json:"sum"`
+	} `json:"end"`
 }
 
-func (app *App) getProcessesHandler(w http.ResponseWriter, r *http.Request) {
-	processes, err := getProcesses()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+type TemplateData struct {
+	Title       string
+	ActiveNav   string
+	Version     string
+	PageContent string
+	DeviceLabel string
+	BasePath    string
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(processes)
+type LoginPageData struct {
+	Title    string
+	Error    string
+	BasePath string
 }
 
-func (app *App) rebootHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+type ErrorPageData struct {
+	Title      string
+	Status     int
+	StatusText string
+	Message    string
+	BasePath   string
+}
 
-	// Check if running on Windows or macOS (development machines)
-	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
-		log.Printf("Reboot requested on %s (development machine) - logging action instead of rebooting", runtime.GOOS)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":  "logged",
-			"message": fmt.Sprintf("Reboot action logged for %s development machine", runtime.GOOS),
-		})
-		return
+type App struct {
+	templates        *template.Template
+	startTime        time.Time
+	stateDir         string
+	serviceName      string
+	deviceLabel      string
+	initSystem       string
+	allowDestructive bool
+	basePath         string
+	statsFile        string
+
+	// mu guards the fields below, which may be updated by background checkers
+	mu              sync.RWMutex
+	nmcliAvailable  bool
+	version         string
+	maintenance     MaintenanceState
+	pendingReboot   *PendingReboot
+	rebootTimer     *time.Timer
+	errorSamples    map[string]interfaceErrorSample
+	lastProcesses   []Process
+	lastProcessAt   time.Time
+	ifaceWatchers   map[chan InterfaceEvent]struct{}
+	wifiErrors      []WiFiErrorEntry
+	publicIP        *PublicIP
+	authToken       string
+	ifaceHistory    []InterfaceTransition
+	throttleCount   uint64
+	throttleSeen    bool
+	baseline        []Process
+	baselineAt      time.Time
+	scanCache       []WiFiNetwork
+	scanCacheAt     time.Time
+	scanCacheDevice string
+	connecting      int
+	stats           Stats
+}
+
+// defaultStateDir holds small JSON files that must survive restarts
+const defaultStateDir = "/var/lib/cm-utils"
+
+const maxMaintenanceMessageLength = 256
+
+const defaultServiceName = "cm-utils"
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
+	return fallback
+}
 
-	// For Linux systems, attempt to reboot
-	log.Printf("Reboot requested on %s system", runtime.GOOS)
+// normalizeBasePath turns CM_BASE_PATH into "" or a "/prefix" without a trailing slash
+func normalizeBasePath(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), "/")
+	if value == "" {
+		return ""
+	}
+	return "/" + value
+}
 
-	// Use systemctl if available (systemd systems)
-	cmd := exec.Command("systemctl", "reboot", "-i")
-	if err := cmd.Run(); err != nil {
-		// Fallback to reboot command
-		cmd = exec.Command("reboot")
-		if err := cmd.Run(); err != nil {
-			// Last resort: shutdown -r now
-			cmd = exec.Command("shutdown", "-r", "now")
-			if err := cmd.Run(); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]string{
-					"error": "Failed to initiate reboot: " + err.Error(),
-				})
-				return
-			}
-		}
+// destructiveActionsAllowed lets deployments opt out of endpoints that restart or alter the device
+func destructiveActionsAllowed() bool {
+	switch strings.ToLower(os.Getenv("CM_ALLOW_DESTRUCTIVE_ACTIONS")) {
+	case "0", "false", "no":
+		return false
 	}
+	return true
+}
 
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "success",
-		"message": "System reboot initiated",
-	})
+// developmentMachine is true on Windows and macOS, where reboots and restarts are logged
+// instead of performed
+var developmentMachine = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// execAllowlist is the set of binaries the application is permitted to run.
+// All process execution goes through safeExec so this is the single place to audit.
+var execAllowlist = map[string]bool{
+	"which":            true,
+	"nmcli":            true,
+	"iw":               true,
+	"journalctl":       true,
+	"dhclient":         true,
+	"needs-restarting": true,
+	"smartctl":         true,
+	"nft":              true,
+	"iptables-save":    true,
+	"iperf3":           true,
+	"df":               true,
+	"wg":               true,
+	"wg-quick":         true,
+	"wpa_cli":          true,
+	"resolvectl":       true,
+	"dpkg-query":       true,
+	"uname":            true,
+	"rpm":              true,
+	"systemd-resolve":  true,
+	"ps":               true,
+	"ip":               true,
+	"systemctl":        true,
+	"rc-service":       true,
+	"service":          true,
+	"reboot":           true,
+	"shutdown":         true,
 }
 
-func getNetworkInterfaces() ([]NetworkInterface, error) {
-	interfaces, err := net.Interfaces()
-	if err != nil {
-		return nil, err
+// safeExec builds a command for an allowlisted binary, refusing anything else
+func safeExec(name string, args ...string) (*exec.Cmd, error) {
+	return safeExecContext(context.Background(), name, args...)
+}
+
+// safeExecContext is like safeExec but the command is killed when ctx is done
+func safeExecContext(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	if !execAllowlist[name] {
+		log.Printf("Refusing to execute non-allowlisted command: %s", name)
+		return nil, fmt.Errorf("command not allowed: %s", name)
 	}
+	return exec.CommandContext(ctx, name, args...), nil
+}
 
-	var result []NetworkInterface
-	for _, iface := range interfaces {
-		// Skip loopback interfaces
-		if iface.Flags&net.FlagLoopback != 0 {
-			continue
-		}
+const (
+	defaultMaxConcurrentCommands = 4
+	commandQueueTimeout          = 30 * time.Second
+)
 
-		addrs, err := iface.Addrs()
-		if err != nil {
-			continue
-		}
+var errCommandBusy = errors.New("too many concurrent system commands, try again later")
 
-		var ipAddrs []string
-		for _, addr := range addrs {
-			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
-				// Only include IPv4 addresses
-				if ipNet.IP.To4() != nil {
-					ipAddrs = append(ipAddrs, ipNet.IP.String())
-				}
-			}
-		}
+// commandSlots limits how many expensive commands run at once on small devices
+var commandSlots = make(chan struct{}, maxConcurrentCommands())
 
-		// Ensure ipAddrs is never nil - initialize as empty slice if needed
-		if ipAddrs == nil {
-			ipAddrs = []string{}
+func maxConcurrentCommands() int {
+	if value := os.Getenv("CM_MAX_CONCURRENT_COMMANDS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
 		}
+		log.Printf("Ignoring invalid CM_MAX_CONCURRENT_COMMANDS=%q", value)
+	}
+	return defaultMaxConcurrentCommands
+}
 
-		status := "down"
-		if iface.Flags&net.FlagUp != 0 {
-			status = "up"
-		}
+// acquireCommandSlot waits for a free slot for as long as ctx allows. Callers without a
+// cancellable context (background work) fall back to commandQueueTimeout so they can't queue forever.
+func acquireCommandSlot(ctx context.Context) error {
+	if ctx.Done() == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, commandQueueTimeout)
+		defer cancel()
+	}
 
-		result = append(result, NetworkInterface{
-			Name:    iface.Name,
-			IPAddrs: ipAddrs,
-			Status:  status,
-		})
+	select {
+	case commandSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errCommandBusy
 	}
+}
 
-	return result, nil
+func releaseCommandSlot() {
+	<-commandSlots
 }
 
-func scanWiFiNetworks() ([]WiFiNetwork, error) {
-	// First, trigger a rescan to refresh the WiFi network list
-	rescanCmd := exec.Command("nmcli", "device", "wifi", "rescan")
-	if err := rescanCmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to rescan WiFi networks: %v", err)
+// commandErrorStatus maps a failed command to 503 when it never ran for lack of a slot
+func commandErrorStatus(err error) int {
+	if errors.Is(err, errCommandBusy) {
+		return http.StatusServiceUnavailable
 	}
+	return http.StatusInternalServerError
+}
 
-	// Wait 5 seconds for the rescan to complete
-	time.Sleep(5 * time.Second)
+// runCommand runs an allowlisted command and returns its combined output
+func runCommand(name string, args ...string) ([]byte, error) {
+	return runCommandContext(context.Background(), name, args...)
+}
 
-	// Now get the updated list of WiFi networks
-	cmd := exec.Command("nmcli", "-t", "-f", "SSID,SIGNAL,SECURITY", "dev", "wifi", "list")
-	output, err := cmd.Output()
+// runCommandContext is like runCommand but gives up waiting for a free slot when ctx is done
+func runCommandContext(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd, err := safeExecContext(ctx, name, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan WiFi networks with nmcli: %v", err)
+		return nil, err
 	}
 
-	return parseNmcliOutput(string(output)), nil
-}
+	if err := acquireCommandSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer releaseCommandSlot()
 
-func parseNmcliOutput(output string) []WiFiNetwork {
-	var networks []WiFiNetwork
-	lines := strings.Split(output, "\n")
+	return cmd.CombinedOutput()
+}
 
-	for _, line := range lines {
+// runCommandOutput is like runCommandContext but returns only stdout, for output that gets parsed
+func runCommandOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd, err := safeExecContext(ctx, name, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := acquireCommandSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer releaseCommandSlot()
+
+	return cmd.Output()
+}
+
+var macPattern = regexp.MustCompile(`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`)
+
+// validCloneMAC accepts a MAC address or one of NetworkManager's cloned-mac-address keywords
+func validCloneMAC(value string) bool {
+	switch value {
+	case "random", "stable", "permanent":
+		return true
+	}
+	return macPattern.MatchString(value)
+}
+
+func commandAvailable(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+func checkNmcliAvailable() bool {
+	cmd, err := safeExec("which", "nmcli")
+	if err != nil {
+		return false
+	}
+	return cmd.Run() == nil
+}
+
+func readVersion() string {
+	data, err := staticFS.ReadFile("build/static/version.txt")
+	if err != nil {
+		return "unknown"
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+func NewApp() *App {
+	templates := template.Must(template.ParseFS(templateFS, "src/templates/*.html"))
+	nmcliAvailable := checkNmcliAvailable()
+	version := readVersion()
+	app := &App{
+		templates:        templates,
+		nmcliAvailable:   nmcliAvailable,
+		version:          version,
+		startTime:        time.Now(),
+		stateDir:         defaultStateDir,
+		serviceName:      envOrDefault("CM_SERVICE_NAME", defaultServiceName),
+		deviceLabel:      strings.TrimSpace(os.Getenv("CM_DEVICE_LABEL")),
+		initSystem:       detectInitSystem("/"),
+		allowDestructive: destructiveActionsAllowed(),
+		basePath:         normalizeBasePath(os.Getenv("CM_BASE_PATH")),
+		statsFile:        strings.TrimSpace(os.Getenv("CM_STATS_FILE")),
+	}
+
+	if maintenance, err := loadMaintenanceState(app.maintenanceFile()); err == nil {
+		app.maintenance = maintenance
+	} else if !os.IsNotExist(err) {
+		log.Printf("Failed to load maintenance state: %v", err)
+	}
+	app.restoreRebootSchedule()
+	app.authToken = app.loadAuthToken()
+	app.stats = loadStats(app.statsFile)
+	app.stats.Starts++
+
+	return app
+}
+
+func (app *App) maintenanceFile() string {
+	return filepath.Join(app.stateDir, "maintenance.json")
+}
+
+func (app *App) Maintenance() MaintenanceState {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.maintenance
+}
+
+func (app *App) setMaintenance(state MaintenanceState) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if err := saveMaintenanceState(app.maintenanceFile(), state); err != nil {
+		return err
+	}
+	app.maintenance = state
+	return nil
+}
+
+func loadMaintenanceState(path string) (MaintenanceState, error) {
+	var state MaintenanceState
+	err := loadJSONState(path, &state)
+	return state, err
+}
+
+func saveMaintenanceState(path string, state MaintenanceState) error {
+	return saveJSONState(path, state)
+}
+
+func loadJSONState(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// loadStats reads persisted counters, starting fresh when persistence is off or the file
+// is missing or corrupt
+func loadStats(path string) Stats {
+	var stats Stats
+	if path == "" {
+		return stats
+	}
+	if err := loadJSONState(path, &stats); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to load stats, starting fresh: %v", err)
+		}
+		return Stats{}
+	}
+	return stats
+}
+
+// Stats returns the counters with this run's uptime added to the persisted total
+func (app *App) Stats() Stats {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	stats := app.stats
+	stats.UptimeSeconds += uint64(time.Since(app.startTime).Seconds())
+	return stats
+}
+
+func (app *App) countConnect(success bool) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if success {
+		app.stats.WiFiConnects++
+	} else {
+		app.stats.WiFiConnectFailures++
+	}
+}
+
+func (app *App) saveStats() {
+	if app.statsFile == "" {
+		return
+	}
+	if err := saveJSONState(app.statsFile, app.Stats()); err != nil {
+		log.Printf("Failed to save stats: %v", err)
+	}
+}
+
+const statsSaveInterval = time.Minute
+
+// persistStats saves the counters periodically so a crash loses at most one interval
+func (app *App) persistStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.saveStats()
+		}
+	}
+}
+
+func (app *App) getStatsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"stats":      app.Stats(),
+		"persistent": app.statsFile != "",
+		"started_at": app.startTime.Format(time.RFC3339),
+	})
+}
+
+func saveJSONState(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func (app *App) rebootScheduleFile() string {
+	return filepath.Join(app.stateDir, "reboot-schedule.json")
+}
+
+func (app *App) PendingReboot() *PendingReboot {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	if app.pendingReboot == nil {
+		return nil
+	}
+	pending := *app.pendingReboot
+	return &pending
+}
+
+// scheduleReboot arms a timer for the reboot and persists it so a service restart doesn't lose it
+func (app *App) scheduleReboot(at time.Time) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	pending := &PendingReboot{ScheduledAt: at.Format(time.RFC3339)}
+	if err := saveJSONState(app.rebootScheduleFile(), pending); err != nil {
+		return err
+	}
+
+	if app.rebootTimer != nil {
+		app.rebootTimer.Stop()
+	}
+	app.pendingReboot = pending
+	app.rebootTimer = time.AfterFunc(time.Until(at), app.fireScheduledReboot)
+	return nil
+}
+
+// cancelReboot clears any pending reboot, returning false if none was scheduled
+func (app *App) cancelReboot() bool {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	return app.clearPendingRebootLocked()
+}
+
+func (app *App) clearPendingRebootLocked() bool {
+	if app.rebootTimer != nil {
+		app.rebootTimer.Stop()
+		app.rebootTimer = nil
+	}
+	if app.pendingReboot == nil {
+		return false
+	}
+	app.pendingReboot = nil
+	if err := os.Remove(app.rebootScheduleFile()); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove reboot schedule: %v", err)
+	}
+	return true
+}
+
+func (app *App) fireScheduledReboot() {
+	app.mu.Lock()
+	app.clearPendingRebootLocked()
+	app.mu.Unlock()
+
+	if developmentMachine {
+		log.Printf("Scheduled reboot fired on %s (development machine) - logging action instead of rebooting", runtime.GOOS)
+		return
+	}
+
+	log.Printf("Scheduled reboot fired on %s system", runtime.GOOS)
+	if err := app.performReboot(); err != nil {
+		log.Printf("Failed to initiate scheduled reboot: %v", err)
+	}
+}
+
+// restoreRebootSchedule re-arms a persisted schedule, dropping it if its time has already passed
+func (app *App) restoreRebootSchedule() {
+	var pending PendingReboot
+	if err := loadJSONState(app.rebootScheduleFile(), &pending); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to load reboot schedule: %v", err)
+		}
+		return
+	}
+
+	at, err := time.Parse(time.RFC3339, pending.ScheduledAt)
+	if err != nil || !at.After(time.Now()) {
+		os.Remove(app.rebootScheduleFile())
+		return
+	}
+
+	if err := app.scheduleReboot(at); err != nil {
+		log.Printf("Failed to restore reboot schedule: %v", err)
+	}
+}
+
+func (app *App) NmcliAvailable() bool {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.nmcliAvailable
+}
+
+func (app *App) setNmcliAvailable(available bool) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.nmcliAvailable = available
+}
+
+func (app *App) Version() string {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.version
+}
+
+// wantsHTML reports whether the client prefers an HTML page over JSON, as browsers do
+func wantsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/html") && !strings.Contains(accept, "application/json")
+}
+
+// writeJSON marshals v before touching the response, so an encoding failure can still become a 500
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode JSON response: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"failed to encode response"}` + "\n"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		// The status line is already gone, so the client just sees a truncated body
+		log.Printf("Failed to write JSON response: %v", err)
+	}
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects per-field problems so a form can highlight all of them together
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Add(field, code, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// OrNil returns nil when nothing was added, so callers can return it directly
+func (e *ValidationError) OrNil() *ValidationError {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldError := range e.Errors {
+		messages[i] = fieldError.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// writeValidationError responds 422 with the field errors, plus a combined "error" for older clients
+func writeValidationError(w http.ResponseWriter, err *ValidationError) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"error":  err.Error(),
+		"errors": err.Errors,
+	})
+}
+
+// writeError responds with a JSON error envelope, or a styled error page for browsers
+func (app *App) writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if wantsHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		app.templates.ExecuteTemplate(w, "error.html", ErrorPageData{
+			Title:      fmt.Sprintf("%d %s - ControlMate Utils", status, http.StatusText(status)),
+			Status:     status,
+			StatusText: http.StatusText(status),
+			Message:    message,
+			BasePath:   app.basePath,
+		})
+		return
+	}
+
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// recoveryMiddleware turns handler panics into a 500 instead of dropping the connection
+func (app *App) recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("Panic serving %s %s: %v", r.Method, r.URL.Path, err)
+				app.writeError(w, r, http.StatusInternalServerError, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireDestructive guards endpoints that deployments can switch off with
+// CM_ALLOW_DESTRUCTIVE_ACTIONS=false
+func (app *App) requireDestructive(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.allowDestructive {
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error": "Destructive actions are disabled on this device",
+				"code":  "destructive_disabled",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireAuth protects endpoints that expose credentials. They are refused outright unless
+// CM_AUTH_TOKEN is configured, and then require it as a bearer token, the basic auth password,
+// or a session cookie from /api/auth/login.
+func (app *App) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := app.AuthToken()
+		if expected == "" {
+			app.writeError(w, r, http.StatusForbidden, "This endpoint requires authentication to be enabled (set CM_AUTH_TOKEN)")
+			return
+		}
+
+		if !requestAuthenticated(r, expected, time.Now()) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.writeError(w, r, http.StatusUnauthorized, "Invalid or missing authentication token")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func requestAuthenticated(r *http.Request, expected string, now time.Time) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+		return true
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	return err == nil && validSessionCookie(expected, cookie.Value, now)
+}
+
+const (
+	sessionCookieName = "cm_session"
+	sessionTTL        = 12 * time.Hour
+)
+
+// signSessionCookie returns "<expiry>.<HMAC of expiry>". Keying the HMAC with the auth token
+// means rotating the token also signs out every browser session, with no server-side state.
+func signSessionCookie(key string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(expiry))
+	return expiry + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+func validSessionCookie(key, value string, now time.Time) bool {
+	expiry, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(expiry))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && now.Before(time.Unix(unix, 0))
+}
+
+func (app *App) loginPageHandler(w http.ResponseWriter, r *http.Request) {
+	app.templates.ExecuteTemplate(w, "login.html", LoginPageData{
+		Title:    "Sign in - ControlMate Utils",
+		BasePath: app.basePath,
+	})
+}
+
+// loginHandler accepts the login page's form post, redirecting back to the UI, or a JSON
+// {"token": ...} body from scripts
+func (app *App) loginHandler(w http.ResponseWriter, r *http.Request) {
+	expected := app.AuthToken()
+	if expected == "" {
+		app.writeError(w, r, http.StatusForbidden, "Login requires authentication to be enabled (set CM_AUTH_TOKEN)")
+		return
+	}
+
+	isForm := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	var token string
+	if isForm {
+		token = r.PostFormValue("token")
+	} else {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+			return
+		}
+		token = req.Token
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		log.Printf("Failed login attempt from %s", r.RemoteAddr)
+		if isForm {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			app.templates.ExecuteTemplate(w, "login.html", LoginPageData{
+				Title:    "Sign in - ControlMate Utils",
+				Error:    "Invalid access token",
+				BasePath: app.basePath,
+			})
+			return
+		}
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid access token"})
+		return
+	}
+
+	expires := time.Now().Add(sessionTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    signSessionCookie(expected, expires),
+		Path:     app.basePath + "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if isForm {
+		http.Redirect(w, r, app.basePath+"/", http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "expires_at": expires.Format(time.RFC3339)})
+}
+
+func (app *App) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     app.basePath + "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (app *App) AuthToken() string {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.authToken
+}
+
+func (app *App) authTokenFile() string {
+	return filepath.Join(app.stateDir, "auth-token")
+}
+
+// loadAuthToken prefers a token saved by a previous rotation over CM_AUTH_TOKEN,
+// so a rotation survives restarts even though the environment still has the old value
+func (app *App) loadAuthToken() string {
+	data, err := os.ReadFile(app.authTokenFile())
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("Failed to load rotated auth token: %v", err)
+	}
+	return os.Getenv("CM_AUTH_TOKEN")
+}
+
+// rotateAuthToken persists a fresh random token before switching to it, so a failed write
+// leaves the current token in place
+func (app *App) rotateAuthToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	path := app.authTokenFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %v", err)
+	}
+	// Write then rename so a crash can't leave a truncated token file behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to save auth token: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to save auth token: %v", err)
+	}
+
+	app.mu.Lock()
+	app.authToken = token
+	app.mu.Unlock()
+	return token, nil
+}
+
+func (app *App) rotateAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := app.rotateAuthToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Auth token rotated by %s", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "token": token})
+}
+
+// requiredStaticAssets are produced by the npm build pipeline and referenced by every page
+var requiredStaticAssets = []string{"styles.css", "app.js"}
+
+func missingStaticAssets(fsys fs.FS) []string {
+	var missing []string
+	for _, name := range requiredStaticAssets {
+		if _, err := fs.Stat(fsys, name); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// staticHandler serves the embedded assets, explaining the missing build step instead of
+// returning bare 404s when the binary was built without running the asset pipeline
+func (app *App) staticHandler(fsys fs.FS) http.Handler {
+	missing := missingStaticAssets(fsys)
+	if len(missing) == 0 {
+		return http.FileServer(http.FS(fsys))
+	}
+
+	log.Printf("WARNING: embedded static assets are missing (%s). "+
+		"The binary was built without the asset pipeline; run \"npm run build\" before \"go build\".",
+		strings.Join(missing, ", "))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.writeError(w, r, http.StatusInternalServerError,
+			"Static assets were not embedded in this build. Run \"npm run build\" and rebuild the binary.")
+	})
+}
+
+func (app *App) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeError(w, r, http.StatusNotFound, "The requested page was not found")
+}
+
+func (app *App) homeHandler(w http.ResponseWriter, r *http.Request) {
+	data := TemplateData{
+		Title:       "ControlMate Utils",
+		ActiveNav:   "network",
+		Version:     app.Version(),
+		PageContent: "network",
+		DeviceLabel: app.deviceLabel,
+		BasePath:    app.basePath,
+	}
+	app.templates.ExecuteTemplate(w, "index.html", data)
+}
+
+func (app *App) getNmcliStatusHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{"available": app.NmcliAvailable()})
+}
+
+func (app *App) getInterfacesHandler(w http.ResponseWriter, r *http.Request) {
+	interfaces, err := getNetworkInterfaces()
+	if err != nil {
+		app.writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Managed state comes from NetworkManager, so it's left out when nmcli isn't usable
+	if app.NmcliAvailable() {
+		if output, err := runCommandOutput(r.Context(), "nmcli", "-t", "-f", "DEVICE,STATE", "device", "status"); err == nil {
+			applyManagedStates(interfaces, parseDeviceStates(string(output)))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, interfaces)
+}
+
+func (app *App) getNeighborsHandler(w http.ResponseWriter, r *http.Request) {
+	if runtime.GOOS != "linux" || !procAvailable() {
+		writeProcUnavailable(w)
+		return
+	}
+
+	neighbors, err := getNeighbors()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, neighbors)
+}
+
+func (app *App) renewDHCPHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, err := net.InterfaceByName(name); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Interface not found: " + name})
+		return
+	}
+
+	if app.NmcliAvailable() {
+		method, err := getInterfaceIPv4Method(name)
+		if err == nil && method == "manual" {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Interface " + name + " is statically configured; DHCP renewal is not applicable"})
+			return
+		}
+	}
+
+	if err := renewDHCPLease(name, app.NmcliAvailable()); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":       "success",
+		"ip_addresses": waitForIPv4(name, 10*time.Second),
+	})
+}
+
+func (app *App) setInterfaceDNSHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if _, err := net.InterfaceByName(name); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Interface not found: " + name})
+		return
+	}
+
+	var req struct {
+		Servers []string `json:"servers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+	if err := validateDNSServers(req.Servers); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := setInterfaceDNS(name, req.Servers); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.Servers == nil {
+		req.Servers = []string{}
+	}
+	log.Printf("DNS on %s set to %v", name, req.Servers)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "interface": name, "servers": req.Servers})
+}
+
+func (app *App) reapplyInterfaceHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if _, err := net.InterfaceByName(name); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Interface not found: " + name})
+		return
+	}
+
+	state, err := deviceState(name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if state == "unmanaged" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Interface " + name + " is not managed by NetworkManager; there is no configuration to reapply"})
+		return
+	}
+
+	if output, err := runCommand("nmcli", "device", "reapply", name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to reapply %s: %v (output: %s)", name, err, strings.TrimSpace(string(output)))})
+		return
+	}
+
+	state, err = deviceState(name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Reapplied configuration on %s", name)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "interface": name, "state": state})
+}
+
+func (app *App) setInterfaceManagedHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if _, err := net.InterfaceByName(name); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Interface not found: " + name})
+		return
+	}
+
+	var req struct {
+		Managed *bool `json:"managed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Managed == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Request body must be {\"managed\": true|false}"})
+		return
+	}
+
+	if output, err := runCommand("nmcli", buildManagedArgs(name, *req.Managed)...); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to set managed state on %s: %v (output: %s)", name, err, strings.TrimSpace(string(output)))})
+		return
+	}
+
+	log.Printf("NetworkManager managed state on %s set to %t", name, *req.Managed)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "interface": name, "managed": *req.Managed})
+}
+
+func (app *App) getInterfaceErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, err := net.InterfaceByName(name); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Interface not found: " + name})
+		return
+	}
+
+	counters, err := readInterfaceErrorCounters(sysClassNetPath, name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, app.recordInterfaceErrors(name, counters, time.Now()))
+}
+
+// recordInterfaceErrors stores the latest sample and reports deltas against the previous one
+func (app *App) recordInterfaceErrors(name string, counters InterfaceErrorCounters, now time.Time) InterfaceErrors {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	result := InterfaceErrors{Name: name, Counters: counters}
+	if previous, ok := app.errorSamples[name]; ok {
+		deltas := diffInterfaceErrors(previous.counters, counters)
+		result.Deltas = &deltas
+		result.IntervalSeconds = now.Sub(previous.at).Seconds()
+	}
+
+	if app.errorSamples == nil {
+		app.errorSamples = map[string]interfaceErrorSample{}
+	}
+	app.errorSamples[name] = interfaceErrorSample{counters: counters, at: now}
+	return result
+}
+
+const maxWiFiErrors = 50
+
+// recordWiFiError appends to the in-memory WiFi error log, evicting the oldest entries past the cap
+func (app *App) recordWiFiError(event, ssid, message string, now time.Time) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	app.wifiErrors = append(app.wifiErrors, WiFiErrorEntry{
+		Time:    now.Format(time.RFC3339),
+		Event:   event,
+		SSID:    ssid,
+		Code:    classifyWiFiError(message),
+		Message: message,
+	})
+	if excess := len(app.wifiErrors) - maxWiFiErrors; excess > 0 {
+		app.wifiErrors = slices.Delete(app.wifiErrors, 0, excess)
+	}
+}
+
+func (app *App) WiFiErrors() []WiFiErrorEntry {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return append([]WiFiErrorEntry{}, app.wifiErrors...)
+}
+
+func (app *App) clearWiFiErrors() int {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	cleared := len(app.wifiErrors)
+	app.wifiErrors = nil
+	return cleared
+}
+
+func (app *App) subscribeInterfaceEvents() chan InterfaceEvent {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	ch := make(chan InterfaceEvent, 16)
+	if app.ifaceWatchers == nil {
+		app.ifaceWatchers = map[chan InterfaceEvent]struct{}{}
+	}
+	app.ifaceWatchers[ch] = struct{}{}
+	return ch
+}
+
+func (app *App) unsubscribeInterfaceEvents(ch chan InterfaceEvent) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	delete(app.ifaceWatchers, ch)
+}
+
+func (app *App) publishInterfaceEvent(event InterfaceEvent) {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	for ch := range app.ifaceWatchers {
+		// Never block the poller on a slow client; it will see the next change
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// watchInterfaces polls interface state every second and publishes changes to subscribers
+func (app *App) watchInterfaces() {
+	previous := snapshotInterfaces(sysClassNetPath)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		current := snapshotInterfaces(sysClassNetPath)
+		now := time.Now()
+		for _, event := range diffInterfaceStates(previous, current, now) {
+			app.publishInterfaceEvent(event)
+			app.recordInterfaceTransition(interfaceTransition(previous, current, event))
+			if was, ok := previous[event.Name]; ok && was.carrier && !event.Carrier && isWirelessInterface(event.Name) {
+				app.recordWiFiError("disconnect", "", fmt.Sprintf("%s lost carrier (%s)", event.Name, event.Status), now)
+			}
+		}
+		previous = current
+	}
+}
+
+const maxInterfaceHistory = 200
+
+// recordInterfaceTransition appends to the bounded transition history, evicting the oldest entries
+func (app *App) recordInterfaceTransition(transition InterfaceTransition) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	app.ifaceHistory = append(app.ifaceHistory, transition)
+	if excess := len(app.ifaceHistory) - maxInterfaceHistory; excess > 0 {
+		app.ifaceHistory = slices.Delete(app.ifaceHistory, 0, excess)
+	}
+}
+
+func (app *App) InterfaceHistory() []InterfaceTransition {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return append([]InterfaceTransition{}, app.ifaceHistory...)
+}
+
+func (app *App) getInterfaceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, app.InterfaceHistory())
+}
+
+func (app *App) interfaceEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.writeError(w, r, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	events := app.subscribeInterfaceEvents()
+	defer app.unsubscribeInterfaceEvents(events)
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: interface\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+const bandwidthSampleInterval = time.Second
+
+func (app *App) interfaceBandwidthStreamHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, err := net.InterfaceByName(name); err != nil {
+		app.writeError(w, r, http.StatusNotFound, "Interface not found: "+name)
+		return
+	}
+
+	previous, err := readInterfaceByteCounters(sysClassNetPath, name)
+	if err != nil {
+		app.writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	previousAt := time.Now()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.writeError(w, r, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	ticker := time.NewTicker(bandwidthSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case now := <-ticker.C:
+			current, err := readInterfaceByteCounters(sysClassNetPath, name)
+			if err != nil {
+				// The interface went away mid-stream; tell the client rather than going quiet
+				data, _ := json.Marshal(map[string]string{"error": err.Error()})
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+				flusher.Flush()
+				return
+			}
+
+			data, _ := json.Marshal(bandwidthRate(name, previous, current, now.Sub(previousAt), now))
+			fmt.Fprintf(w, "event: bandwidth\ndata: %s\n\n", data)
+			flusher.Flush()
+
+			previous, previousAt = current, now
+		}
+	}
+}
+
+func (app *App) getWiFiErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, app.WiFiErrors())
+}
+
+func (app *App) clearWiFiErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "cleared": app.clearWiFiErrors()})
+}
+
+func (app *App) getWiFiNetworksHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+	if !checkWiFiUnblocked(w) {
+		return
+	}
+
+	securityFilter := r.URL.Query().Get("security")
+	if securityFilter == "" {
+		securityFilter = "all"
+	}
+	if securityFilter != "all" && securityFilter != "secured" && securityFilter != "open" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "security must be one of: secured, open, all"})
+		return
+	}
+
+	minSignal := 0
+	if value := r.URL.Query().Get("min_signal"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 100 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "min_signal must be an integer between 0 and 100"})
+			return
+		}
+		minSignal = n
+	}
+
+	band := r.URL.Query().Get("band")
+	if band == "" {
+		band = "all"
+	}
+	if band != "all" && band != "2.4" && band != "5" && band != "6" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "band must be one of: 2.4, 5, 6, all"})
+		return
+	}
+
+	limit := wifiScanLimit()
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be a positive integer"})
+			return
+		}
+		if limit == 0 || n < limit {
+			limit = n
+		}
+	}
+
+	device, err := scanDeviceParam(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// A cache older than two autoscan intervals means the background scanner has stalled
+	networks, at := app.cachedScan(device)
+	stale := time.Since(at) > 2*wifiAutoscanInterval()
+	if networks == nil || stale || r.URL.Query().Get("refresh") == "true" {
+		networks, err = scanWiFiNetworks(r.Context(), device)
+		if errors.Is(err, errCommandBusy) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	} else {
+		w.Header().Set("X-Scan-Age", strconv.Itoa(int(time.Since(at).Seconds())))
+	}
+
+	networks = filterNetworks(networks, securityFilter, minSignal)
+	networks = filterNetworksByBand(networks, band)
+	if limit > 0 {
+		networks = strongestNetworks(networks, limit)
+	}
+	writeJSON(w, http.StatusOK, networks)
+}
+
+// scanDeviceParam reads the optional ?ifname= scan parameter
+func scanDeviceParam(r *http.Request) (string, error) {
+	// Without sysfs (e.g. on a dev machine) there is nothing to validate against, so fall back to nmcli's choice
+	devices, _ := getWiFiDevices()
+	return resolveScanDevice(r.URL.Query().Get("ifname"), devices)
+}
+
+func (app *App) getWiFiScanMetaHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+	if !checkWiFiUnblocked(w) {
+		return
+	}
+
+	device, err := scanDeviceParam(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	start := time.Now()
+	networks, err := scanWiFiNetworks(r.Context(), device)
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if networks == nil {
+		networks = []WiFiNetwork{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"meta":     summarizeScan(networks, time.Since(start)),
+		"networks": networks,
+	})
+}
+
+func (app *App) connectWiFiHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+	if !checkWiFiUnblocked(w) {
+		return
+	}
+
+	var req ConnectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if problems := validateConnectionRequest(req); problems != nil {
+		writeValidationError(w, problems)
+		return
+	}
+
+	if r.URL.Query().Get("force") != "true" && alreadyConnected(req) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "already_connected", "ssid": req.SSID})
+		return
+	}
+
+	defer app.beginConnect()()
+	err := connectToWiFi(req)
+	app.countConnect(err == nil)
+	if err != nil {
+		app.recordWiFiError("connect", req.SSID, err.Error(), time.Now())
+		writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+const connectVerifyTimeout = 20 * time.Second
+
+func (app *App) connectVerifyWiFiHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+	if !checkWiFiUnblocked(w) {
+		return
+	}
+
+	var req ConnectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if problems := validateConnectionRequest(req); problems != nil {
+		writeValidationError(w, problems)
+		return
+	}
+
+	defer app.beginConnect()()
+	err := connectToWiFi(req)
+	app.countConnect(err == nil)
+	if err != nil {
+		app.recordWiFiError("connect", req.SSID, err.Error(), time.Now())
+		writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	result := verifyWiFiConnection(req.SSID, connectVerifyTimeout, wifiConnectStages)
+	switch {
+	case result["connected"] != true:
+		app.recordWiFiError("connect", req.SSID, "did not associate within "+connectVerifyTimeout.String(), time.Now())
+	case result["has_ip"] != true:
+		app.recordWiFiError("connect", req.SSID, "associated but no IPv4 address was assigned", time.Now())
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (app *App) selfHealWiFiHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	if checkNetworkConnectivity() {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "healthy", "steps": []HealStepResult{}})
+		return
+	}
+
+	device, err := getWiFiDevice()
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	connection, err := activeConnection(device)
+	if err != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "WiFi is not connected, so there is no connection to repair: " + err.Error()})
+		return
+	}
+
+	log.Printf("Internet unreachable on %s (%s), attempting WiFi self-heal", device, connection)
+	defer app.beginConnect()()
+	recoveredBy, steps := runHealSteps(buildWiFiHealSteps(device, connection), func() bool {
+		return waitForConnectivity(checkNetworkConnectivity, selfHealSettleTimeout)
+	})
+
+	status := "failed"
+	if recoveredBy != "" {
+		status = "recovered"
+		log.Printf("WiFi self-heal restored connectivity at step %s", recoveredBy)
+	} else {
+		app.recordWiFiError("self_heal", connection, "self-heal could not restore internet access", time.Now())
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": status, "recovered_by": recoveredBy, "steps": steps})
+}
+
+// wpsTimeout matches the two-minute walk time an AP keeps its WPS button window open
+const wpsTimeout = 2 * time.Minute
+
+func (app *App) wpsConnectHandler(w http.ResponseWriter, r *http.Request) {
+	// NetworkManager has no WPS support, so this talks to wpa_supplicant directly
+	if !commandAvailable("wpa_cli") {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "wpa_cli is not installed or not available"})
+		return
+	}
+
+	device, err := scanDeviceParam(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if device == "" {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "no WiFi device found"})
+		return
+	}
+
+	defer app.beginConnect()()
+	if err := startWPSPushButton(device); err != nil {
+		app.recordWiFiError("wps", "", err.Error(), time.Now())
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("WPS push-button started on %s, waiting up to %s", device, wpsTimeout)
+	ssid, connected := waitForWPSConnection(r.Context(), func() (map[string]string, error) {
+		return wpaStatus(device)
+	}, wpsTimeout, 2*time.Second)
+	app.countConnect(connected)
+	if !connected {
+		app.recordWiFiError("wps", "", "WPS timed out after "+wpsTimeout.String(), time.Now())
+		writeJSON(w, http.StatusGatewayTimeout, map[string]string{"status": "timeout", "error": "No access point completed WPS within " + wpsTimeout.String()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "ssid": ssid, "interface": device})
+}
+
+func startWPSPushButton(device string) error {
+	output, err := runCommand("wpa_cli", "-i", device, "wps_pbc")
+	if err != nil {
+		return fmt.Errorf("failed to start WPS: %v (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+	// wpa_cli exits 0 even when the request is rejected, reporting FAIL instead of OK
+	if strings.TrimSpace(string(output)) != "OK" {
+		return fmt.Errorf("wpa_supplicant rejected WPS request: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// wpaStatus parses the key=value lines of `wpa_cli status`
+func wpaStatus(device string) (map[string]string, error) {
+	output, err := runCommand("wpa_cli", "-i", device, "status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query wpa_supplicant status: %v (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+
+	status := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			status[key] = value
+		}
+	}
+	return status, nil
+}
+
+// waitForWPSConnection polls status until wpa_supplicant reports a completed association,
+// returning the joined SSID
+func waitForWPSConnection(ctx context.Context, status func() (map[string]string, error), timeout, interval time.Duration) (string, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if current, err := status(); err == nil && current["wpa_state"] == "COMPLETED" {
+			return current["ssid"], true
+		}
+		if time.Now().After(deadline) {
+			return "", false
+		}
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (app *App) provisionWiFiHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+	if !checkWiFiUnblocked(w) {
+		return
+	}
+
+	var req ProvisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if err := validateProvisionRequest(req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	device, err := getWiFiDevice()
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+
+	defer app.beginConnect()()
+	err = provisionWiFi(req, device)
+	app.countConnect(err == nil)
+	if err != nil {
+		app.recordWiFiError("provision", req.SSID, err.Error(), time.Now())
+		writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "connection": req.SSID})
+}
+
+func (app *App) clearWiFiSecretHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	ssid := mux.Vars(r)["ssid"]
+
+	exists, err := savedWiFiProfileExists(ssid)
+	if err != nil {
+		writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Saved WiFi profile not found: " + ssid})
+		return
+	}
+
+	if err := clearWiFiSecret(ssid); err != nil {
+		writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// nmMACPolicyConfPath is a NetworkManager.conf drop-in owned by this service; nmcli can't
+// change global defaults itself, only reload them
+const nmMACPolicyConfPath = "/etc/NetworkManager/conf.d/90-cm-utils-mac-policy.conf"
+
+func (app *App) getMACPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy, err := readMACPolicy(nmMACPolicyConfPath)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (app *App) setMACPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	var req struct {
+		Policy string `json:"policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	policy, ok := macPolicyFor(req.Policy)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "policy must be one of: random, stable, permanent"})
+		return
+	}
+
+	if err := writeMACPolicy(nmMACPolicyConfPath, policy); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if output, err := runCommand("nmcli", "general", "reload", "conf"); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": fmt.Sprintf("saved MAC policy but failed to reload NetworkManager: %v (output: %s)", err, strings.TrimSpace(string(output))),
+		})
+		return
+	}
+
+	log.Printf("WiFi MAC policy set to %s", policy.Policy)
+	writeJSON(w, http.StatusOK, policy)
+}
+
+// macPolicyFor maps a policy name to its scan and connect-time settings. Only "permanent"
+// exposes the real MAC while scanning.
+func macPolicyFor(name string) (MACPolicy, bool) {
+	switch name {
+	case "random", "stable":
+		return MACPolicy{Policy: name, ScanRandomMAC: true, ClonedMACAddress: name, Configured: true}, true
+	case "permanent":
+		return MACPolicy{Policy: name, ScanRandomMAC: false, ClonedMACAddress: name, Configured: true}, true
+	}
+	return MACPolicy{}, false
+}
+
+func macPolicyConf(policy MACPolicy) string {
+	scan := "no"
+	if policy.ScanRandomMAC {
+		scan = "yes"
+	}
+	return "# Managed by cm-utils; changes here are overwritten\n" +
+		"[device]\n" +
+		"wifi.scan-rand-mac-address=" + scan + "\n" +
+		"\n" +
+		"[connection]\n" +
+		"wifi.cloned-mac-address=" + policy.ClonedMACAddress + "\n"
+}
+
+func writeMACPolicy(path string, policy MACPolicy) error {
+	// Write then rename so NetworkManager never reads a half-written drop-in
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(macPolicyConf(policy)), 0644); err != nil {
+		return fmt.Errorf("failed to save MAC policy: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save MAC policy: %v", err)
+	}
+	return nil
+}
+
+// readMACPolicy reports the drop-in's settings, or NetworkManager's defaults (random scan
+// MACs, the connection's own MAC when connecting) when it hasn't been written
+func readMACPolicy(path string) (MACPolicy, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return MACPolicy{Policy: "default", ScanRandomMAC: true, ClonedMACAddress: "preserve"}, nil
+	}
+	if err != nil {
+		return MACPolicy{}, fmt.Errorf("failed to read MAC policy: %v", err)
+	}
+
+	policy := MACPolicy{ScanRandomMAC: true, ClonedMACAddress: "preserve", Configured: true}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "wifi.scan-rand-mac-address":
+			policy.ScanRandomMAC = value == "yes" || value == "true" || value == "1"
+		case "wifi.cloned-mac-address":
+			policy.ClonedMACAddress = value
+		}
+	}
+	policy.Policy = policy.ClonedMACAddress
+	return policy, nil
+}
+
+const (
+	maxKeyfileSize          = 64 * 1024
+	nmSystemConnectionsPath = "/etc/NetworkManager/system-connections"
+)
+
+func (app *App) importConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxKeyfileSize+4096)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Expected a multipart upload with a \"file\" field no larger than 64KB"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxKeyfileSize+1))
+	if err != nil || len(data) > maxKeyfileSize {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Keyfile must be no larger than 64KB"})
+		return
+	}
+
+	id, err := validateKeyfile(string(data))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := importKeyfile(nmSystemConnectionsPath, id, data); err != nil {
+		if errors.Is(err, errKeyfileExists) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "A connection profile named " + id + " already exists"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Activation may legitimately fail if the network is out of range, so it doesn't fail the import
+	_, upErr := runCommand("nmcli", "connection", "up", "id", id)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "success",
+		"id":        id,
+		"activated": upErr == nil,
+	})
+}
+
+func (app *App) getSavedWiFiPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	ssid := mux.Vars(r)["ssid"]
+
+	exists, err := savedWiFiProfileExists(ssid)
+	if err != nil {
+		writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Saved WiFi profile not found: " + ssid})
+		return
+	}
+
+	output, err := runCommandOutput(r.Context(), "nmcli", "-s", "-g", "802-11-wireless-security.psk", "connection", "show", ssid)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to read secret for %s: %v", ssid, err)})
+		return
+	}
+
+	log.Printf("Saved WiFi password for %s read by %s", ssid, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, map[string]string{"ssid": ssid, "password": strings.TrimSpace(string(output))})
+}
+
+func (app *App) getOrphanedConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	orphans, err := findOrphanedConnections(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, orphans)
+}
+
+func (app *App) pruneOrphanedConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	var req struct {
+		Confirm bool `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Confirm {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Pruning deletes profiles; send {\"confirm\": true} to proceed"})
+		return
+	}
+
+	// Recompute server-side rather than trusting a client-supplied list
+	orphans, err := findOrphanedConnections(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	deleted := []SavedConnection{}
+	var failures []string
+	for _, orphan := range orphans {
+		if output, err := runCommandContext(r.Context(), "nmcli", "connection", "delete", "uuid", orphan.UUID); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v (output: %s)", orphan.Name, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		deleted = append(deleted, orphan)
+	}
+
+	log.Printf("Pruned %d orphaned connection profile(s)", len(deleted))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": deleted, "errors": failures})
+}
+
+func (app *App) getWiFiAutoconnectHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	profiles, err := listWiFiAutoconnect(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	enabled := 0
+	for _, profile := range profiles {
+		if profile.Autoconnect {
+			enabled++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"total": len(profiles), "autoconnect_enabled": enabled, "profiles": profiles})
+}
+
+func (app *App) setWiFiAutoconnectHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Request body must be {\"enabled\": true|false}"})
+		return
+	}
+
+	profiles, err := listWiFiAutoconnect(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	value := "no"
+	if *req.Enabled {
+		value = "yes"
+	}
+
+	updated := 0
+	var failures []string
+	for _, profile := range profiles {
+		if profile.Autoconnect == *req.Enabled {
+			continue
+		}
+		// Address by UUID so names with spaces or colons need no quoting
+		if output, err := runCommandContext(r.Context(), "nmcli", "connection", "modify", "uuid", profile.UUID, "connection.autoconnect", value); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v (output: %s)", profile.Name, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		updated++
+	}
+
+	log.Printf("Autoconnect set to %s on %d WiFi profile(s)", value, updated)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "enabled": *req.Enabled, "updated": updated, "errors": failures})
+}
+
+func (app *App) getCurrentWiFiHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nmcli is not installed or not available"})
+		return
+	}
+
+	if r.URL.Query().Get("all") == "true" {
+		connections, err := getAllCurrentWiFi()
+		if err != nil {
+			writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, connections)
+		return
+	}
+
+	currentWiFi, err := getCurrentWiFi()
+	if err != nil {
+		writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, currentWiFi)
+}
+
+func (app *App) getWiFiLinkHandler(w http.ResponseWriter, r *http.Request) {
+	iwAvailable := commandAvailable("iw")
+	if !iwAvailable && !app.NmcliAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "neither iw nor nmcli is installed or available"})
+		return
+	}
+
+	link, err := getWiFiLink(iwAvailable)
+	if err != nil {
+		writeJSON(w, commandErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, link)
+}
+
+func (app *App) getVersionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"version": app.Version()})
+}
+
+func (app *App) getSystemHealthHandler(w http.ResponseWriter, r *http.Request) {
+	// Check network connectivity
+	networkCheck := checkNetworkConnectivity()
+
+	// Calculate uptime
+	uptime := time.Since(app.startTime)
+	uptimeStr := formatUptime(uptime)
+
+	throttled := app.sampleThrottling(readThrottleCount(cpuSysfsPath))
+
+	// Determine overall status
+	status := "online"
+	if !networkCheck || throttled {
+		status = "degraded"
+	}
+
+	health := SystemHealth{
+		Status:        status,
+		Uptime:        uptimeStr,
+		NetworkCheck:  networkCheck,
+		LastCheck:     time.Now().Format(time.RFC3339),
+		Maintenance:   app.Maintenance(),
+		PendingReboot: app.PendingReboot(),
+		OnBattery:     readPowerStatus(powerSupplyPath).OnBattery,
+		Throttled:     throttled,
+	}
+
+	if runtime.GOOS == "linux" {
+		if entropy, err := readEntropy(procFile("sys", "kernel", "random", "entropy_avail")); err == nil && entropy.Low {
+			health.Warnings = append(health.Warnings, fmt.Sprintf("Entropy is critically low (%d bits); TLS key generation may block", entropy.Available))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, health)
+}
+
+func (app *App) getFullHealthHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, runHealthChecks(r.Context(), fullHealthChecks(), healthCheckTimeout))
+}
+
+const (
+	healthOK       = "ok"
+	healthWarn     = "warn"
+	healthCritical = "critical"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// defaultDNSHealthCheckName is resolved to confirm the system resolver works end to end when
+// CM_HEALTH_DNS_NAME doesn't name a host the device is expected to resolve
+const defaultDNSHealthCheckName = "google.com"
+
+type healthCheck struct {
+	name string
+	run  func(ctx context.Context) (status, detail string)
+}
+
+func fullHealthChecks() []healthCheck {
+	return []healthCheck{
+		{name: "network", run: func(ctx context.Context) (string, string) {
+			if !checkNetworkConnectivity() {
+				return healthCritical, "Internet is unreachable"
+			}
+			return healthOK, "Internet is reachable"
+		}},
+		{name: "dns", run: checkDNSHealth},
+		{name: "disk", run: checkDiskHealth},
+		{name: "memory", run: func(ctx context.Context) (string, string) {
+			data, err := os.ReadFile(procFile("meminfo"))
+			if err != nil {
+				return healthOK, "Memory usage is not available on this system"
+			}
+			return memoryHealth(memoryInfoFromMeminfo(parseMeminfo(string(data))))
+		}},
+		{name: "cpu", run: func(ctx context.Context) (string, string) {
+			data, err := os.ReadFile(procFile("loadavg"))
+			if err != nil {
+				return healthOK, "Load average is not available on this system"
+			}
+			return cpuLoadHealth(string(data), runtime.NumCPU())
+		}},
+		{name: "temperature", run: func(ctx context.Context) (string, string) {
+			return temperatureHealth(sysClassThermalPath)
+		}},
+		{name: "entropy", run: func(ctx context.Context) (string, string) {
+			entropy, err := readEntropy(procFile("sys", "kernel", "random", "entropy_avail"))
+			if err != nil {
+				return healthOK, "Entropy is not available on this system"
+			}
+			if entropy.Low {
+				return healthWarn, fmt.Sprintf("Entropy is low (%d bits)", entropy.Available)
+			}
+			return healthOK, fmt.Sprintf("%d bits available", entropy.Available)
+		}},
+	}
+}
+
+// runHealthChecks runs every check concurrently; a check that outlives timeout is reported
+// critical rather than holding up the whole report
+func runHealthChecks(ctx context.Context, checks []healthCheck, timeout time.Duration) FullHealth {
+	report := FullHealth{
+		Status:    healthOK,
+		CheckedAt: time.Now().Format(time.RFC3339),
+		Checks:    make([]HealthCheck, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			// Buffered so an abandoned check can still finish and exit
+			done := make(chan HealthCheck, 1)
+			go func() {
+				status, detail := check.run(checkCtx)
+				done <- HealthCheck{Name: check.name, Status: status, Detail: detail}
+			}()
+
+			select {
+			case result := <-done:
+				report.Checks[i] = result
+			case <-checkCtx.Done():
+				report.Checks[i] = HealthCheck{Name: check.name, Status: healthCritical, Detail: "Check timed out after " + timeout.String()}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, check := range report.Checks {
+		report.Status = worseHealthStatus(report.Status, check.Status)
+	}
+	return report
+}
+
+func worseHealthStatus(a, b string) string {
+	rank := map[string]int{healthOK: 0, healthWarn: 1, healthCritical: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// checkDNSHealth resolves CM_HEALTH_DNS_NAME. Without one, a public name is tried but a failure
+// only warns, since an air-gapped device can't resolve it even with a working resolver.
+func checkDNSHealth(ctx context.Context) (string, string) {
+	name, failure := strings.TrimSpace(os.Getenv("CM_HEALTH_DNS_NAME")), healthCritical
+	if name == "" {
+		name, failure = defaultDNSHealthCheckName, healthWarn
+	}
+	return dnsLookupHealth(name, failure, func(name string) ([]string, error) {
+		return net.DefaultResolver.LookupHost(ctx, name)
+	})
+}
+
+func dnsLookupHealth(name, failure string, lookup func(string) ([]string, error)) (string, string) {
+	addresses, err := lookup(name)
+	if err != nil {
+		return failure, fmt.Sprintf("Failed to resolve %s: %v", name, err)
+	}
+	return healthOK, fmt.Sprintf("Resolved %s to %s", name, strings.Join(addresses, ", "))
+}
+
+func checkDiskHealth(ctx context.Context) (string, string) {
+	if !commandAvailable("df") {
+		return healthOK, "Disk usage is not available on this system"
+	}
+	output, err := runCommandOutput(ctx, "df", "-P", "-k", "/")
+	if err != nil {
+		return healthWarn, fmt.Sprintf("Failed to read disk usage: %v", err)
+	}
+	return diskUsageHealth(string(output))
+}
+
+// diskUsageHealth grades the root filesystem from `df -P` output, whose fifth column is the usage percentage
+func diskUsageHealth(output string) (string, string) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return healthWarn, "Unexpected df output"
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 5 {
+		return healthWarn, "Unexpected df output"
+	}
+	used, err := strconv.Atoi(strings.TrimSuffix(fields[4], "%"))
+	if err != nil {
+		return healthWarn, "Unexpected df output"
+	}
+
+	detail := fmt.Sprintf("Root filesystem is %d%% full", used)
+	switch {
+	case used >= 95:
+		return healthCritical, detail
+	case used >= 85:
+		return healthWarn, detail
+	}
+	return healthOK, detail
+}
+
+func memoryHealth(info MemoryInfo) (string, string) {
+	if info.Total == 0 {
+		return healthOK, "Memory usage is not available on this system"
+	}
+	available := float64(info.Available) / float64(info.Total) * 100
+	detail := fmt.Sprintf("%.0f%% of memory is available", available)
+	switch {
+	case available < 5:
+		return healthCritical, detail
+	case available < 15:
+		return healthWarn, detail
+	}
+	return healthOK, detail
+}
+
+// cpuLoadHealth grades the 1-minute load average from /proc/loadavg relative to the CPU count
+func cpuLoadHealth(loadavg string, cpus int) (string, string) {
+	fields := strings.Fields(loadavg)
+	if len(fields) == 0 || cpus <= 0 {
+		return healthWarn, "Unexpected loadavg content"
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return healthWarn, "Unexpected loadavg content"
+	}
+
+	perCPU := load / float64(cpus)
+	detail := fmt.Sprintf("Load average %.2f across %d CPUs", load, cpus)
+	switch {
+	case perCPU >= 2:
+		return healthCritical, detail
+	case perCPU >= 1:
+		return healthWarn, detail
+	}
+	return healthOK, detail
+}
+
+const sysClassThermalPath = "/sys/class/thermal"
+
+// temperatureHealth grades the hottest thermal zone; zones report millidegrees Celsius
+func temperatureHealth(base string) (string, string) {
+	files, _ := filepath.Glob(filepath.Join(base, "thermal_zone*", "temp"))
+	hottest, found := 0, false
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if milli, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			hottest, found = max(hottest, milli/1000), true
+		}
+	}
+	if !found {
+		return healthOK, "No temperature sensors found"
+	}
+
+	detail := fmt.Sprintf("Hottest sensor reads %d°C", hottest)
+	switch {
+	case hottest >= 85:
+		return healthCritical, detail
+	case hottest >= 75:
+		return healthWarn, detail
+	}
+	return healthOK, detail
+}
+
+func (app *App) getPowerHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, readPowerStatus(powerSupplyPath))
+}
+
+func (app *App) getMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, app.Maintenance())
+}
+
+func (app *App) setMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceState
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	req.Message = strings.TrimSpace(req.Message)
+	if len(req.Message) > maxMaintenanceMessageLength {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("Message must be at most %d characters", maxMaintenanceMessageLength),
+		})
+		return
+	}
+	req.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	if err := app.setMaintenance(req); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Maintenance mode set to %v: %s", req.Enabled, req.Message)
+	writeJSON(w, http.StatusOK, req)
+}
+
+func (app *App) getCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	effective, _ := readEffectiveCapabilities()
+	capabilities := resolveCapabilities(os.Geteuid(), effective)
+	capabilities.DestructiveEnabled = app.allowDestructive
+	writeJSON(w, http.StatusOK, capabilities)
+}
+
+func (app *App) getSystemInfoHandler(w http.ResponseWriter, r *http.Request) {
+	hostname, _ := os.Hostname()
+
+	info := SystemInfo{
+		Version:     app.Version(),
+		DeviceLabel: app.deviceLabel,
+		Hostname:    hostname,
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		InitSystem:  app.initSystem,
+	}
+
+	// Boot time is left empty where /proc is masked; the rest of the info is still useful
+	if bootTime, err := getBootTime(); err == nil {
+		info.BootTime = bootTime.Format(time.RFC3339)
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (app *App) processesHandler(w http.ResponseWriter, r *http.Request) {
+	data := TemplateData{
+		Title:       "Processes - ControlMate Utils",
+		ActiveNav:   "processes",
+		Version:     app.Version(),
+		PageContent: "processes",
+		DeviceLabel: app.deviceLabel,
+		BasePath:    app.basePath,
+	}
+	app.templates.ExecuteTemplate(w, "processes.html", data)
+}
+
+func (app *App) systemHandler(w http.ResponseWriter, r *http.Request) {
+	data := TemplateData{
+		Title:       "System - ControlMate Utils",
+		ActiveNav:   "system",
+		Version:     app.Version(),
+		PageContent: "system",
+		DeviceLabel: app.deviceLabel,
+		BasePath:    app.basePath,
+	}
+	app.templates.ExecuteTemplate(w, "system.html", data)
+}
+
+const (
+	processGatherTimeout = 5 * time.Second
+	maxStaleProcessAge   = time.Minute
+)
+
+// gatherProcesses lists processes under a short deadline. If ps hangs, a recent snapshot is
+// returned instead and stale is true.
+func (app *App) gatherProcesses(ctx context.Context) (processes []Process, stale bool, age time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, processGatherTimeout)
+	defer cancel()
+
+	processes, err = getProcesses(ctx)
+	if err == nil {
+		app.mu.Lock()
+		app.lastProcesses = processes
+		app.lastProcessAt = time.Now()
+		app.mu.Unlock()
+		return processes, false, 0, nil
+	}
+
+	if ctx.Err() != nil || errors.Is(err, errCommandBusy) {
+		app.mu.RLock()
+		cached, at := app.lastProcesses, app.lastProcessAt
+		app.mu.RUnlock()
+		if cached != nil && time.Since(at) <= maxStaleProcessAge {
+			log.Printf("Process gathering timed out, serving snapshot from %s ago", time.Since(at).Round(time.Second))
+			return cached, true, time.Since(at), nil
+		}
+	}
+
+	return nil, false, 0, err
+}
+
+func (app *App) getProcessesHandler(w http.ResponseWriter, r *http.Request) {
+	processes, stale, age, err := app.gatherProcesses(r.Context())
+	if stale {
+		w.Header().Set("X-Stale", "true")
+		w.Header().Set("X-Stale-Age", strconv.Itoa(int(age.Seconds())))
+	}
+	if errors.Is(err, errCommandBusy) {
+		app.writeError(w, r, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		app.writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("kernel") != "true" {
+		processes = filterKernelThreads(processes)
+	}
+
+	// The representation depends on Accept, so caches must key on it
+	w.Header().Set("Vary", "Accept")
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		writeProcessesNDJSON(w, processes)
+		return
+	}
+
+	// A fresh list stays a plain array for existing clients; a cached one is wrapped so the
+	// body itself says it's stale
+	var payload any = processes
+	if stale {
+		payload = staleProcessList{Stale: true, StaleAge: int(age.Seconds()), Processes: processes}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		app.writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// A weak ETag lets idle dashboards poll cheaply
+	etag := weakETag(body)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+// filterKernelThreads drops kernel threads, which ps shows with a bracketed command like [kworker/0:1]
+func filterKernelThreads(processes []Process) []Process {
+	filtered := make([]Process, 0, len(processes))
+	for _, process := range processes {
+		if strings.HasPrefix(process.Command, "[") && strings.HasSuffix(process.Command, "]") {
+			continue
+		}
+		filtered = append(filtered, process)
+	}
+	return filtered
+}
+
+const ndjsonFlushEvery = 100
+
+// writeProcessesNDJSON streams one Process per line so log pipelines can consume huge lists
+// without the whole array being built in memory first
+func writeProcessesNDJSON(w http.ResponseWriter, processes []Process) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+
+	encoder := json.NewEncoder(w)
+	for i, process := range processes {
+		if err := encoder.Encode(process); err != nil {
+			// Headers are already sent, so the client just sees a truncated stream
+			log.Printf("Failed to write NDJSON process list: %v", err)
+			return
+		}
+		if flusher != nil && (i+1)%ndjsonFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+}
+
+func weakETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// Weak comparison: ignore the W/ prefix on either side
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	defaultAuthFailureLines = 100
+	maxAuthFailureLines     = 1000
+)
+
+func (app *App) getKernelHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, getKernelInfo(r.Context()))
+}
+
+func (app *App) getEntropyHandler(w http.ResponseWriter, r *http.Request) {
+	if runtime.GOOS != "linux" || !procAvailable() {
+		writeProcUnavailable(w)
+		return
+	}
+
+	entropy, err := readEntropy(procFile("sys", "kernel", "random", "entropy_avail"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entropy)
+}
+
+func (app *App) getMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	if runtime.GOOS != "linux" || !procAvailable() {
+		writeProcUnavailable(w)
+		return
+	}
+
+	data, err := os.ReadFile(procFile("meminfo"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to read meminfo: %v", err)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, memoryInfoFromMeminfo(parseMeminfo(string(data))))
+}
+
+// parseMeminfo maps each /proc/meminfo key to its value in bytes
+func parseMeminfo(content string) map[string]uint64 {
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(content, "\n") {
+		key, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		// Despite the label, "kB" here means KiB
+		if len(fields) > 1 && fields[1] == "kB" {
+			value *= 1024
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values
+}
+
+// memoryInfoFromMeminfo derives Used from MemAvailable like free(1), so reclaimable cache
+// doesn't read as real usage. Cached is the page cache alone; the reclaimable part of Slab is
+// reported separately rather than folded in, since Slab already counts it.
+func memoryInfoFromMeminfo(values map[string]uint64) MemoryInfo {
+	info := MemoryInfo{
+		Total:       values["MemTotal"],
+		Free:        values["MemFree"],
+		Available:   values["MemAvailable"],
+		Buffers:     values["Buffers"],
+		Cached:      values["Cached"],
+		Slab:        values["Slab"],
+		Reclaimable: values["SReclaimable"],
+		Shmem:       values["Shmem"],
+	}
+	if info.Total > info.Available {
+		info.Used = info.Total - info.Available
+	}
+	return info
+}
+
+// lowEntropyThreshold is the pool size below which fresh devices tend to stall on key generation
+const lowEntropyThreshold = 256
+
+func readEntropy(path string) (EntropyStatus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return EntropyStatus{}, fmt.Errorf("failed to read entropy: %v", err)
+	}
+
+	available, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return EntropyStatus{}, fmt.Errorf("unexpected entropy_avail value %q", strings.TrimSpace(string(data)))
+	}
+
+	return EntropyStatus{
+		Available: available,
+		Threshold: lowEntropyThreshold,
+		Low:       available < lowEntropyThreshold,
+	}, nil
+}
+
+const osReleasePath = "/etc/os-release"
+
+func (app *App) getOSReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := os.ReadFile(osReleasePath)
+	if err != nil {
+		// Some older systems only ship the /usr/lib copy that /etc/os-release links to
+		data, err = os.ReadFile("/usr/lib/os-release")
+	}
+	if err != nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "os-release is not available on this system", "code": "not_supported"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, parseOSRelease(string(data)))
+}
+
+const maxPackageQueries = 20
+
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+._-]{0,127}$`)
+
+func (app *App) getPackagesHandler(w http.ResponseWriter, r *http.Request) {
+	var names []string
+	for _, name := range strings.Split(r.URL.Query().Get("names"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !packageNamePattern.MatchString(name) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid package name: " + name})
+			return
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 || len(names) > maxPackageQueries {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("names must list between 1 and %d comma-separated packages", maxPackageQueries)})
+		return
+	}
+
+	manager, packages, err := queryPackages(r.Context(), names)
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error(), "code": "not_supported"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"package_manager": manager, "packages": packages})
+}
+
+func (app *App) getRebootRequiredHandler(w http.ResponseWriter, r *http.Request) {
+	required, err := checkRebootRequired(r.Context(), "/run/reboot-required", "/run/reboot-required.pkgs")
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, required)
+}
+
+const cpuSysfsPath = "/sys/devices/system/cpu"
+
+func (app *App) getCPUGovernorHandler(w http.ResponseWriter, r *http.Request) {
+	governor, err := readCPUGovernors(cpuSysfsPath)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, governor)
+}
+
+func (app *App) setCPUGovernorHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Governor string `json:"governor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	current, err := readCPUGovernors(cpuSysfsPath)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validateCPUGovernor(current.Available, req.Governor); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := writeCPUGovernor(cpuSysfsPath, req.Governor); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("CPU governor set to %s", req.Governor)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "governor": req.Governor})
+}
+
+const sysBlockPath = "/sys/block"
+
+func (app *App) getDiskSmartHandler(w http.ResponseWriter, r *http.Request) {
+	if !commandAvailable("smartctl") {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "smartctl is not installed or not available"})
+		return
+	}
+
+	device := mux.Vars(r)["device"]
+	if !blockDeviceExists(sysBlockPath, device) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Block device not found: " + device})
+		return
+	}
+
+	// smartctl uses a non-zero exit bitmask for disk warnings, so rely on the JSON instead
+	output, err := runCommandOutput(r.Context(), "smartctl", "-H", "-A", "-j", "/dev/"+device)
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	smart, err := parseSmartctlOutput(device, output)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, smart)
+}
+
+func (app *App) getFirewallRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := getFirewallRules(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// defaultSysctlAllowlist is the set of kernel parameters writable through the API,
+// overridable with a comma-separated CM_SYSCTL_ALLOWLIST
+var defaultSysctlAllowlist = []string{
+	"net.ipv4.ip_forward",
+	"net.ipv6.conf.all.forwarding",
+	"net.ipv4.icmp_echo_ignore_all",
+	"net.core.rmem_max",
+	"net.core.wmem_max",
+	"vm.swappiness",
+}
+
+var sysctlKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)+$`)
+
+func sysctlAllowlist() []string {
+	if value := os.Getenv("CM_SYSCTL_ALLOWLIST"); value != "" {
+		var keys []string
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+	return defaultSysctlAllowlist
+}
+
+// sysctlPath maps a dotted key to its /proc/sys file, rejecting anything that escapes it
+func sysctlPath(key string) (string, error) {
+	if !sysctlKeyPattern.MatchString(key) {
+		return "", fmt.Errorf("invalid sysctl key: %s", key)
+	}
+
+	base := procFile("sys")
+	path := filepath.Join(base, strings.ReplaceAll(key, ".", string(filepath.Separator)))
+	if !strings.HasPrefix(path, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid sysctl key: %s", key)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", fmt.Errorf("unknown sysctl key: %s", key)
+	}
+	return path, nil
+}
+
+func (app *App) getSysctlHandler(w http.ResponseWriter, r *http.Request) {
+	if !procAvailable() {
+		writeProcUnavailable(w)
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	if !slices.Contains(sysctlAllowlist(), key) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "sysctl key is not on the allowlist: " + key})
+		return
+	}
+
+	path, err := sysctlPath(key)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to read %s: %v", key, err)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"key": key, "value": strings.TrimSpace(string(data))})
+}
+
+func (app *App) setSysctlHandler(w http.ResponseWriter, r *http.Request) {
+	if !procAvailable() {
+		writeProcUnavailable(w)
+		return
+	}
+
+	var req struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if !slices.Contains(sysctlAllowlist(), req.Key) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "sysctl key is not on the allowlist: " + req.Key})
+		return
+	}
+
+	if req.Value == "" || strings.ContainsAny(req.Value, "\n\r") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "value must be a non-empty single line"})
+		return
+	}
+
+	path, err := sysctlPath(req.Key)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := os.WriteFile(path, []byte(req.Value), 0644); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to set %s: %v", req.Key, err)})
+		return
+	}
+
+	log.Printf("sysctl %s set to %s", req.Key, req.Value)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "key": req.Key, "value": req.Value})
+}
+
+// routerTable is the nftables table owned by router mode, so teardown never touches other rules
+const routerTable = "cm_utils_router"
+
+func (app *App) getWireGuardHandler(w http.ResponseWriter, r *http.Request) {
+	if !commandAvailable("wg") {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "wg is not installed or not available"})
+		return
+	}
+
+	output, err := runCommandOutput(r.Context(), "wg", "show", "all", "dump")
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to read WireGuard status: %v", err)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, parseWireGuardDump(string(output)))
+}
+
+// wireGuardNamePattern is the interface name check wg-quick itself applies
+var wireGuardNamePattern = regexp.MustCompile(`^[A-Za-z0-9_=+.-]{1,15}$`)
+
+const wireGuardConfigDir = "/etc/wireguard"
+
+func (app *App) setWireGuardStateHandler(w http.ResponseWriter, r *http.Request) {
+	if !commandAvailable("wg-quick") {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "wg-quick is not installed or not available"})
+		return
+	}
+
+	vars := mux.Vars(r)
+	name, action := vars["iface"], vars["action"]
+	if !wireGuardNamePattern.MatchString(name) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid WireGuard interface name: " + name})
+		return
+	}
+	// wg-quick only manages interfaces it has a config for
+	if _, err := os.Stat(filepath.Join(wireGuardConfigDir, name+".conf")); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "No WireGuard configuration found for " + name})
+		return
+	}
+
+	if output, err := runCommand("wg-quick", action, name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("wg-quick %s %s failed: %v (output: %s)", action, name, err, strings.TrimSpace(string(output)))})
+		return
+	}
+
+	log.Printf("WireGuard interface %s brought %s", name, action)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "interface": name, "state": action})
+}
+
+// parseWireGuardDump parses `wg show all dump`: per interface, a 5-field line (name, private key,
+// public key, listen port, fwmark) followed by 9-field peer lines (name, public key, preshared
+// key, endpoint, allowed IPs, latest handshake, rx, tx, persistent keepalive), tab separated
+func parseWireGuardDump(output string) []WireGuardInterface {
+	interfaces := []WireGuardInterface{}
+	index := make(map[string]int)
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		switch len(fields) {
+		case 5:
+			port, _ := strconv.Atoi(fields[3])
+			index[fields[0]] = len(interfaces)
+			interfaces = append(interfaces, WireGuardInterface{
+				Name:       fields[0],
+				PublicKey:  fields[2],
+				ListenPort: port,
+				Peers:      []WireGuardPeer{},
+			})
+		case 9:
+			i, ok := index[fields[0]]
+			if !ok {
+				continue
+			}
+			peer := WireGuardPeer{PublicKey: fields[1], AllowedIPs: []string{}}
+			if fields[3] != "(none)" {
+				peer.Endpoint = fields[3]
+			}
+			if fields[4] != "(none)" {
+				peer.AllowedIPs = strings.Split(fields[4], ",")
+			}
+			// A zero handshake time means the peer has never connected
+			if unix, err := strconv.ParseInt(fields[5], 10, 64); err == nil && unix > 0 {
+				peer.LatestHandshake = time.Unix(unix, 0).Format(time.RFC3339)
+			}
+			peer.RxBytes, _ = strconv.ParseUint(fields[6], 10, 64)
+			peer.TxBytes, _ = strconv.ParseUint(fields[7], 10, 64)
+			if fields[8] != "off" {
+				peer.PersistentKeepalive, _ = strconv.Atoi(fields[8])
+			}
+			interfaces[i].Peers = append(interfaces[i].Peers, peer)
+		}
+	}
+	return interfaces
+}
+
+func (app *App) setRouterModeHandler(w http.ResponseWriter, r *http.Request) {
+	if !commandAvailable("nft") {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "nft is not installed or not available"})
+		return
+	}
+
+	var req struct {
+		Enabled bool   `json:"enabled"`
+		WAN     string `json:"wan"`
+		LAN     string `json:"lan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if req.Enabled {
+		if req.WAN == "" || req.LAN == "" || req.WAN == req.LAN {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "wan and lan must be two different interfaces"})
+			return
+		}
+		for _, name := range []string{req.WAN, req.LAN} {
+			if _, err := net.InterfaceByName(name); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Interface not found: " + name})
+				return
+			}
+		}
+	}
+
+	var err error
+	if req.Enabled {
+		err = enableRouterMode(app.routerModeStateFile(), req.WAN, req.LAN)
+	} else {
+		err = disableRouterMode(app.routerModeStateFile())
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Router mode enabled=%v (wan=%s, lan=%s)", req.Enabled, req.WAN, req.LAN)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "enabled": req.Enabled})
+}
+
+// diagnosticsSection is one file in the diagnostics archive and the collector that produces it
+type diagnosticsSection struct {
+	File    string
+	Collect func(ctx context.Context) ([]byte, error)
+}
+
+func commandSection(file, name string, args ...string) diagnosticsSection {
+	return diagnosticsSection{
+		File: file,
+		Collect: func(ctx context.Context) ([]byte, error) {
+			output, err := runCommandContext(ctx, name, args...)
+			if err != nil {
+				return output, fmt.Errorf("%s %s failed: %v", name, strings.Join(args, " "), err)
+			}
+			return output, nil
+		},
+	}
+}
+
+var diagnosticsSections = []diagnosticsSection{
+	commandSection("ip-addr.txt", "ip", "addr"),
+	commandSection("nmcli-dev-show.txt", "nmcli", "dev", "show"),
+	commandSection("ps-aux.txt", "ps", "aux"),
+	commandSection("journalctl.txt", "journalctl", "-n", "500", "--no-pager"),
+}
+
+const (
+	diagnosticsWorkers        = 4
+	diagnosticsSectionTimeout = 10 * time.Second
+	diagnosticsTotalTimeout   = 30 * time.Second
+)
+
+func (app *App) getDiagnosticsArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	filename := fmt.Sprintf("cm-utils-diagnostics-%s.tar.gz", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	ctx, cancel := context.WithTimeout(r.Context(), diagnosticsTotalTimeout)
+	defer cancel()
+
+	if err := writeDiagnosticsArchive(ctx, w, diagnosticsSections, diagnosticsSectionTimeout); err != nil {
+		// Headers are already sent, so all we can do is log and truncate the stream
+		log.Printf("Failed to write diagnostics archive: %v", err)
+	}
+}
+
+const (
+	defaultIperfPort     = 5201
+	defaultIperfDuration = 5
+	maxIperfDuration     = 30
+)
+
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+
+func validHost(host string) bool {
+	return net.ParseIP(host) != nil || (len(host) <= 253 && hostnamePattern.MatchString(host))
+}
+
+func (app *App) getResolvedStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := getResolverStatus(r.Context())
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+const (
+	defaultPublicIPURL = "https://api64.ipify.org"
+	publicIPTimeout    = 5 * time.Second
+	publicIPCacheTTL   = 5 * time.Minute
+)
+
+func (app *App) getPublicIPHandler(w http.ResponseWriter, r *http.Request) {
+	app.mu.RLock()
+	cached := app.publicIP
+	app.mu.RUnlock()
+	if cached != nil && time.Since(cached.checked) < publicIPCacheTTL && r.URL.Query().Get("refresh") != "true" {
+		writeJSON(w, http.StatusOK, cached)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), publicIPTimeout)
+	defer cancel()
+
+	result, err := lookupPublicIP(ctx, envOrDefault("CM_PUBLIC_IP_URL", defaultPublicIPURL))
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	app.mu.Lock()
+	app.publicIP = result
+	app.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (app *App) runIperfHandler(w http.ResponseWriter, r *http.Request) {
+	if !commandAvailable("iperf3") {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "iperf3 is not installed or not available"})
+		return
+	}
+
+	var req IperfRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if !validHost(req.Host) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "host must be an IP address or hostname"})
+		return
+	}
+	if req.Port == 0 {
+		req.Port = defaultIperfPort
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "port must be between 1 and 65535"})
+		return
+	}
+	if req.Duration <= 0 {
+		req.Duration = defaultIperfDuration
+	}
+	req.Duration = min(req.Duration, maxIperfDuration)
+
+	result, err := runIperf(r.Context(), req)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+const (
+	maxDNSBenchmarkServers  = 8
+	dnsBenchmarkTimeout     = 3 * time.Second
+	defaultDNSBenchmarkName = "example.com"
+)
+
+const (
+	defaultPortCheckTimeout = 2 * time.Second
+	maxPortCheckTimeout     = 10 * time.Second
+)
+
+func (app *App) portCheckHandler(w http.ResponseWriter, r *http.Request) {
+	var req PortCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if !validHost(req.Host) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "host must be an IP address or hostname"})
+		return
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "port must be between 1 and 65535"})
+		return
+	}
+	timeout := defaultPortCheckTimeout
+	if req.TimeoutMs != 0 {
+		timeout = time.Duration(req.TimeoutMs) * time.Millisecond
+		if timeout < 0 || timeout > maxPortCheckTimeout {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("timeout_ms must be between 1 and %d", maxPortCheckTimeout.Milliseconds())})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, checkTCPPort(req.Host, req.Port, timeout))
+}
+
+// checkTCPPort reports whether a TCP connection to host:port completes within timeout.
+// A refused or timed out dial is a result, not a request failure.
+func checkTCPPort(host string, port int, timeout time.Duration) PortCheckResult {
+	result := PortCheckResult{Host: host, Port: port}
+	start := time.Now()
+	if err := dialTCP(net.JoinHostPort(host, strconv.Itoa(port)), timeout); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Open = true
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+func (app *App) dnsBenchmarkHandler(w http.ResponseWriter, r *http.Request) {
+	var req DNSBenchmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if len(req.Servers) == 0 || len(req.Servers) > maxDNSBenchmarkServers {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("servers must list between 1 and %d DNS servers", maxDNSBenchmarkServers)})
+		return
+	}
+	for _, server := range req.Servers {
+		if net.ParseIP(server) == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid DNS server address: " + server})
+			return
+		}
+	}
+	if req.Name == "" {
+		req.Name = defaultDNSBenchmarkName
+	}
+	if !hostnamePattern.MatchString(req.Name) || len(req.Name) > 253 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name must be a valid hostname"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, benchmarkDNS(r.Context(), req.Servers, req.Name, pinnedResolver))
+}
+
+func (app *App) getAuthFailuresHandler(w http.ResponseWriter, r *http.Request) {
+	lines := defaultAuthFailureLines
+	if value := r.URL.Query().Get("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "lines must be a positive integer"})
+			return
+		}
+		lines = min(n, maxAuthFailureLines)
+	}
+
+	failures, err := getAuthFailures(r.Context(), lines)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, failures)
+}
+
+const (
+	defaultLogTailLines = 200
+	maxLogTailLines     = 2000
+	// maxLogTailBytes bounds the read when a file has very long lines
+	maxLogTailBytes = 1 << 20
+)
+
+func (app *App) getLogFileHandler(w http.ResponseWriter, r *http.Request) {
+	lines := defaultLogTailLines
+	if value := r.URL.Query().Get("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "lines must be a positive integer"})
+			return
+		}
+		lines = min(n, maxLogTailLines)
+	}
+
+	file, path, err := openLogFile(r.URL.Query().Get("path"), logDirs())
+	if err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	tail, err := tailFile(file, lines)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"path": path, "lines": tail})
+}
+
+var unitNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:-]{0,255}$`)
+
+func (app *App) followLogsHandler(w http.ResponseWriter, r *http.Request) {
+	unit := r.URL.Query().Get("unit")
+	if !unitNamePattern.MatchString(unit) {
+		app.writeError(w, r, http.StatusBadRequest, "unit must be a valid systemd unit name")
+		return
+	}
+	if !commandAvailable("journalctl") {
+		app.writeError(w, r, http.StatusServiceUnavailable, "journalctl is not installed or not available")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.writeError(w, r, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	// A follow runs for as long as the client stays connected, so it bypasses the command
+	// slots rather than holding one indefinitely; the request context kills it on disconnect
+	cmd, err := safeExecContext(r.Context(), "journalctl", "-u", unit, "-f", "-o", "json", "--no-pager")
+	if err != nil {
+		app.writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		app.writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		app.writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to start journalctl: %v", err))
+		return
+	}
+	defer cmd.Wait()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	entries := make(chan string)
+	go func() {
+		defer close(entries)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			select {
+			case entries <- scanner.Text():
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case entry, ok := <-entries:
+			if !ok {
+				fmt.Fprint(w, "event: end\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			writeJournalEvent(w, entry)
+			flusher.Flush()
+		}
+	}
+}
+
+// writeJournalEvent forwards one "journalctl -o json" line, which is already a JSON object
+func writeJournalEvent(w io.Writer, line string) {
+	if !json.Valid([]byte(line)) {
+		return
+	}
+	fmt.Fprintf(w, "event: log\ndata: %s\n\n", line)
+}
+
+func (app *App) getProcessesByUserHandler(w http.ResponseWriter, r *http.Request) {
+	processes, _, _, err := app.gatherProcesses(r.Context())
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	users, usageAvailable := groupProcessesByUser(processes)
+	response := map[string]interface{}{
+		"users":           users,
+		"usage_available": usageAvailable,
+	}
+	if !usageAvailable {
+		response["note"] = "CPU and memory usage are unavailable because the process list came from ps -ef"
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (app *App) snapshotProcessesHandler(w http.ResponseWriter, r *http.Request) {
+	processes, _, _, err := app.gatherProcesses(r.Context())
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	app.mu.Lock()
+	app.baseline = processes
+	app.baselineAt = now
+	app.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":      "success",
+		"captured_at": now.Format(time.RFC3339),
+		"processes":   len(processes),
+	})
+}
+
+func (app *App) getProcessDiffHandler(w http.ResponseWriter, r *http.Request) {
+	app.mu.RLock()
+	baseline, baselineAt := app.baseline, app.baselineAt
+	app.mu.RUnlock()
+	if baseline == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "No baseline snapshot has been captured; POST /api/processes/snapshot first"})
+		return
+	}
+
+	processes, _, _, err := app.gatherProcesses(r.Context())
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Kernel worker names change with whatever they're running, which would swamp the diff
+	if r.URL.Query().Get("kernel") != "true" {
+		baseline, processes = filterKernelThreads(baseline), filterKernelThreads(processes)
+	}
+
+	diff := diffProcesses(baseline, processes)
+	diff.BaselineAt = baselineAt.Format(time.RFC3339)
+	writeJSON(w, http.StatusOK, diff)
+}
+
+// processChangeThreshold is how many percentage points CPU or memory must move to count as changed
+const processChangeThreshold = 5.0
+
+// diffProcesses matches processes by PID and name, so a reused PID shows up as one process
+// exiting and another starting
+func diffProcesses(before, after []Process) ProcessDiff {
+	type processKey struct {
+		pid  int
+		name string
+	}
+	previous := make(map[processKey]Process, len(before))
+	for _, process := range before {
+		previous[processKey{process.PID, process.Name}] = process
+	}
+
+	diff := ProcessDiff{Started: []Process{}, Exited: []Process{}, Changed: []ProcessChange{}}
+	seen := make(map[processKey]bool, len(after))
+	for _, process := range after {
+		key := processKey{process.PID, process.Name}
+		seen[key] = true
+		old, ok := previous[key]
+		if !ok {
+			diff.Started = append(diff.Started, process)
+			continue
+		}
+		change := ProcessChange{
+			PID:          process.PID,
+			Name:         process.Name,
+			CPUBefore:    parsePercent(old.CPU),
+			CPUAfter:     parsePercent(process.CPU),
+			MemoryBefore: parsePercent(old.Memory),
+			MemoryAfter:  parsePercent(process.Memory),
+		}
+		if math.Abs(change.CPUAfter-change.CPUBefore) >= processChangeThreshold ||
+			math.Abs(change.MemoryAfter-change.MemoryBefore) >= processChangeThreshold {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for _, process := range before {
+		if !seen[processKey{process.PID, process.Name}] {
+			diff.Exited = append(diff.Exited, process)
+		}
+	}
+	return diff
+}
+
+func (app *App) getProcessDetailHandler(w http.ResponseWriter, r *http.Request) {
+	if runtime.GOOS != "linux" || !procAvailable() {
+		writeProcUnavailable(w)
+		return
+	}
+
+	pid, err := strconv.Atoi(mux.Vars(r)["pid"])
+	if err != nil || pid <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "pid must be a positive integer"})
+		return
+	}
+
+	detail, err := readProcessDetail(pid)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if os.IsNotExist(err) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, detail)
+}
+
+func (app *App) getProcessSocketsHandler(w http.ResponseWriter, r *http.Request) {
+	if runtime.GOOS != "linux" || !procAvailable() {
+		writeProcUnavailable(w)
+		return
+	}
+
+	pid, err := strconv.Atoi(mux.Vars(r)["pid"])
+	if err != nil || pid <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "pid must be a positive integer"})
+		return
+	}
+
+	inodes, err := processSocketInodes(pid)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case os.IsNotExist(err):
+			status = http.StatusNotFound
+		case os.IsPermission(err):
+			status = http.StatusForbidden
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	sockets := []ProcessSocket{}
+	for _, socket := range readProcNetSockets() {
+		if inodes[socket.Inode] {
+			sockets = append(sockets, socket)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, sockets)
+}
+
+func (app *App) getProcessesByPortHandler(w http.ResponseWriter, r *http.Request) {
+	if runtime.GOOS != "linux" || !procAvailable() {
+		writeProcUnavailable(w)
+		return
+	}
+
+	port, err := strconv.Atoi(mux.Vars(r)["port"])
+	if err != nil || port < 1 || port > 65535 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "port must be between 1 and 65535"})
+		return
+	}
+
+	inodes := socketInodesForPort(readProcNetSockets(), port)
+	pids := map[int]bool{}
+	if len(inodes) > 0 {
+		pids = pidsOwningInodes(inodes)
+	}
+
+	matches := []Process{}
+	if len(pids) > 0 {
+		processes, _, _, err := app.gatherProcesses(r.Context())
+		if errors.Is(err, errCommandBusy) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		for _, process := range processes {
+			if pids[process.PID] {
+				matches = append(matches, process)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, matches)
+}
+
+// protectedProcessNames can only be signalled by name with force, since killing them takes the device down
+var protectedProcessNames = map[string]bool{
+	"init":    true,
+	"systemd": true,
+	"sshd":    true,
+}
+
+var killSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+}
+
+func (app *App) killProcessesByNameHandler(w http.ResponseWriter, r *http.Request) {
+	var req KillByNameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if req.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+		return
+	}
+
+	if req.Signal == "" {
+		req.Signal = "TERM"
+	}
+	sig, ok := killSignals[strings.TrimPrefix(strings.ToUpper(req.Signal), "SIG")]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "signal must be one of: TERM, KILL, HUP, INT"})
+		return
+	}
+
+	if protectedProcessNames[filepath.Base(req.Name)] && !req.Force {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Refusing to signal critical process " + req.Name + " without force"})
+		return
+	}
+
+	processes, err := getProcesses(r.Context())
+	if errors.Is(err, errCommandBusy) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	results := []KillResult{}
+	for _, pid := range matchProcessesByName(processes, req.Name) {
+		result := KillResult{PID: pid, Status: "signalled"}
+		if err := signalProcess(pid, sig); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	log.Printf("Sent SIG%s to %d process(es) named %s", strings.TrimPrefix(strings.ToUpper(req.Signal), "SIG"), len(results), req.Name)
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (app *App) rebootHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if running on Windows or macOS (development machines)
+	if developmentMachine {
+		log.Printf("Reboot requested on %s (development machine) - logging action instead of rebooting", runtime.GOOS)
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status":  "logged",
+			"message": fmt.Sprintf("Reboot action logged for %s development machine", runtime.GOOS),
+		})
+		return
+	}
+
+	// For Linux systems, attempt to reboot
+	log.Printf("Reboot requested on %s system", runtime.GOOS)
+
+	if err := app.performReboot(); err != nil {
+		if errors.Is(err, errRebootNotPermitted) {
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error": errRebootNotPermitted.Error(),
+				"code":  "reboot_not_permitted",
+			})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "Failed to initiate reboot: " + err.Error(),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "System reboot initiated",
+	})
+}
+
+func (app *App) scheduleRebootHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		At           string `json:"at"`
+		DelayMinutes int    `json:"delay_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	var at time.Time
+	switch {
+	case req.At != "":
+		parsed, err := time.Parse(time.RFC3339, req.At)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "at must be an RFC3339 timestamp"})
+			return
+		}
+		at = parsed
+	case req.DelayMinutes > 0:
+		at = time.Now().Add(time.Duration(req.DelayMinutes) * time.Minute)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Either at or a positive delay_minutes is required"})
+		return
+	}
+
+	if !at.After(time.Now()) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Scheduled time must be in the future"})
+		return
+	}
+
+	if err := app.scheduleReboot(at); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Reboot scheduled for %s", at.Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, app.PendingReboot())
+}
+
+func (app *App) cancelRebootHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.cancelReboot() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "No reboot is scheduled"})
+		return
+	}
+
+	log.Printf("Scheduled reboot cancelled")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (app *App) selfRestartHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if running on Windows or macOS (development machines)
+	if developmentMachine {
+		log.Printf("Self-restart requested on %s (development machine) - logging action instead of restarting", runtime.GOOS)
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status":  "logged",
+			"message": fmt.Sprintf("Restart action logged for %s development machine", runtime.GOOS),
+		})
+		return
+	}
+
+	command, err := buildSelfRestartCommand(app.initSystem, app.serviceName)
+	if err != nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Printf("Self-restart requested, running %s", strings.Join(command, " "))
+
+	// Acknowledge before restarting, since the init system will stop this process
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "Service restart initiated",
+	})
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		if output, err := runCommand(command[0], command[1:]...); err != nil {
+			log.Printf("Failed to restart %s: %v (output: %s)", app.serviceName, err, string(output))
+		}
+	}()
+}
+
+func buildSelfRestartCommand(initSystem, serviceName string) ([]string, error) {
+	switch initSystem {
+	case "systemd":
+		return []string{"systemctl", "restart", serviceName}, nil
+	case "openrc":
+		return []string{"rc-service", serviceName, "restart"}, nil
+	case "sysv":
+		return []string{"service", serviceName, "restart"}, nil
+	}
+	return nil, fmt.Errorf("service restart is not supported with init system %q", initSystem)
+}
+
+var errRebootNotPermitted = errors.New("this service is not allowed to reboot the device; run it as root or grant it CAP_SYS_BOOT")
+
+func (app *App) performReboot() error {
+	// Save now; a successful reboot won't give the shutdown path a chance to
+	app.mu.Lock()
+	app.stats.RebootsRequested++
+	app.mu.Unlock()
+	app.saveStats()
+
+	var commands [][]string
+	// Use systemctl on systemd systems
+	if app.initSystem == "systemd" {
+		commands = append(commands, []string{"systemctl", "reboot", "-i"})
+	}
+	// Fallback to reboot command, then as a last resort shutdown -r now
+	commands = append(commands, []string{"reboot"}, []string{"shutdown", "-r", "now"})
+
+	effective, _ := readEffectiveCapabilities()
+	return rebootWithFallbacks(commands, runRebootCommand, resolveCapabilities(os.Geteuid(), effective).CanReboot)
+}
+
+// rebootWithFallbacks tries each command in turn. When every attempt fails on permissions, or
+// the process lacks the capability anyway, it reports errRebootNotPermitted instead of the last
+// command's generic failure.
+func rebootWithFallbacks(commands [][]string, run func(name string, args ...string) error, canReboot bool) error {
+	var lastErr error
+	allDenied := true
+	for _, command := range commands {
+		err := run(command[0], command[1:]...)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !isPermissionError(err) {
+			allDenied = false
+		}
+	}
+
+	if allDenied || !canReboot {
+		return fmt.Errorf("%w (last error: %v)", errRebootNotPermitted, lastErr)
+	}
+	return lastErr
+}
+
+func isPermissionError(err error) bool {
+	if errors.Is(err, os.ErrPermission) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "operation not permitted") ||
+		strings.Contains(message, "permission denied") ||
+		strings.Contains(message, "access denied") ||
+		strings.Contains(message, "interactive authentication required") ||
+		strings.Contains(message, "must be root") ||
+		strings.Contains(message, "must be superuser")
+}
+
+// detectInitSystem identifies the init system, checking paths relative to root
+func detectInitSystem(root string) string {
+	// sd_booted(3): systemd is running iff /run/systemd/system exists
+	if info, err := os.Stat(filepath.Join(root, "run", "systemd", "system")); err == nil && info.IsDir() {
+		return "systemd"
+	}
+	if _, err := os.Stat(filepath.Join(root, "run", "openrc")); err == nil {
+		return "openrc"
+	}
+	if _, err := os.Stat(filepath.Join(root, "sbin", "openrc-run")); err == nil {
+		return "openrc"
+	}
+	if info, err := os.Stat(filepath.Join(root, "etc", "init.d")); err == nil && info.IsDir() {
+		return "sysv"
+	}
+	return "unknown"
+}
+
+func runRebootCommand(name string, args ...string) error {
+	cmd, err := safeExec(name, args...)
+	if err != nil {
+		return err
+	}
+	// Keep the output, since it's the only place the permission failure is spelled out
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v (output: %s)", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func getNetworkInterfaces() ([]NetworkInterface, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []NetworkInterface
+	for _, iface := range interfaces {
+		// Skip loopback interfaces
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		ipAddrs, err := interfaceIPv4Addrs(iface)
+		if err != nil {
+			continue
+		}
+
+		status := "down"
+		if iface.Flags&net.FlagUp != 0 {
+			status = "up"
+		}
+
+		mac := iface.HardwareAddr.String()
+		result = append(result, NetworkInterface{
+			Name:    iface.Name,
+			IPAddrs: ipAddrs,
+			Status:  status,
+			Type:    classifyInterface(iface.Name, iface.Flags, sysClassNetPath),
+			MAC:     mac,
+			Vendor:  macVendor(mac),
+		})
+	}
+
+	return result, nil
+}
+
+// ouiVendors covers vendors commonly seen on ControlMate networks; it is not a full IEEE registry
+var ouiVendors = map[string]string{
+	"B827EB": "Raspberry Pi Foundation",
+	"DCA632": "Raspberry Pi Trading",
+	"E45F01": "Raspberry Pi Trading",
+	"28CDC1": "Raspberry Pi Trading",
+	"D83ADD": "Raspberry Pi Trading",
+	"000C29": "VMware",
+	"005056": "VMware",
+	"080027": "Oracle VirtualBox",
+	"525400": "QEMU/KVM",
+	"00155D": "Microsoft Hyper-V",
+	"001C42": "Parallels",
+	"00163E": "Xen",
+	"240AC4": "Espressif",
+	"30AEA4": "Espressif",
+	"84F3EB": "Espressif",
+	"001B21": "Intel",
+	"00E04C": "Realtek",
+	"00000C": "Cisco",
+	"00180A": "Cisco Meraki",
+	"000B86": "Aruba Networks",
+	"F81A67": "TP-Link",
+	"50C7BF": "TP-Link",
+	"FCECDA": "Ubiquiti",
+	"24A43C": "Ubiquiti",
+	"788A20": "Ubiquiti",
+	"802AA8": "Ubiquiti",
+	"000393": "Apple",
+	"001B63": "Apple",
+	"3C5AB4": "Google",
+	"F4F5D8": "Google",
+	"001788": "Philips Lighting",
+	"18B430": "Nest Labs",
+	"B8AC6F": "Dell",
+	"001422": "Dell",
+	"3CD92B": "Hewlett-Packard",
+	"00044B": "NVIDIA",
+	"48B02D": "NVIDIA",
+	"001132": "Synology",
+	"00089B": "QNAP",
+	"000DB9": "PC Engines",
+	"000732": "AAEON",
+	"0001C0": "CompuLab",
+	"0090E8": "Moxa",
+	"000ADC": "RuggedCom",
+	"0000BC": "Rockwell Automation",
+	"001D9C": "Rockwell Automation",
+	"000E8C": "Siemens",
+	"0030DE": "WAGO",
+	"00A045": "Phoenix Contact",
+	"0080F4": "Telemecanique",
+}
+
+// macVendor looks up the OUI (first three octets); unknown or malformed MACs return ""
+func macVendor(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) < 3 {
+		return ""
+	}
+	return ouiVendors[strings.ToUpper(hex.EncodeToString(hw[:3]))]
+}
+
+func getNeighbors() ([]Neighbor, error) {
+	data, err := os.ReadFile(procFile("net", "arp"))
+	if err != nil {
+		return nil, err
+	}
+	return parseProcNetARP(string(data)), nil
+}
+
+// parseProcNetARP parses /proc/net/arp, skipping incomplete entries
+func parseProcNetARP(content string) []Neighbor {
+	neighbors := []Neighbor{}
+
+	for i, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		// IP address, HW type, Flags, HW address, Mask, Device
+		if i == 0 || len(fields) < 6 {
+			continue
+		}
+		// Flags 0x0 means the entry never resolved
+		if fields[2] == "0x0" || fields[3] == "00:00:00:00:00:00" {
+			continue
+		}
+
+		neighbors = append(neighbors, Neighbor{
+			IP:        fields[0],
+			MAC:       fields[3],
+			Vendor:    macVendor(fields[3]),
+			Interface: fields[5],
+		})
+	}
+
+	return neighbors
+}
+
+const sysClassNetPath = "/sys/class/net"
+
+// classifyInterface guesses the interface kind from sysfs attributes, falling back to name heuristics
+func classifyInterface(name string, flags net.Flags, sysPath string) string {
+	if flags&net.FlagLoopback != 0 {
+		return "loopback"
+	}
+
+	if runtime.GOOS == "linux" {
+		dir := filepath.Join(sysPath, name)
+		if _, err := os.Stat(filepath.Join(dir, "wireless")); err == nil {
+			return "wifi"
+		}
+		if _, err := os.Stat(filepath.Join(dir, "bridge")); err == nil {
+			return "bridge"
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "type")); err == nil {
+			// ARPHRD_* values from linux/if_arp.h
+			switch strings.TrimSpace(string(data)) {
+			case "772":
+				return "loopback"
+			case "65534":
+				return "tun"
+			}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(name, "docker"):
+		return "docker"
+	case strings.HasPrefix(name, "veth"):
+		return "veth"
+	case strings.HasPrefix(name, "br"), strings.HasPrefix(name, "virbr"):
+		return "bridge"
+	case strings.HasPrefix(name, "tun"), strings.HasPrefix(name, "tap"), strings.HasPrefix(name, "wg"), strings.HasPrefix(name, "utun"):
+		return "tun"
+	case strings.HasPrefix(name, "wl"), strings.HasPrefix(name, "wifi"):
+		return "wifi"
+	case strings.HasPrefix(name, "eth"), strings.HasPrefix(name, "en"):
+		return "ethernet"
+	case strings.HasPrefix(name, "lo"):
+		return "loopback"
+	}
+
+	// Any remaining Linux interface with an Ethernet hardware type is most likely wired
+	if runtime.GOOS == "linux" {
+		if data, err := os.ReadFile(filepath.Join(sysPath, name, "type")); err == nil && strings.TrimSpace(string(data)) == "1" {
+			return "ethernet"
+		}
+	}
+
+	return "unknown"
+}
+
+func snapshotInterfaces(sysPath string) map[string]interfaceState {
+	states := map[string]interfaceState{}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return states
+	}
+
+	for _, iface := range interfaces {
+		status := "down"
+		if iface.Flags&net.FlagUp != 0 {
+			status = "up"
+		}
+		// carrier reads fail with EINVAL while the interface is administratively down
+		data, err := os.ReadFile(filepath.Join(sysPath, iface.Name, "carrier"))
+		carrier := err == nil && strings.TrimSpace(string(data)) == "1"
+		states[iface.Name] = interfaceState{status: status, carrier: carrier}
+	}
+	return states
+}
+
+func diffInterfaceStates(previous, current map[string]interfaceState, now time.Time) []InterfaceEvent {
+	var events []InterfaceEvent
+	timestamp := now.Format(time.RFC3339)
+
+	for name, state := range current {
+		if old, ok := previous[name]; !ok || old != state {
+			events = append(events, InterfaceEvent{Name: name, Status: state.status, Carrier: state.carrier, Time: timestamp})
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			events = append(events, InterfaceEvent{Name: name, Status: "removed", Time: timestamp})
+		}
+	}
+
+	// Map iteration order is random; keep events stable for clients
+	slices.SortFunc(events, func(a, b InterfaceEvent) int { return strings.Compare(a.Name, b.Name) })
+	return events
+}
+
+func interfaceTransition(previous, current map[string]interfaceState, event InterfaceEvent) InterfaceTransition {
+	describe := func(state interfaceState, ok bool) string {
+		switch {
+		case !ok:
+			return "absent"
+		case state.status == "up" && !state.carrier:
+			// Administratively up but no link, e.g. an unplugged cable
+			return "up (no carrier)"
+		}
+		return state.status
+	}
+
+	before, existed := previous[event.Name]
+	after, exists := current[event.Name]
+	to := describe(after, exists)
+	if !exists {
+		to = "removed"
+	}
+	return InterfaceTransition{
+		Interface: event.Name,
+		From:      describe(before, existed),
+		To:        to,
+		Time:      event.Time,
+	}
+}
+
+func readInterfaceErrorCounters(sysPath, name string) (InterfaceErrorCounters, error) {
+	var counters InterfaceErrorCounters
+	fields := map[string]*uint64{
+		"rx_errors":  &counters.RxErrors,
+		"tx_errors":  &counters.TxErrors,
+		"rx_dropped": &counters.RxDropped,
+		"tx_dropped": &counters.TxDropped,
+		"collisions": &counters.Collisions,
+	}
+
+	for file, value := range fields {
+		data, err := os.ReadFile(filepath.Join(sysPath, name, "statistics", file))
+		if err != nil {
+			return counters, fmt.Errorf("failed to read %s statistics: %v", name, err)
+		}
+		*value, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return counters, fmt.Errorf("failed to parse %s for %s: %v", file, name, err)
+		}
+	}
+
+	return counters, nil
+}
+
+type byteCounters struct {
+	rx, tx uint64
+}
+
+func readInterfaceByteCounters(sysPath, name string) (byteCounters, error) {
+	var counters byteCounters
+	for file, value := range map[string]*uint64{"rx_bytes": &counters.rx, "tx_bytes": &counters.tx} {
+		data, err := os.ReadFile(filepath.Join(sysPath, name, "statistics", file))
+		if err != nil {
+			return counters, fmt.Errorf("failed to read %s statistics: %v", name, err)
+		}
+		*value, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return counters, fmt.Errorf("failed to parse %s for %s: %v", file, name, err)
+		}
+	}
+	return counters, nil
+}
+
+// bandwidthRate converts two counter samples into bytes per second; a counter that went
+// backwards (driver reset or 32-bit wrap) reports zero for that sample instead of a huge spike
+func bandwidthRate(name string, previous, current byteCounters, elapsed time.Duration, now time.Time) InterfaceBandwidth {
+	rate := func(before, after uint64) float64 {
+		if after < before || elapsed <= 0 {
+			return 0
+		}
+		return float64(after-before) / elapsed.Seconds()
+	}
+	return InterfaceBandwidth{
+		Name:             name,
+		RxBytesPerSecond: rate(previous.rx, current.rx),
+		TxBytesPerSecond: rate(previous.tx, current.tx),
+		Time:             now.Format(time.RFC3339),
+	}
+}
+
+// diffInterfaceErrors treats a counter that went backwards (driver reset) as starting from zero
+func diffInterfaceErrors(previous, current InterfaceErrorCounters) InterfaceErrorCounters {
+	delta := func(before, after uint64) uint64 {
+		if after < before {
+			return after
+		}
+		return after - before
+	}
+
+	return InterfaceErrorCounters{
+		RxErrors:   delta(previous.RxErrors, current.RxErrors),
+		TxErrors:   delta(previous.TxErrors, current.TxErrors),
+		RxDropped:  delta(previous.RxDropped, current.RxDropped),
+		TxDropped:  delta(previous.TxDropped, current.TxDropped),
+		Collisions: delta(previous.Collisions, current.Collisions),
+	}
+}
+
+func interfaceIPv4Addrs(iface net.Interface) ([]string, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure ipAddrs is never nil - initialize as empty slice
+	ipAddrs := []string{}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			// Only include IPv4 addresses
+			if ipNet.IP.To4() != nil {
+				ipAddrs = append(ipAddrs, ipNet.IP.String())
+			}
+		}
+	}
+
+	return ipAddrs, nil
+}
+
+// deviceState returns NetworkManager's state name for a device, e.g. "connected" or "unmanaged"
+func deviceState(device string) (string, error) {
+	output, err := runCommand("nmcli", "-g", "GENERAL.STATE", "device", "show", device)
+	if err != nil {
+		return "", fmt.Errorf("failed to get state of %s: %v (output: %s)", device, err, strings.TrimSpace(string(output)))
+	}
+	return parseDeviceState(string(output)), nil
+}
+
+// parseDeviceState strips the numeric code from nmcli's "100 (connected)" form
+func parseDeviceState(output string) string {
+	state := strings.TrimSpace(output)
+	if open := strings.Index(state, "("); open >= 0 && strings.HasSuffix(state, ")") {
+		return state[open+1 : len(state)-1]
+	}
+	return state
+}
+
+// parseDeviceStates reads "nmcli -t -f DEVICE,STATE device status" into device -> state
+func parseDeviceStates(output string) map[string]string {
+	states := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		parts := splitNmcliFields(strings.TrimSpace(line))
+		if len(parts) >= 2 && parts[0] != "" {
+			states[parts[0]] = parts[1]
+		}
+	}
+	return states
+}
+
+func applyManagedStates(interfaces []NetworkInterface, states map[string]string) {
+	for i := range interfaces {
+		if state, ok := states[interfaces[i].Name]; ok {
+			managed := state != "unmanaged"
+			interfaces[i].Managed = &managed
+		}
+	}
+}
+
+func buildManagedArgs(device string, managed bool) []string {
+	value := "no"
+	if managed {
+		value = "yes"
+	}
+	return []string{"device", "set", device, "managed", value}
+}
+
+func activeConnection(device string) (string, error) {
+	output, err := runCommand("nmcli", "-g", "GENERAL.CONNECTION", "device", "show", device)
+	if err != nil {
+		return "", fmt.Errorf("failed to get active connection on %s: %v", device, err)
+	}
+	connection := strings.TrimSpace(string(output))
+	if connection == "" {
+		return "", fmt.Errorf("no active connection on %s", device)
+	}
+	return connection, nil
+}
+
+func getInterfaceIPv4Method(name string) (string, error) {
+	connection, err := activeConnection(name)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := runCommand("nmcli", "-g", "ipv4.method", "connection", "show", connection)
+	if err != nil {
+		return "", fmt.Errorf("failed to get IPv4 method for %s: %v", connection, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func validateDNSServers(servers []string) error {
+	for _, server := range servers {
+		// ipv4.dns only accepts IPv4 addresses
+		if ip := net.ParseIP(server); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid IPv4 DNS server: %s", server)
+		}
+	}
+	return nil
+}
+
+// buildDNSArgs pins the given servers, or reverts to DHCP-provided DNS when servers is empty
+func buildDNSArgs(connection string, servers []string) []string {
+	ignoreAuto := "no"
+	if len(servers) > 0 {
+		ignoreAuto = "yes"
+	}
+	return []string{"connection", "modify", "id", connection, "ipv4.dns", strings.Join(servers, ","), "ipv4.ignore-auto-dns", ignoreAuto}
+}
+
+func setInterfaceDNS(name string, servers []string) error {
+	connection, err := activeConnection(name)
+	if err != nil {
+		return err
+	}
+
+	if output, err := runCommand("nmcli", buildDNSArgs(connection, servers)...); err != nil {
+		return fmt.Errorf("failed to set DNS on %s: %v (output: %s)", connection, err, string(output))
+	}
+	if output, err := runCommand("nmcli", "device", "reapply", name); err != nil {
+		return fmt.Errorf("failed to reapply %s: %v (output: %s)", name, err, string(output))
+	}
+	return nil
+}
+
+func buildDHCPRenewCommands(name string, nmcli bool) [][]string {
+	if nmcli {
+		return [][]string{{"nmcli", "device", "reapply", name}}
+	}
+	return [][]string{{"dhclient", "-r", name}, {"dhclient", name}}
+}
+
+func renewDHCPLease(name string, nmcli bool) error {
+	for _, command := range buildDHCPRenewCommands(name, nmcli) {
+		output, err := runCommand(command[0], command[1:]...)
+		if err != nil {
+			// Fall back to dhclient if NetworkManager can't reapply the device
+			if nmcli {
+				return renewDHCPLease(name, false)
+			}
+			return fmt.Errorf("failed to renew DHCP lease on %s: %v (output: %s)", name, err, string(output))
+		}
+	}
+	return nil
+}
+
+// waitForIPv4 polls briefly for the interface to get an address after renewal
+func waitForIPv4(name string, timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for {
+		addrs := []string{}
+		if iface, err := net.InterfaceByName(name); err == nil {
+			if ipAddrs, err := interfaceIPv4Addrs(*iface); err == nil {
+				addrs = ipAddrs
+			}
+		}
+		if len(addrs) > 0 || time.Now().After(deadline) {
+			return addrs
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// buildScanArgs returns the nmcli rescan and list arguments, limited to device when one is given
+func buildScanArgs(device string) (rescan, list []string) {
+	rescan = []string{"device", "wifi", "rescan"}
+	list = []string{"-t", "-f", "SSID,SIGNAL,SECURITY,FREQ", "dev", "wifi", "list"}
+	if device != "" {
+		rescan = append(rescan, "ifname", device)
+		list = append(list, "ifname", device)
+	}
+	return rescan, list
+}
+
+// resolveScanDevice validates a requested scan interface, defaulting to the first WiFi device
+func resolveScanDevice(requested string, devices []string) (string, error) {
+	if requested == "" {
+		if len(devices) == 0 {
+			// Let nmcli pick; it may know about devices sysfs doesn't flag as wireless
+			return "", nil
+		}
+		return devices[0], nil
+	}
+	if !slices.Contains(devices, requested) {
+		return "", fmt.Errorf("%s is not a WiFi device", requested)
+	}
+	return requested, nil
+}
+
+func scanWiFiNetworks(ctx context.Context, device string) ([]WiFiNetwork, error) {
+	rescanArgs, listArgs := buildScanArgs(device)
+
+	// First, trigger a rescan to refresh the WiFi network list
+	output, err := runCommandContext(ctx, "nmcli", rescanArgs...)
+	if errors.Is(err, errCommandBusy) {
+		return nil, err
+	}
+	if err != nil && !isBenignRescanError(string(output)) {
+		return nil, fmt.Errorf("failed to rescan WiFi networks: %v (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+
+	// Wait 5 seconds for the rescan to complete
+	if err == nil {
+		time.Sleep(5 * time.Second)
+	}
+
+	// Now get the updated list of WiFi networks
+	output, err = runCommandOutput(ctx, "nmcli", listArgs...)
+	if err != nil {
+		if errors.Is(err, errCommandBusy) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan WiFi networks with nmcli: %v", err)
+	}
+
+	networks := parseNmcliOutput(string(output))
+
+	// Prefer the driver's real dBm; nmcli only exposes a percentage
+	if device != "" && commandAvailable("iw") {
+		if output, err := runCommandOutput(ctx, "iw", "dev", device, "scan", "dump"); err == nil {
+			applyIwSignals(networks, parseIwScanSignals(string(output)))
+		}
+	}
+
+	return networks, nil
+}
+
+// parseIwScanSignals maps each SSID in "iw dev <dev> scan dump" output to its strongest signal in dBm
+func parseIwScanSignals(output string) map[string]int {
+	signals := make(map[string]int)
+
+	var signal int
+	var haveSignal bool
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "BSS "):
+			haveSignal = false
+		case strings.HasPrefix(line, "signal:"):
+			// e.g. "signal: -54.00 dBm"
+			fields := strings.Fields(strings.TrimPrefix(line, "signal:"))
+			if len(fields) > 0 {
+				if value, err := strconv.ParseFloat(fields[0], 64); err == nil {
+					signal = int(math.Round(value))
+					haveSignal = true
+				}
+			}
+		case strings.HasPrefix(line, "SSID:") && haveSignal:
+			ssid := strings.TrimSpace(strings.TrimPrefix(line, "SSID:"))
+			if best, ok := signals[ssid]; !ok || signal > best {
+				signals[ssid] = signal
+			}
+		}
+	}
+
+	return signals
+}
+
+func applyIwSignals(networks []WiFiNetwork, signals map[string]int) {
+	for i := range networks {
+		if dbm, ok := signals[networks[i].SSID]; ok {
+			networks[i].SignalDBM = dbm
+		}
+	}
+}
+
+// isBenignRescanError reports whether a rescan failed only because a scan is already running,
+// in which case the existing results are still worth listing
+func isBenignRescanError(output string) bool {
+	output = strings.ToLower(output)
+	return strings.Contains(output, "scanning not allowed while already scanning") ||
+		strings.Contains(output, "already scanning")
+}
+
+func parseNmcliOutput(output string) []WiFiNetwork {
+	var networks []WiFiNetwork
+	lines := strings.Split(output, "\n")
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// nmcli -t output format: SSID:SIGNAL:SECURITY[:FREQ]
+		parts := strings.Split(line, ":")
+		if len(parts) >= 3 {
+			ssid := parts[0]
+			signal := parts[1]
+			security := parts[2]
+
+			var band string
+			if len(parts) >= 4 {
+				if fields := strings.Fields(parts[3]); len(fields) > 0 {
+					freq, _ := strconv.Atoi(fields[0])
+					band = frequencyToBand(freq)
+				}
+			}
+
+			// Skip empty SSIDs
+			if ssid == "" || ssid == "--" {
+				continue
+			}
+
+			// Normalize security type
+			normalizedSecurity := normalizeSecurityType(security)
+
+			level := parseSignalLevel(ssid, signal)
+			networks = append(networks, WiFiNetwork{
+				SSID:        ssid,
+				Signal:      strconv.Itoa(level) + "%",
+				Security:    normalizedSecurity,
+				Band:        band,
+				SignalDBM:   signalPercentToDBM(level),
+				SignalLevel: level,
+			})
+		}
+	}
+
+	return networks
+}
+
+// filterNetworks keeps networks matching the security class ("secured", "open" or "all")
+// with a signal of at least minSignal percent
+func filterNetworks(networks []WiFiNetwork, security string, minSignal int) []WiFiNetwork {
+	if security == "all" && minSignal <= 0 {
+		return networks
+	}
+
+	filtered := []WiFiNetwork{}
+	for _, network := range networks {
+		isOpen := network.Security == "Open"
+		if security == "secured" && isOpen || security == "open" && !isOpen {
+			continue
+		}
+		if minSignal > 0 && signalPercent(network.Signal) < minSignal {
+			continue
+		}
+		filtered = append(filtered, network)
+	}
+
+	return filtered
+}
+
+// filterNetworksByBand keeps networks on the given band ("2.4", "5", "6" or "all"); networks
+// whose frequency nmcli didn't report have no band and only appear under "all"
+func filterNetworksByBand(networks []WiFiNetwork, band string) []WiFiNetwork {
+	if band == "all" {
+		return networks
+	}
+
+	filtered := []WiFiNetwork{}
+	for _, network := range networks {
+		if network.Band == band+"GHz" {
+			filtered = append(filtered, network)
+		}
+	}
+	return filtered
+}
+
+// minWiFiAutoscanInterval keeps a misconfigured interval from scanning the radio nonstop
+const minWiFiAutoscanInterval = 10 * time.Second
+
+// wifiAutoscanInterval reads CM_WIFI_AUTOSCAN_INTERVAL (a duration such as "60s"); 0 disables autoscan
+func wifiAutoscanInterval() time.Duration {
+	value := os.Getenv("CM_WIFI_AUTOSCAN_INTERVAL")
+	if value == "" {
+		return 0
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Ignoring invalid CM_WIFI_AUTOSCAN_INTERVAL %q", value)
+		return 0
+	}
+	return max(interval, minWiFiAutoscanInterval)
+}
+
+// defaultScanDevice is the device a scan without ?ifname= uses
+func defaultScanDevice() string {
+	devices, _ := getWiFiDevices()
+	device, _ := resolveScanDevice("", devices)
+	return device
+}
+
+// autoscanWiFi refreshes the default device's scan cache every interval until ctx is done.
+// Scans are skipped while a connection attempt is running, since a rescan can disrupt association.
+func (app *App) autoscanWiFi(ctx context.Context, interval time.Duration, scan func(ctx context.Context, device string) ([]WiFiNetwork, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !app.Connecting() {
+			// Resolved each time so a radio that appears later gets picked up
+			device := defaultScanDevice()
+			if networks, err := scan(ctx, device); err == nil {
+				app.storeScan(device, networks, time.Now())
+			} else if ctx.Err() == nil && !errors.Is(err, errCommandBusy) {
+				log.Printf("Background WiFi scan failed: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cachedScan returns the background scanner's latest results for device, or nil when it has
+// none. The returned slice is a copy, so callers may filter it freely.
+func (app *App) cachedScan(device string) ([]WiFiNetwork, time.Time) {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	if app.scanCache == nil || app.scanCacheDevice != device {
+		return nil, time.Time{}
+	}
+	return slices.Clone(app.scanCache), app.scanCacheAt
+}
+
+func (app *App) storeScan(device string, networks []WiFiNetwork, at time.Time) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.scanCache = networks
+	app.scanCacheDevice = device
+	app.scanCacheAt = at
+}
+
+// beginConnect marks a connection attempt as in progress until the returned func is called
+func (app *App) beginConnect() func() {
+	app.mu.Lock()
+	app.connecting++
+	app.mu.Unlock()
+	return func() {
+		app.mu.Lock()
+		app.connecting--
+		app.mu.Unlock()
+	}
+}
+
+func (app *App) Connecting() bool {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.connecting > 0
+}
+
+// wifiScanLimit is the server-side cap on networks returned by a scan (CM_WIFI_SCAN_LIMIT); 0 means unlimited
+func wifiScanLimit() int {
+	limit, err := strconv.Atoi(os.Getenv("CM_WIFI_SCAN_LIMIT"))
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// strongestNetworks keeps the strongest limit networks, collapsing access points that share an
+// SSID and security type so one busy network can't crowd out the rest
+func strongestNetworks(networks []WiFiNetwork, limit int) []WiFiNetwork {
+	sorted := slices.Clone(networks)
+	slices.SortStableFunc(sorted, func(a, b WiFiNetwork) int {
+		return signalPercent(b.Signal) - signalPercent(a.Signal)
+	})
+
+	seen := map[string]bool{}
+	result := []WiFiNetwork{}
+	for _, network := range sorted {
+		key := network.SSID + "\x00" + network.Security
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, network)
+		if len(result) == limit {
+			break
+		}
+	}
+	return result
+}
+
+// parseSignalLevel turns nmcli's SIGNAL column into a percentage, clamping the occasional
+// malformed value (e.g. 142) into [0,100] so it can't reach the UI
+func parseSignalLevel(ssid, signal string) int {
+	level, err := strconv.Atoi(strings.TrimSpace(signal))
+	if err != nil {
+		log.Printf("Ignoring non-numeric WiFi signal %q for %s", signal, ssid)
+		return 0
+	}
+	if level < 0 || level > 100 {
+		log.Printf("Clamping out-of-range WiFi signal %d for %s", level, ssid)
+		return max(0, min(level, 100))
+	}
+	return level
+}
+
+func signalPercent(signal string) int {
+	percent, err := strconv.Atoi(strings.TrimSuffix(signal, "%"))
+	if err != nil {
+		return 0
+	}
+	return percent
+}
+
+func normalizeSecurityType(security string) string {
+	security = strings.ToUpper(security)
+	if strings.Contains(security, "WPA3") {
+		return "WPA3"
+	} else if strings.Contains(security, "WPA2") {
+		return "WPA2"
+	} else if strings.Contains(security, "WPA") {
+		return "WPA"
+	} else if strings.Contains(security, "WEP") {
+		return "WEP"
+	} else if security == "" || security == "--" {
+		return "Open"
+	}
+	return "Unknown"
+}
+
+// getCurrentWiFi checks the active connections first, which is cheap, and only then asks for
+// the active row's signal from the cached scan list instead of letting nmcli rescan
+func getCurrentWiFi() (*CurrentWiFi, error) {
+	output, err := runCommand("nmcli", "-t", "-f", "NAME,TYPE,DEVICE", "connection", "show", "--active")
+	if err != nil {
+		return getCurrentWiFiFromList()
+	}
+	active := parseActiveWirelessConnections(string(output))
+	if len(active) == 0 {
+		return &CurrentWiFi{Connected: false}, nil
+	}
+
+	args := []string{"-t", "-f", "ACTIVE,SSID,SIGNAL,SECURITY", "dev", "wifi", "list", "--rescan", "no"}
+	if len(active) == 1 {
+		args = append(args, "ifname", active[0].device)
+	}
+	current := &CurrentWiFi{Connected: true}
+	if listing, err := runCommandOutput(context.Background(), "nmcli", args...); err == nil {
+		if row := parseNmcliCurrentOutput(string(listing)); row.Connected {
+			current = row
+		}
+	}
+
+	device := active[0].device
+	if current.SSID == "" {
+		// The active row can be missing from the cache right after association, so ask the
+		// profile; its name needn't be the SSID
+		current.SSID = connectionSSID(active[0].name)
+	} else if len(active) > 1 {
+		for _, connection := range active {
+			if connectionSSID(connection.name) == current.SSID {
+				device = connection.device
+				break
+			}
+		}
+	}
+	applyWiFiAddresses(current, device)
+	return current, nil
+}
+
+// connectionSSID reads the SSID a wireless profile connects to, or "" if it can't be read
+func connectionSSID(name string) string {
+	output, err := runCommand("nmcli", "-g", "802-11-wireless.ssid", "connection", "show", "id", name)
+	if err != nil {
+		return ""
+	}
+	return splitNmcliFields(strings.TrimSpace(string(output)))[0]
+}
+
+// applyWiFiAddresses fills in the device's addresses; they stay empty until DHCP or SLAAC
+// has assigned one
+func applyWiFiAddresses(current *CurrentWiFi, device string) {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return
+	}
+	current.IPv4, current.IPv6 = primaryAddresses(addrs)
+}
+
+// primaryAddresses picks the first IPv4 address and the first IPv6 address, preferring a
+// global IPv6 address over a link-local one
+func primaryAddresses(addrs []net.Addr) (ipv4, ipv6 string) {
+	linkLocal := ""
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		switch {
+		case ipNet.IP.To4() != nil:
+			if ipv4 == "" {
+				ipv4 = ipNet.IP.String()
+			}
+		case ipNet.IP.IsLinkLocalUnicast():
+			if linkLocal == "" {
+				linkLocal = ipNet.IP.String()
+			}
+		default:
+			if ipv6 == "" {
+				ipv6 = ipNet.IP.String()
+			}
+		}
+	}
+	if ipv6 == "" {
+		ipv6 = linkLocal
+	}
+	return ipv4, ipv6
+}
+
+type activeWireless struct {
+	name, device string
+}
+
+// parseActiveWirelessConnections picks the wireless rows from "nmcli -t -f NAME,TYPE,DEVICE connection show --active"
+func parseActiveWirelessConnections(output string) []activeWireless {
+	var active []activeWireless
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := splitNmcliFields(line)
+		if len(parts) >= 3 && (parts[1] == "802-11-wireless" || parts[1] == "wifi") && parts[2] != "" {
+			active = append(active, activeWireless{name: parts[0], device: parts[2]})
+		}
+	}
+	return active
+}
+
+func getCurrentWiFiFromList() (*CurrentWiFi, error) {
+	// Get current WiFi connection using nmcli
+	output, err := runCommandOutput(context.Background(), "nmcli", "-t", "-f", "ACTIVE,SSID,SIGNAL,SECURITY", "dev", "wifi")
+	if errors.Is(err, errCommandBusy) {
+		return nil, err
+	}
+	if err != nil {
+		return &CurrentWiFi{Connected: false}, nil
+	}
+
+	current := parseNmcliCurrentOutput(string(output))
+	if current.Connected {
+		if device, err := getWiFiDevice(); err == nil {
+			applyWiFiAddresses(current, device)
+		}
+	}
+	return current, nil
+}
+
+// parseNmcliCurrentOutput returns the strongest active row, since devices with several
+// radios can have more than one active connection
+func parseNmcliCurrentOutput(output string) *CurrentWiFi {
+	var currentWiFi CurrentWiFi
+
+	for _, row := range parseNmcliActiveRows(output) {
+		if !currentWiFi.Connected || signalPercent(row.Signal) > signalPercent(currentWiFi.Signal) {
+			currentWiFi = row
+		}
+	}
+
+	return &currentWiFi
+}
+
+func parseNmcliActiveRows(output string) []CurrentWiFi {
+	rows := []CurrentWiFi{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// nmcli -t output format: ACTIVE:SSID:SIGNAL:SECURITY
+		parts := splitNmcliFields(line)
+		if len(parts) >= 4 {
+			active := parts[0]
+			ssid := parts[1]
+			signal := parts[2]
+			security := parts[3]
+
+			// Check if this is an active connection
+			if active == "yes" && ssid != "" && ssid != "--" {
+				level := parseSignalLevel(ssid, signal)
+				rows = append(rows, CurrentWiFi{
+					SSID:        ssid,
+					Signal:      strconv.Itoa(level) + "%",
+					SignalLevel: level,
+					Security:    normalizeSecurityType(security),
+					Connected:   true,
+				})
+			}
+		}
+	}
+
+	return rows
+}
+
+// getAllCurrentWiFi lists every active WiFi connection across all radios
+func getAllCurrentWiFi() ([]CurrentWiFi, error) {
+	output, err := runCommandOutput(context.Background(), "nmcli", "-t", "-f", "ACTIVE,SSID,SIGNAL,SECURITY", "dev", "wifi", "list", "--rescan", "no")
+	if errors.Is(err, errCommandBusy) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WiFi connections with nmcli: %v", err)
+	}
+
+	return parseNmcliActiveRows(string(output)), nil
+}
+
+const sysClassRfkillPath = "/sys/class/rfkill"
+
+// RfkillState aggregates the block state of every WiFi radio
+type RfkillState struct {
+	Soft bool
+	Hard bool
+}
+
+func (s RfkillState) Blocked() bool {
+	return s.Soft || s.Hard
+}
+
+// readWiFiRfkill reports whether any wlan rfkill switch is blocked; systems without rfkill
+// in sysfs report unblocked
+func readWiFiRfkill(base string) RfkillState {
+	var state RfkillState
+
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return state
+	}
+
+	read := func(name, file string) string {
+		data, err := os.ReadFile(filepath.Join(base, name, file))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if read(name, "type") != "wlan" {
+			continue
+		}
+		if read(name, "soft") == "1" {
+			state.Soft = true
+		}
+		if read(name, "hard") == "1" {
+			state.Hard = true
+		}
+	}
+	return state
+}
+
+// wifiAutoUnblock lets deployments have soft-blocked radios switched back on automatically
+func wifiAutoUnblock() bool {
+	switch strings.ToLower(os.Getenv("CM_WIFI_AUTO_UNBLOCK")) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// checkWiFiUnblocked writes a wifi_blocked error and returns false when rfkill blocks WiFi.
+// Soft blocks are lifted first when CM_WIFI_AUTO_UNBLOCK is set; hard blocks need the physical
+// switch.
+func checkWiFiUnblocked(w http.ResponseWriter) bool {
+	state := readWiFiRfkill(sysClassRfkillPath)
+	if state.Soft && !state.Hard && wifiAutoUnblock() {
+		if output, err := runCommand("nmcli", "radio", "wifi", "on"); err != nil {
+			log.Printf("Failed to unblock WiFi radio: %v (output: %s)", err, strings.TrimSpace(string(output)))
+		} else {
+			log.Printf("WiFi radio was soft-blocked, unblocked it")
+			state = readWiFiRfkill(sysClassRfkillPath)
+		}
+	}
+	if !state.Blocked() {
+		return true
+	}
+
+	message := "WiFi is blocked by software (rfkill); enable the WiFi radio to continue"
+	if state.Hard {
+		message = "WiFi is blocked by a hardware switch (rfkill); it can't be enabled from software"
+	}
+	writeJSON(w, http.StatusConflict, map[string]interface{}{
+		"error": message,
+		"code":  "wifi_blocked",
+		"soft":  state.Soft,
+		"hard":  state.Hard,
+	})
+	return false
+}
+
+func isWirelessInterface(name string) bool {
+	_, err := os.Stat(filepath.Join(sysClassNetPath, name, "wireless"))
+	return err == nil
+}
+
+// classifyWiFiError maps nmcli's free-form failures onto stable codes the UI can key off
+func classifyWiFiError(message string) string {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "secrets were required"), strings.Contains(message, "802-1x supplicant"), strings.Contains(message, "invalid password"):
+		return "auth_failed"
+	case strings.Contains(message, "no network with ssid"):
+		return "ssid_not_found"
+	case strings.Contains(message, "timeout"), strings.Contains(message, "timed out"), strings.Contains(message, "did not associate"):
+		return "timeout"
+	case strings.Contains(message, "no ipv4 address"), strings.Contains(message, "ip configuration could not be reserved"):
+		return "no_ip"
+	case strings.Contains(message, "lost carrier"):
+		return "carrier_lost"
+	}
+	return "unknown"
+}
+
+func getWiFiDevice() (string, error) {
+	devices, err := getWiFiDevices()
+	if err != nil {
+		return "", err
+	}
+	if len(devices) == 0 {
+		return "", fmt.Errorf("no WiFi device found")
+	}
+	return devices[0], nil
+}
+
+func getWiFiDevices() ([]string, error) {
+	// Wireless interfaces expose a "wireless" directory in sysfs
+	entries, err := os.ReadDir(sysClassNetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %v", err)
+	}
+
+	var devices []string
+	for _, entry := range entries {
+		if isWirelessInterface(entry.Name()) {
+			devices = append(devices, entry.Name())
+		}
+	}
+	return devices, nil
+}
+
+func getWiFiLink(iwAvailable bool) (*WiFiLink, error) {
+	if iwAvailable {
+		device, err := getWiFiDevice()
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := runCommandOutput(context.Background(), "iw", "dev", device, "link")
+		if errors.Is(err, errCommandBusy) {
+			return nil, err
+		}
+		if err == nil {
+			return parseIwLinkOutput(string(output)), nil
+		}
+	}
+
+	// Fallback to nmcli, which reports rate and frequency but not RX/TX separately
+	output, err := runCommandOutput(context.Background(), "nmcli", "-t", "-f", "ACTIVE,SSID,BSSID,FREQ,RATE,SIGNAL", "dev", "wifi")
+	if errors.Is(err, errCommandBusy) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WiFi link with nmcli: %v", err)
+	}
+
+	return parseNmcliLinkOutput(string(output)), nil
+}
+
+func parseIwLinkOutput(output string) *WiFiLink {
+	var link WiFiLink
+	lines := strings.Split(output, "\n")
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// First line: "Connected to aa:bb:cc:dd:ee:ff (on wlan0)" or "Not connected."
+		if strings.HasPrefix(line, "Connected to ") {
+			fields := strings.Fields(line)
+			if len(fields) >= 3 {
+				link.BSSID = fields[2]
+			}
+			link.Connected = true
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "SSID":
+			link.SSID = value
+		case "freq":
+			// Newer iw versions print fractional frequencies, e.g. "2437.0"
+			if freq, err := strconv.ParseFloat(value, 64); err == nil {
+				link.Freq = int(freq)
+				link.Channel = frequencyToChannel(link.Freq)
+			}
+		case "signal":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				link.SignalDBM, _ = strconv.Atoi(fields[0])
+			}
+		case "rx bitrate":
+			link.RxRate = bitrateValue(value)
+		case "tx bitrate":
+			link.TxRate = bitrateValue(value)
+		}
+	}
+
+	return &link
+}
+
+func bitrateValue(value string) string {
+	// "72.2 MBit/s MCS 7 short GI" -> "72.2 MBit/s"
+	fields := strings.Fields(value)
+	if len(fields) >= 2 {
+		return fields[0] + " " + fields[1]
+	}
+	return value
+}
+
+func parseNmcliLinkOutput(output string) *WiFiLink {
+	lines := strings.Split(output, "\n")
+	var link WiFiLink
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// nmcli -t output format: ACTIVE:SSID:BSSID:FREQ:RATE:SIGNAL (BSSID colons are escaped)
+		parts := splitNmcliFields(line)
+		if len(parts) < 6 || parts[0] != "yes" {
+			continue
+		}
+
+		link.Connected = true
+		link.SSID = parts[1]
+		link.BSSID = parts[2]
+		if fields := strings.Fields(parts[3]); len(fields) > 0 {
+			link.Freq, _ = strconv.Atoi(fields[0])
+			link.Channel = frequencyToChannel(link.Freq)
+		}
+		link.RxRate = parts[4]
+		link.TxRate = parts[4]
+		if signal, err := strconv.Atoi(parts[5]); err == nil {
+			link.SignalDBM = signalPercentToDBM(signal)
+		}
+		break
+	}
+
+	return &link
+}
+
+// splitNmcliFields splits a terse nmcli line on unescaped colons
+func splitNmcliFields(line string) []string {
+	var fields []string
+	var current strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case line[i] == ':':
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(line[i])
+		}
+	}
+
+	return append(fields, current.String())
+}
+
+func signalPercentToDBM(percent int) int {
+	// NetworkManager maps -100 dBm to 0% and -50 dBm to 100%
+	return percent/2 - 100
+}
+
+func frequencyToBand(freq int) string {
+	switch {
+	case freq >= 2400 && freq < 2500:
+		return "2.4GHz"
+	case freq >= 5925 && freq <= 7125:
+		return "6GHz"
+	case freq >= 5000 && freq < 5925:
+		return "5GHz"
+	}
+	return ""
+}
+
+func summarizeScan(networks []WiFiNetwork, duration time.Duration) WiFiScanMeta {
+	meta := WiFiScanMeta{
+		DurationMs: duration.Milliseconds(),
+		APCount:    len(networks),
+		Bands:      map[string]int{},
+		Security:   map[string]int{},
+	}
+
+	for _, network := range networks {
+		band := network.Band
+		if band == "" {
+			band = "unknown"
+		}
+		meta.Bands[band]++
+		meta.Security[network.Security]++
+	}
+
+	return meta
+}
+
+func frequencyToChannel(freq int) int {
+	switch {
+	case freq == 2484:
+		return 14
+	case freq >= 2412 && freq <= 2472:
+		return (freq - 2407) / 5
+	case freq >= 5955 && freq <= 7115:
+		return (freq - 5950) / 5
+	case freq >= 5000 && freq <= 5900:
+		return (freq - 5000) / 5
+	}
+	return 0
+}
+
+func connectToWiFi(req ConnectionRequest) error {
+	if req.CloneMAC != "" {
+		return connectWithClonedMAC(req)
+	}
+
+	if req.Security == "WEP" {
+		if err := connectToWEP(req); err != nil {
+			return err
+		}
+	} else {
+		args, err := buildConnectArgs(req.SSID, req.Password, req.Security, req.BSSID)
+		if err != nil {
+			return err
+		}
+
+		output, err := runCommand("nmcli", args...)
+		if errors.Is(err, errCommandBusy) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to connect to WiFi network %s: %v (output: %s)", req.SSID, err, string(output))
+		}
+	}
+
+	return nil
+}
+
+// connectWithClonedMAC creates the profile with its cloned MAC already set, so the access point
+// never sees the real address. "dev wifi connect" can't set connection properties.
+func connectWithClonedMAC(req ConnectionRequest) error {
+	device, err := getWiFiDevice()
+	if err != nil {
+		return err
+	}
+	args, err := buildClonedMACConnectArgs(req, device)
+	if err != nil {
+		return err
+	}
+	return addAndActivateProfile(req.SSID, args)
+}
+
+func buildClonedMACConnectArgs(req ConnectionRequest, device string) ([]string, error) {
+	args, err := buildProvisionArgs(ProvisionRequest{SSID: req.SSID, Password: req.Password, Security: req.Security}, device)
+	if err != nil {
+		return nil, err
+	}
+	if req.BSSID != "" {
+		args = append(args, "802-11-wireless.bssid", req.BSSID)
+	}
+	return append(args, "802-11-wireless.cloned-mac-address", req.CloneMAC), nil
+}
+
+// validateConnectionRequest reports every invalid field of a connect request at once, or nil
+func validateConnectionRequest(req ConnectionRequest) *ValidationError {
+	var problems ValidationError
+
+	if req.SSID == "" {
+		problems.Add("ssid", "", "SSID is required")
+	}
+
+	if req.BSSID != "" && !macPattern.MatchString(req.BSSID) {
+		problems.Add("bssid", "", "Invalid BSSID format")
+	}
+
+	if req.CloneMAC != "" && !validCloneMAC(req.CloneMAC) {
+		problems.Add("clone_mac", "", "clone_mac must be a MAC address or one of: random, stable, permanent")
+	}
+
+	switch req.Security {
+	case "Open", "WEP", "WPA", "WPA2", "WPA3":
+	default:
+		problems.Add("security", "", fmt.Sprintf("Unsupported security type: %s", req.Security))
+	}
+
+	if err := validateWiFiPassword(req.Security, req.Password); err != nil {
+		problems.Add("password", "weak_password", err.Error())
+	}
+
+	return problems.OrNil()
+}
+
+// alreadyConnected reports whether a plain connect request names the network we're already on.
+// Requests pinning a BSSID or changing the MAC still reconnect, since they change the link.
+func alreadyConnected(req ConnectionRequest) bool {
+	if req.BSSID != "" || req.CloneMAC != "" {
+		return false
+	}
+	current, err := getCurrentWiFi()
+	return err == nil && current.Connected && current.SSID == req.SSID
+}
+
+type HealStepResult struct {
+	Step     string `json:"step"`
+	Error    string `json:"error,omitempty"`
+	Internet bool   `json:"internet"`
+}
+
+type healStep struct {
+	name string
+	run  func() error
+}
+
+const selfHealSettleTimeout = 15 * time.Second
+
+// buildWiFiHealSteps lists the fixes in order of disruption: reapplying keeps the association,
+// while a down/up cycle drops it
+func buildWiFiHealSteps(device, connection string) []healStep {
+	nmcli := func(args ...string) func() error {
+		return func() error {
+			if output, err := runCommand("nmcli", args...); err != nil {
+				return fmt.Errorf("nmcli %s failed: %v (output: %s)", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+			}
+			return nil
+		}
+	}
+	reconnect := nmcli("connection", "up", "id", connection)
+	return []healStep{
+		{name: "reapply", run: nmcli("device", "reapply", device)},
+		{name: "reconnect", run: func() error {
+			// A failed down is fine as long as the up succeeds
+			nmcli("connection", "down", "id", connection)()
+			return reconnect()
+		}},
+	}
+}
+
+// runHealSteps runs steps until online reports connectivity, returning the step that fixed it
+// ("" if none did) and what happened at each step attempted
+func runHealSteps(steps []healStep, online func() bool) (string, []HealStepResult) {
+	results := []HealStepResult{}
+	for _, step := range steps {
+		result := HealStepResult{Step: step.name}
+		if err := step.run(); err != nil {
+			result.Error = err.Error()
+		}
+		// Check even after an error; a partially applied step can still help
+		result.Internet = online()
+		results = append(results, result)
+		if result.Internet {
+			return step.name, results
+		}
+	}
+	return "", results
+}
+
+func waitForConnectivity(check func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if check() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// connectStages are the checks connect-verify runs once nmcli has accepted the connection
+type connectStages struct {
+	currentSSID func() (ssid string, connected bool)
+	addresses   func(timeout time.Duration) []string
+	internet    func() bool
+}
+
+// wifiConnectStages checks the first WiFi device; tests swap it for canned stages
+var wifiConnectStages = connectStages{
+	currentSSID: func() (string, bool) {
+		current, err := getCurrentWiFi()
+		if err != nil || !current.Connected {
+			return "", false
+		}
+		return current.SSID, true
+	},
+	addresses: func(timeout time.Duration) []string {
+		device, err := getWiFiDevice()
+		if err != nil {
+			return []string{}
+		}
+		return waitForIPv4(device, timeout)
+	},
+	internet: func() bool {
+		device, err := getWiFiDevice()
+		return err == nil && checkNetworkConnectivityVia(device)
+	},
+}
+
+// verifyWiFiConnection waits for association with ssid and a DHCP lease, then checks internet
+// access through the WiFi device. Joining without internet (e.g. a captive portal) still reports
+// connected; landing on a different network (NetworkManager falling back to another saved
+// profile) does not.
+func verifyWiFiConnection(ssid string, timeout time.Duration, stages connectStages) map[string]interface{} {
+	result := map[string]interface{}{
+		"connected":    false,
+		"has_ip":       false,
+		"internet":     false,
+		"ip_addresses": []string{},
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if current, connected := stages.currentSSID(); connected {
+			result["ssid"] = current
+			if current == ssid {
+				result["connected"] = true
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			return result
+		}
+		time.Sleep(time.Second)
+	}
+
+	addrs := stages.addresses(time.Until(deadline))
+	result["ip_addresses"] = addrs
+	result["has_ip"] = len(addrs) > 0
+	if len(addrs) == 0 {
+		return result
+	}
+
+	result["internet"] = stages.internet()
+	return result
+}
+
+// maxWEPPassphraseLength is the longest passphrase NetworkManager will hash into a WEP key
+const maxWEPPassphraseLength = 64
+
+// validateWiFiPassword checks key length rules up front, since nmcli's errors for them are cryptic
+func validateWiFiPassword(security, password string) error {
+	switch security {
+	case "WEP":
+		// Anything that isn't a raw key (see wepKeyType) is sent as a passphrase
+		if password == "" || len(password) > maxWEPPassphraseLength {
+			return fmt.Errorf("WEP key must be 5 or 13 characters, 10 or 26 hex digits, or a passphrase of up to %d characters", maxWEPPassphraseLength)
+		}
+	case "WPA", "WPA2", "WPA3":
+		if len(password) < 8 || len(password) > 63 {
+			return fmt.Errorf("%s password must be between 8 and 63 characters", security)
+		}
+	}
+	return nil
+}
+
+func validateProvisionRequest(req ProvisionRequest) error {
+	if req.SSID == "" || len(req.SSID) > 32 {
+		return fmt.Errorf("ssid must be between 1 and 32 bytes")
+	}
+
+	switch req.Security {
+	case "Open", "WEP", "WPA", "WPA2", "WPA3":
+	default:
+		return fmt.Errorf("unsupported security type: %s", req.Security)
+	}
+
+	if err := validateWiFiPassword(req.Security, req.Password); err != nil {
+		return err
+	}
+
+	if req.IPv4 != nil {
+		return validateStaticIPv4(*req.IPv4)
+	}
+	return nil
+}
+
+func validateStaticIPv4(config StaticIPv4Config) error {
+	ip, _, err := net.ParseCIDR(config.Address)
+	if err != nil || ip.To4() == nil {
+		return fmt.Errorf("ipv4.address must be an IPv4 address in CIDR notation, e.g. 192.168.1.10/24")
+	}
+	if config.Gateway != "" {
+		if gateway := net.ParseIP(config.Gateway); gateway == nil || gateway.To4() == nil {
+			return fmt.Errorf("ipv4.gateway must be an IPv4 address")
+		}
+	}
+	for _, server := range config.DNS {
+		if dns := net.ParseIP(server); dns == nil || dns.To4() == nil {
+			return fmt.Errorf("invalid ipv4.dns server: %s", server)
+		}
+	}
+	return nil
+}
+
+// buildProvisionArgs creates the wireless and IP settings of a profile in a single "connection add"
+func buildProvisionArgs(req ProvisionRequest, device string) ([]string, error) {
+	args := []string{"connection", "add", "type", "wifi", "con-name", req.SSID, "ifname", device, "ssid", req.SSID}
+
+	switch req.Security {
+	case "Open":
+	case "WEP":
+		args = append(args, "wifi-sec.key-mgmt", "none", "wifi-sec.wep-key-type", wepKeyType(req.Password), "wifi-sec.wep-key0", req.Password)
+	case "WPA", "WPA2":
+		args = append(args, "wifi-sec.key-mgmt", "wpa-psk", "wifi-sec.psk", req.Password)
+	case "WPA3":
+		args = append(args, "wifi-sec.key-mgmt", "sae", "wifi-sec.psk", req.Password)
+	default:
+		return nil, fmt.Errorf("unsupported security type: %s", req.Security)
+	}
+
+	if req.IPv4 != nil {
+		args = append(args, "ipv4.method", "manual", "ipv4.addresses", req.IPv4.Address)
+		if req.IPv4.Gateway != "" {
+			args = append(args, "ipv4.gateway", req.IPv4.Gateway)
+		}
+		if len(req.IPv4.DNS) > 0 {
+			args = append(args, "ipv4.dns", strings.Join(req.IPv4.DNS, " "))
+		}
+	}
+
+	return args, nil
+}
+
+// provisionWiFi adds the profile and activates it, deleting the profile again if activation
+// fails. Both go by UUID, since other profiles may share its name.
+func provisionWiFi(req ProvisionRequest, device string) error {
+	args, err := buildProvisionArgs(req, device)
+	if err != nil {
+		return err
+	}
+	return addAndActivateProfile(req.SSID, args)
+}
+
+func addAndActivateProfile(name string, addArgs []string) error {
+	// Replace any previous profile so repeated connects don't pile up same-name profiles
+	if exists, err := savedWiFiProfileExists(name); err == nil && exists {
+		runCommand("nmcli", "connection", "delete", "id", name)
+	}
+
+	output, err := runCommand("nmcli", addArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to create profile %s: %v (output: %s)", name, err, string(output))
+	}
+	uuid := parseAddedConnectionUUID(string(output))
+	if uuid == "" {
+		return fmt.Errorf("created profile %s but could not determine its UUID (output: %s)", name, strings.TrimSpace(string(output)))
+	}
+
+	output, err = runCommand("nmcli", "connection", "up", "uuid", uuid)
+	if err != nil {
+		if deleteOutput, deleteErr := runCommand("nmcli", "connection", "delete", "uuid", uuid); deleteErr != nil {
+			log.Printf("Failed to roll back profile %s (%s): %v (output: %s)", name, uuid, deleteErr, string(deleteOutput))
+		}
+		return fmt.Errorf("failed to activate %s, profile removed: %v (output: %s)", name, err, string(output))
+	}
+
+	return nil
+}
+
+var addedConnectionUUIDPattern = regexp.MustCompile(`\(([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\)`)
+
+// parseAddedConnectionUUID extracts the UUID from nmcli's
+// "Connection 'name' (uuid) successfully added." message
+func parseAddedConnectionUUID(output string) string {
+	if match := addedConnectionUUIDPattern.FindStringSubmatch(output); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func isHexKey(key string) bool {
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// wepKeyType returns NetworkManager's wep-key-type: 1 for a raw key (10/26 hex digits or
+// 5/13 ASCII characters), 2 for a passphrase that gets hashed into a key
+func wepKeyType(key string) string {
+	switch len(key) {
+	case 10, 26:
+		if isHexKey(key) {
+			return "1"
+		}
+	case 5, 13:
+		return "1"
+	}
+	return "2"
+}
+
+// buildWEPConnectionArgs creates a WEP profile explicitly, since "dev wifi connect" can't
+// tell hex keys from passphrases and fails on a lot of legacy gear
+func buildWEPConnectionArgs(ssid, key, bssid, device string) []string {
+	args := []string{"connection", "add", "type", "wifi", "con-name", ssid, "ifname", device, "ssid", ssid,
+		"wifi-sec.key-mgmt", "none", "wifi-sec.wep-key-type", wepKeyType(key), "wifi-sec.wep-key0", key}
+	if bssid != "" {
+		args = append(args, "802-11-wireless.bssid", bssid)
+	}
+	return args
+}
+
+func connectToWEP(req ConnectionRequest) error {
+	device, err := getWiFiDevice()
+	if err != nil {
+		return err
+	}
+
+	// Replace any previous profile so a corrected key takes effect
+	if exists, err := savedWiFiProfileExists(req.SSID); err == nil && exists {
+		runCommand("nmcli", "connection", "delete", "id", req.SSID)
+	}
+
+	if output, err := runCommand("nmcli", buildWEPConnectionArgs(req.SSID, req.Password, req.BSSID, device)...); err != nil {
+		return fmt.Errorf("failed to create WEP profile %s: %v (output: %s)", req.SSID, err, string(output))
+	}
+	if output, err := runCommand("nmcli", "connection", "up", "id", req.SSID); err != nil {
+		return fmt.Errorf("failed to connect to WiFi network %s: %v (output: %s)", req.SSID, err, string(output))
+	}
+	return nil
+}
+
+func buildConnectArgs(ssid, password, security, bssid string) ([]string, error) {
+	var args []string
+
+	switch security {
+	case "Open":
+		// Connect to open network
+		args = []string{"dev", "wifi", "connect", ssid}
+	case "WPA", "WPA2", "WPA3":
+		// Connect to WPA network
+		args = []string{"dev", "wifi", "connect", ssid, "password", password}
+	default:
+		return nil, fmt.Errorf("unsupported security type: %s", security)
+	}
+
+	// Pin the connection to a specific access point when requested
+	if bssid != "" {
+		args = append(args, "bssid", bssid)
+	}
+
+	return args, nil
+}
+
+func savedWiFiProfileExists(name string) (bool, error) {
+	output, err := runCommandOutput(context.Background(), "nmcli", "-t", "-f", "NAME,TYPE", "connection", "show")
+	if errors.Is(err, errCommandBusy) {
+		return false, err
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to list saved connections: %v", err)
+	}
+
+	for _, profile := range parseNmcliConnectionList(string(output)) {
+		if profile == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func parseNmcliConnectionList(output string) []string {
+	var profiles []string
+	lines := strings.Split(output, "\n")
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// nmcli -t output format: NAME:TYPE
+		sep := strings.LastIndex(line, ":")
+		if sep <= 0 {
+			continue
+		}
+		name := line[:sep]
+		connType := line[sep+1:]
+
+		// Only WiFi profiles
+		if connType == "802-11-wireless" || connType == "wifi" {
+			profiles = append(profiles, strings.ReplaceAll(name, "\\:", ":"))
+		}
+	}
+
+	return profiles
+}
+
+// validateKeyfile performs basic structural checks on a NetworkManager keyfile and returns its id
+func validateKeyfile(content string) (string, error) {
+	var section, id, connType string
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		if section != "connection" {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "id":
+			id = strings.TrimSpace(value)
+		case "type":
+			connType = strings.TrimSpace(value)
+		}
+	}
+
+	if id == "" || connType == "" {
+		return "", fmt.Errorf("keyfile must contain a [connection] section with id and type")
+	}
+	if connType != "wifi" && connType != "802-11-wireless" {
+		return "", fmt.Errorf("keyfile must be a wifi connection, got type %s", connType)
+	}
+	if strings.ContainsAny(id, "/\\") || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid connection id: %s", id)
+	}
+	return id, nil
+}
+
+var errKeyfileExists = errors.New("a connection profile with this id already exists")
+
+// importKeyfile installs a keyfile under its id, refusing to replace an existing profile
+func importKeyfile(dir, id string, data []byte) error {
+	// Stage to a temp file in the same directory so installing it is a single hard link
+	tmp, err := os.CreateTemp(dir, ".import-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// NetworkManager ignores keyfiles readable by other users
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set keyfile permissions: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyfile: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyfile: %v", err)
+	}
+
+	// A hard link fails if the target exists, so an existing profile can't be clobbered
+	// even if one appears between a check and the install
+	path := filepath.Join(dir, id+".nmconnection")
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return errKeyfileExists
+		}
+		return fmt.Errorf("failed to install keyfile: %v", err)
+	}
+
+	output, err := runCommand("nmcli", "connection", "load", path)
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to load connection %s: %v (output: %s)", id, err, string(output))
+	}
+	return nil
+}
+
+type wifiAutoconnect struct {
+	Name        string `json:"name"`
+	UUID        string `json:"uuid"`
+	Autoconnect bool   `json:"autoconnect"`
+}
+
+func listWiFiAutoconnect(ctx context.Context) ([]wifiAutoconnect, error) {
+	output, err := runCommandOutput(ctx, "nmcli", "-t", "-f", "NAME,UUID,TYPE,AUTOCONNECT", "connection", "show")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list saved connections: %v", err)
+	}
+	return parseWiFiAutoconnect(string(output)), nil
+}
+
+func parseWiFiAutoconnect(output string) []wifiAutoconnect {
+	profiles := []wifiAutoconnect{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// nmcli -t output format: NAME:UUID:TYPE:AUTOCONNECT
+		parts := splitNmcliFields(line)
+		if len(parts) < 4 || (parts[2] != "802-11-wireless" && parts[2] != "wifi") {
+			continue
+		}
+
+		profiles = append(profiles, wifiAutoconnect{
+			Name:        parts[0],
+			UUID:        parts[1],
+			Autoconnect: parts[3] == "yes",
+		})
+	}
+
+	return profiles
+}
+
+func listSavedWiFiConnections(ctx context.Context) ([]SavedConnection, error) {
+	output, err := runCommandOutput(ctx, "nmcli", "-t", "-f", "NAME,UUID,TYPE,TIMESTAMP", "connection", "show")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list saved connections: %v", err)
+	}
+
+	connections := parseSavedConnections(string(output))
+	for i := range connections {
+		// The bound interface isn't available from the list view, so ask per profile
+		if output, err := runCommandOutput(ctx, "nmcli", "-g", "connection.interface-name", "connection", "show", "uuid", connections[i].UUID); err == nil {
+			connections[i].InterfaceName = strings.TrimSpace(string(output))
+		}
+	}
+	return connections, nil
+}
+
+func parseSavedConnections(output string) []SavedConnection {
+	var connections []SavedConnection
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// nmcli -t output format: NAME:UUID:TYPE:TIMESTAMP
+		parts := splitNmcliFields(line)
+		if len(parts) < 4 || (parts[2] != "802-11-wireless" && parts[2] != "wifi") {
+			continue
+		}
+
+		timestamp, _ := strconv.ParseInt(parts[3], 10, 64)
+		connections = append(connections, SavedConnection{
+			Name:      parts[0],
+			UUID:      parts[1],
+			Timestamp: timestamp,
+		})
+	}
+
+	return connections
+}
+
+// orphanedConnections flags profiles that never connected or are bound to a missing device
+func orphanedConnections(connections []SavedConnection, deviceExists func(string) bool) []SavedConnection {
+	orphans := []SavedConnection{}
+	for _, connection := range connections {
+		switch {
+		case connection.InterfaceName != "" && !deviceExists(connection.InterfaceName):
+			connection.Reason = "device " + connection.InterfaceName + " no longer exists"
+		case connection.Timestamp == 0:
+			connection.Reason = "never successfully connected"
+		default:
+			continue
+		}
+		orphans = append(orphans, connection)
+	}
+	return orphans
+}
+
+func findOrphanedConnections(ctx context.Context) ([]SavedConnection, error) {
+	connections, err := listSavedWiFiConnections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return orphanedConnections(connections, func(name string) bool {
+		_, err := net.InterfaceByName(name)
+		return err == nil
+	}), nil
+}
+
+func buildClearSecretArgs(name string) []string {
+	// psk-flags 2 marks the secret as "not saved" so NetworkManager won't persist it again
+	return []string{"connection", "modify", name, "wifi-sec.psk", "", "wifi-sec.psk-flags", "2"}
+}
+
+func clearWiFiSecret(name string) error {
+	output, err := runCommand("nmcli", buildClearSecretArgs(name)...)
+	if errors.Is(err, errCommandBusy) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to clear secret for %s: %v (output: %s)", name, err, string(output))
+	}
+	return nil
+}
+
+func getProcesses(ctx context.Context) ([]Process, error) {
+	// Use ps command to get process information
+	// This is the most reliable cross-platform way to get process info
+	output, err := runCommandOutput(ctx, "ps", "aux")
+	if err != nil {
+		if errors.Is(err, errCommandBusy) {
+			return nil, err
+		}
+		// Fallback to ps -ef if ps aux fails
+		output, err = runCommandOutput(ctx, "ps", "-ef")
+		if err != nil {
+			if errors.Is(err, errCommandBusy) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to get process list: %v", err)
+		}
+		return parsePsEfOutput(string(output))
+	}
+
+	return parsePsAuxOutput(string(output))
+}
+
+func parsePsAuxOutput(output string) ([]Process, error) {
+	var processes []Process
+	lines := strings.Split(output, "\n")
+
+	for i, line := range lines {
+		if i == 0 || strings.TrimSpace(line) == "" {
+			continue // Skip header line and empty lines
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 11 {
+			continue
+		}
+
+		// ps aux format: USER PID %CPU %MEM VSZ RSS TTY STAT START TIME COMMAND
+		user := fields[0]
+		pidStr := fields[1]
+		cpu := fields[2]
+		mem := fields[3]
+		status := fields[7]
+		command := strings.Join(fields[10:], " ")
+
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			continue
+		}
+
+		// Extract process name from command
+		name := command
+		if spaceIndex := strings.Index(command, " "); spaceIndex > 0 {
+			name = command[:spaceIndex]
+		}
+
+		processes = append(processes, Process{
+			PID:        pid,
+			Name:       name,
+			Status:     status,
+			StatusText: processStatusText(status),
+			CPU:        cpu + "%",
+			Memory:     mem + "%",
+			User:       user,
+			Command:    command,
+		})
+	}
+
+	return processes, nil
+}
+
+func parsePsEfOutput(output string) ([]Process, error) {
+	var processes []Process
+	lines := strings.Split(output, "\n")
+
+	for i, line := range lines {
+		if i == 0 || strings.TrimSpace(line) == "" {
+			continue // Skip header line and empty lines
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+
+		// ps -ef format: UID PID PPID C STIME TTY TIME CMD
+		user := resolveUser(fields[0])
+		pidStr := fields[1]
+		command := strings.Join(fields[7:], " ")
+
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			continue
+		}
+
+		// Extract process name from command
+		name := command
+		if spaceIndex := strings.Index(command, " "); spaceIndex > 0 {
+			name = command[:spaceIndex]
+		}
+
+		processes = append(processes, Process{
+			PID:        pid,
+			Name:       name,
+			Status:     "R", // Running (default for ps -ef)
+			StatusText: processStatusText("R"),
+			CPU:        "0%",
+			Memory:     "0%",
+			User:       user,
+			Command:    command,
+		})
+	}
+
+	return processes, nil
+}
+
+// getKernelInfo reports uname(2) fields. Linux asks the kernel directly (uname_linux.go); other
+// platforms use uname(1) and, failing that, the OS name and hostname from the Go runtime.
+func getKernelInfo(ctx context.Context) KernelInfo {
+	if info, ok := unameKernelInfo(); ok {
+		return info
+	}
+
+	info := KernelInfo{}
+	if commandAvailable("uname") {
+		for flag, field := range map[string]*string{
+			"-s": &info.System,
+			"-r": &info.Release,
+			"-v": &info.Version,
+			"-m": &info.Machine,
+			"-n": &info.Hostname,
+		} {
+			if *field != "" {
+				continue
+			}
+			if output, err := runCommandOutput(ctx, "uname", flag); err == nil {
+				*field = strings.TrimSpace(string(output))
+			}
+		}
+	}
+
+	if info.System == "" {
+		info.System = runtime.GOOS
+	}
+	if info.Hostname == "" {
+		info.Hostname, _ = os.Hostname()
+	}
+	return info
+}
+
+// parseOSRelease reads the KEY=value lines of os-release, unquoting values
+func parseOSRelease(content string) map[string]string {
+	release := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
 		line = strings.TrimSpace(line)
-		if line == "" {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `"'`)
+		}
+		release[key] = value
+	}
+	return release
+}
+
+// queryPackages looks up package versions with whichever package manager the system has
+func queryPackages(ctx context.Context, names []string) (string, []PackageInfo, error) {
+	var manager string
+	var output []byte
+	var err error
+	switch {
+	case commandAvailable("dpkg-query"):
+		manager = "dpkg"
+		output, err = runCommandOutput(ctx, "dpkg-query", append([]string{"-W", "-f", "${Package}\t${Version}\t${db:Status-Status}\n", "--"}, names...)...)
+	case commandAvailable("rpm"):
+		manager = "rpm"
+		output, err = runCommandOutput(ctx, "rpm", append([]string{"-q", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\tinstalled\n", "--"}, names...)...)
+	default:
+		return "", nil, fmt.Errorf("no supported package manager (dpkg or rpm) found")
+	}
+
+	// Both tools exit non-zero when any package is missing but still report the others
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return "", nil, err
+	}
+
+	return manager, packageVersions(names, parsePackageQuery(string(output))), nil
+}
+
+// parsePackageQuery reads "name<TAB>version<TAB>status" lines; rpm's "package x is not installed"
+// lines have no tabs and are skipped
+func parsePackageQuery(output string) map[string]string {
+	versions := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		// dpkg keeps removed packages around as "config-files"
+		if len(fields) < 3 || fields[2] != "installed" {
+			continue
+		}
+		name, _, _ := strings.Cut(fields[0], ":") // drop dpkg's ":arch" qualifier
+		versions[name] = fields[1]
+	}
+	return versions
+}
+
+func packageVersions(names []string, versions map[string]string) []PackageInfo {
+	packages := make([]PackageInfo, len(names))
+	for i, name := range names {
+		packages[i] = PackageInfo{Name: name, Version: "not installed"}
+		if version, ok := versions[name]; ok {
+			packages[i] = PackageInfo{Name: name, Installed: true, Version: version}
+		}
+	}
+	return packages
+}
+
+const powerSupplyPath = "/sys/class/power_supply"
+
+// readPowerStatus summarizes power_supply sysfs entries; desktops with no battery, and
+// systems without sysfs, report an empty battery list
+func readPowerStatus(base string) PowerStatus {
+	status := PowerStatus{Batteries: []BatteryStatus{}}
+
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return status
+	}
+
+	read := func(name, file string) string {
+		data, err := os.ReadFile(filepath.Join(base, name, file))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	discharging := false
+	for _, entry := range entries {
+		name := entry.Name()
+		switch read(name, "type") {
+		case "Battery", "UPS":
+			// Peripheral batteries (mice, keyboards) don't power the device
+			if read(name, "scope") == "Device" {
+				continue
+			}
+			capacity, _ := strconv.Atoi(read(name, "capacity"))
+			battery := BatteryStatus{Name: name, Capacity: capacity, Status: read(name, "status")}
+			status.Batteries = append(status.Batteries, battery)
+			if battery.Status == "Discharging" {
+				discharging = true
+			}
+		case "Mains", "USB", "USB_C", "USB_PD":
+			online := read(name, "online") == "1"
+			if status.ACOnline == nil || online {
+				status.ACOnline = &online
+			}
+		}
+	}
+
+	status.HasBattery = len(status.Batteries) > 0
+	acOnline := status.ACOnline != nil && *status.ACOnline
+	status.OnBattery = status.HasBattery && (discharging || (status.ACOnline != nil && !acOnline))
+	return status
+}
+
+// checkRebootRequired only fails when needs-restarting couldn't get a command slot
+func checkRebootRequired(ctx context.Context, flagPath, pkgsPath string) (RebootRequired, error) {
+	result := RebootRequired{Packages: []string{}}
+
+	// Debian/Ubuntu drop a flag file (and optionally the triggering packages) after updates
+	if _, err := os.Stat(flagPath); err == nil {
+		result.Required = true
+		if data, err := os.ReadFile(pkgsPath); err == nil {
+			for _, pkg := range strings.Split(string(data), "\n") {
+				if pkg = strings.TrimSpace(pkg); pkg != "" && !slices.Contains(result.Packages, pkg) {
+					result.Packages = append(result.Packages, pkg)
+				}
+			}
+		}
+		return result, nil
+	}
+
+	// RHEL-like systems: needs-restarting -r exits 1 when a reboot is required
+	if commandAvailable("needs-restarting") {
+		var exitErr *exec.ExitError
+		_, err := runCommandOutput(ctx, "needs-restarting", "-r")
+		if errors.Is(err, errCommandBusy) {
+			return result, err
+		}
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			result.Required = true
+		}
+	}
+
+	return result, nil
+}
+
+// readThrottleCount sums the per-core thermal throttle event counters. ok is false on CPUs
+// that don't expose them (most ARM boards).
+func readThrottleCount(base string) (total uint64, ok bool) {
+	files, _ := filepath.Glob(filepath.Join(base, "cpu[0-9]*", "thermal_throttle", "core_throttle_count"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if count, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			total += count
+			ok = true
+		}
+	}
+	return total, ok
+}
+
+// sampleThrottling reports whether the throttle counters grew since the previous sample. The
+// counters are cumulative since boot, so the first sample only sets a baseline.
+func (app *App) sampleThrottling(count uint64, ok bool) bool {
+	if !ok {
+		return false
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	throttled := app.throttleSeen && count > app.throttleCount
+	app.throttleCount = count
+	app.throttleSeen = true
+	return throttled
+}
+
+func cpufreqDirs(base string) ([]string, error) {
+	dirs, err := filepath.Glob(filepath.Join(base, "cpu[0-9]*", "cpufreq"))
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("cpufreq is not available on this system")
+	}
+	return dirs, nil
+}
+
+func readCPUGovernors(base string) (*CPUGovernor, error) {
+	dirs, err := cpufreqDirs(base)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CPUGovernor{Governors: map[string]string{}, Available: []string{}}
+	for _, dir := range dirs {
+		cpu := filepath.Base(filepath.Dir(dir))
+
+		data, err := os.ReadFile(filepath.Join(dir, "scaling_governor"))
+		if err != nil {
+			continue
+		}
+		result.Governors[cpu] = strings.TrimSpace(string(data))
+
+		// Available governors are the same across cores, so read them once
+		if len(result.Available) == 0 {
+			if data, err := os.ReadFile(filepath.Join(dir, "scaling_available_governors")); err == nil {
+				result.Available = strings.Fields(string(data))
+			}
+		}
+	}
+
+	if len(result.Governors) == 0 {
+		return nil, fmt.Errorf("cpufreq is not available on this system")
+	}
+	return result, nil
+}
+
+func validateCPUGovernor(available []string, governor string) error {
+	if !slices.Contains(available, governor) {
+		return fmt.Errorf("Unsupported governor %q, available: %s", governor, strings.Join(available, ", "))
+	}
+	return nil
+}
+
+func writeCPUGovernor(base, governor string) error {
+	dirs, err := cpufreqDirs(base)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, "scaling_governor")
+		if err := os.WriteFile(path, []byte(governor), 0644); err != nil {
+			return fmt.Errorf("failed to set governor on %s: %v", filepath.Base(filepath.Dir(dir)), err)
+		}
+	}
+	return nil
+}
+
+func blockDeviceExists(base, device string) bool {
+	if device == "" || strings.ContainsAny(device, "/\\") || strings.HasPrefix(device, ".") {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(base, device))
+	return err == nil
+}
+
+func parseSmartctlOutput(device string, output []byte) (*DiskSmart, error) {
+	var parsed smartctlOutput
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse smartctl output: %v", err)
+	}
+
+	smart := &DiskSmart{Device: device, Health: "UNKNOWN"}
+	if parsed.SmartStatus != nil {
+		smart.Health = "FAILED"
+		if parsed.SmartStatus.Passed {
+			smart.Health = "PASSED"
+		}
+	}
+	if parsed.Temperature != nil {
+		smart.TemperatureC = &parsed.Temperature.Current
+	}
+	if parsed.PowerOnTime != nil {
+		smart.PowerOnHours = &parsed.PowerOnTime.Hours
+	}
+	for _, attr := range parsed.ATASmartAttributes.Table {
+		// Attribute 5 is Reallocated_Sector_Ct
+		if attr.ID == 5 {
+			value := attr.Raw.Value
+			smart.ReallocatedSectors = &value
+		}
+	}
+
+	return smart, nil
+}
+
+func getFirewallRules(ctx context.Context) (*FirewallRules, error) {
+	var lastErr error
+
+	if commandAvailable("nft") {
+		output, err := runCommandOutput(ctx, "nft", "list", "ruleset")
+		if err == nil {
+			return &FirewallRules{Source: "nft", Raw: string(output), Chains: parseNftRuleset(string(output))}, nil
+		}
+		lastErr = err
+	}
+
+	if commandAvailable("iptables-save") {
+		output, err := runCommandOutput(ctx, "iptables-save")
+		if err == nil {
+			return &FirewallRules{Source: "iptables", Raw: string(output), Chains: parseIptablesSave(string(output))}, nil
+		}
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to read firewall rules (are we running as root?): %v", lastErr)
+	}
+	return nil, fmt.Errorf("neither nft nor iptables-save is installed or available")
+}
+
+func parseIptablesSave(output string) []FirewallChain {
+	chains := []FirewallChain{}
+	index := map[string]int{}
+	var table string
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "*"):
+			table = line[1:]
+		case strings.HasPrefix(line, ":"):
+			// Chain declaration: ":INPUT ACCEPT [0:0]"
+			if fields := strings.Fields(line[1:]); len(fields) > 0 {
+				index[table+"/"+fields[0]] = len(chains)
+				chains = append(chains, FirewallChain{Table: table, Name: fields[0]})
+			}
+		case strings.HasPrefix(line, "-A "):
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			key := table + "/" + fields[1]
+			if _, ok := index[key]; !ok {
+				index[key] = len(chains)
+				chains = append(chains, FirewallChain{Table: table, Name: fields[1]})
+			}
+			chains[index[key]].Rules++
+		}
+	}
+
+	return chains
+}
+
+func parseNftRuleset(output string) []FirewallChain {
+	chains := []FirewallChain{}
+	var table string
+	current := -1
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == "table" && len(fields) >= 3:
+			// "table inet filter {"
+			table = fields[1] + " " + fields[2]
+		case fields[0] == "chain" && len(fields) >= 2:
+			chains = append(chains, FirewallChain{Table: table, Name: fields[1]})
+			current = len(chains) - 1
+		case line == "}":
+			current = -1
+		case current >= 0:
+			// Base chain declarations and policies are not rules
+			if fields[0] == "type" || fields[0] == "policy" {
+				continue
+			}
+			chains[current].Rules++
+		}
+	}
+
+	return chains
+}
+
+// buildRouterModeCommands returns the nft commands that forward LAN traffic out of WAN with NAT
+func buildRouterModeCommands(wan, lan string) [][]string {
+	return [][]string{
+		{"add", "table", "ip", routerTable},
+		{"add", "chain", "ip", routerTable, "postrouting", "{", "type", "nat", "hook", "postrouting", "priority", "100", ";", "}"},
+		{"add", "rule", "ip", routerTable, "postrouting", "oifname", wan, "masquerade"},
+		{"add", "chain", "ip", routerTable, "forward", "{", "type", "filter", "hook", "forward", "priority", "0", ";", "}"},
+		{"add", "rule", "ip", routerTable, "forward", "iifname", lan, "oifname", wan, "accept"},
+		{"add", "rule", "ip", routerTable, "forward", "iifname", wan, "oifname", lan, "ct", "state", "related,established", "accept"},
+	}
+}
+
+func buildRouterTeardownCommand() []string {
+	return []string{"delete", "table", "ip", routerTable}
+}
+
+func setIPForwarding(value string) error {
+	if err := os.WriteFile(procFile("sys", "net", "ipv4", "ip_forward"), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to set net.ipv4.ip_forward: %v", err)
+	}
+	return nil
+}
+
+func readIPForwarding() (string, error) {
+	data, err := os.ReadFile(procFile("sys", "net", "ipv4", "ip_forward"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read net.ipv4.ip_forward: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// routerModeState remembers the forwarding setting from before router mode, so disabling
+// doesn't break forwarding that Docker or another router setup relies on
+type routerModeState struct {
+	PreviousIPForward string `json:"previous_ip_forward"`
+}
+
+func (app *App) routerModeStateFile() string {
+	return filepath.Join(app.stateDir, "router-mode.json")
+}
+
+func enableRouterMode(statePath, wan, lan string) error {
+	// Only the first enable records the original value; re-enabling would otherwise record "1"
+	var state routerModeState
+	if err := loadJSONState(statePath, &state); err != nil {
+		previous, err := readIPForwarding()
+		if err != nil {
+			return err
+		}
+		if err := saveJSONState(statePath, routerModeState{PreviousIPForward: previous}); err != nil {
+			return err
+		}
+	}
+
+	// Start from a clean table so re-enabling with different interfaces doesn't stack rules
+	runCommand("nft", buildRouterTeardownCommand()...)
+
+	for _, args := range buildRouterModeCommands(wan, lan) {
+		if output, err := runCommand("nft", args...); err != nil {
+			runCommand("nft", buildRouterTeardownCommand()...)
+			return fmt.Errorf("failed to configure NAT: %v (output: %s)", err, string(output))
+		}
+	}
+
+	if err := setIPForwarding("1"); err != nil {
+		runCommand("nft", buildRouterTeardownCommand()...)
+		return err
+	}
+	return nil
+}
+
+func disableRouterMode(statePath string) error {
+	if output, err := runCommand("nft", buildRouterTeardownCommand()...); err != nil &&
+		!strings.Contains(string(output), "No such file or directory") {
+		return fmt.Errorf("failed to remove NAT rules: %v (output: %s)", err, string(output))
+	}
+
+	// Without a recorded state router mode was never enabled here, so forwarding isn't ours to change
+	var state routerModeState
+	if err := loadJSONState(statePath, &state); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to load router mode state, leaving ip_forward unchanged: %v", err)
+		}
+		return nil
+	}
+	if state.PreviousIPForward != "" {
+		if err := setIPForwarding(state.PreviousIPForward); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove router mode state: %v", err)
+	}
+	return nil
+}
+
+// diagnosticsResult is one archive entry produced by a diagnostics section
+type diagnosticsResult struct {
+	file   string
+	output []byte
+}
+
+// collectDiagnostics runs sections on a bounded pool, each under its own timeout, and delivers
+// every section's result (or its error) on the returned channel as it finishes
+func collectDiagnostics(ctx context.Context, sections []diagnosticsSection, timeout time.Duration) <-chan diagnosticsResult {
+	jobs := make(chan diagnosticsSection)
+	results := make(chan diagnosticsResult, len(sections))
+
+	var wg sync.WaitGroup
+	for range min(diagnosticsWorkers, len(sections)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for section := range jobs {
+				results <- runDiagnosticsSection(ctx, section, timeout)
+			}
+		}()
+	}
+
+	go func() {
+		for _, section := range sections {
+			jobs <- section
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+func runDiagnosticsSection(ctx context.Context, section diagnosticsSection, timeout time.Duration) diagnosticsResult {
+	sectionCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Run the collector separately so one that ignores its context still can't hold up the bundle
+	done := make(chan diagnosticsResult, 1)
+	go func() {
+		output, err := section.Collect(sectionCtx)
+		if err != nil {
+			output = fmt.Appendf(nil, "%v\n\n%s", err, output)
+			done <- diagnosticsResult{file: strings.TrimSuffix(section.File, ".txt") + ".error.txt", output: output}
+			return
+		}
+		done <- diagnosticsResult{file: section.File, output: output}
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-sectionCtx.Done():
+		return diagnosticsResult{
+			file:   strings.TrimSuffix(section.File, ".txt") + ".error.txt",
+			output: fmt.Appendf(nil, "section did not finish: %v\n", sectionCtx.Err()),
+		}
+	}
+}
+
+// writeDiagnosticsArchive streams a tar.gz of command outputs. A failed command produces a
+// <name>.error.txt entry instead, so one missing tool doesn't spoil the bundle.
+func writeDiagnosticsArchive(ctx context.Context, w io.Writer, sections []diagnosticsSection, timeout time.Duration) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	for result := range collectDiagnostics(ctx, sections, timeout) {
+		if err := writeTarEntry(tw, result.file, result.output, now); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeTarEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func buildIperfArgs(req IperfRequest, reverse bool) []string {
+	args := []string{"-c", req.Host, "-p", strconv.Itoa(req.Port), "-t", strconv.Itoa(req.Duration), "-J"}
+	if req.UDP {
+		args = append(args, "-u")
+	}
+	if reverse {
+		args = append(args, "-R")
+	}
+	return args
+}
+
+// runIperf measures upload, then download with a reverse-mode run against the same server
+func runIperf(ctx context.Context, req IperfRequest) (*IperfResult, error) {
+	result := &IperfResult{}
+
+	for _, reverse := range []bool{false, true} {
+		// iperf3 exits non-zero on failure but still explains why in its JSON
+		output, _ := runCommandOutput(ctx, "iperf3", buildIperfArgs(req, reverse)...)
+		parsed, err := parseIperfOutput(output)
+		if err != nil {
+			return nil, err
+		}
+
+		if reverse {
+			result.DownloadMbps = parsed.mbps
+		} else {
+			result.UploadMbps = parsed.mbps
+			result.Retransmits = parsed.retransmits
+			result.JitterMs = parsed.jitterMs
+		}
+	}
+
+	return result, nil
+}
+
+type iperfSummary struct {
+	mbps        float64
+	retransmits int
+	jitterMs    *float64
+}
+
+func parseIperfOutput(output []byte) (*iperfSummary, error) {
+	var parsed iperfOutput
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse iperf3 output: %v", err)
+	}
+	if parsed.Error != "" {
+		return nil, fmt.Errorf("iperf3: %s", parsed.Error)
+	}
+
+	summary := &iperfSummary{}
+	switch {
+	case parsed.End.SumReceived != nil:
+		// The receiver's figure is the throughput that actually made it across
+		summary.mbps = parsed.End.SumReceived.BitsPerSecond / 1e6
+	case parsed.End.Sum != nil:
+		summary.mbps = parsed.End.Sum.BitsPerSecond / 1e6
+	default:
+		return nil, fmt.Errorf("iperf3 output has no summary")
+	}
+
+	if parsed.End.SumSent != nil {
+		summary.retransmits = parsed.End.SumSent.Retransmits
+	}
+	// Only UDP tests have an overall sum, which is where jitter is reported
+	if parsed.End.Sum != nil {
+		jitter := parsed.End.Sum.JitterMs
+		summary.jitterMs = &jitter
+	}
+
+	summary.mbps = math.Round(summary.mbps*100) / 100
+	return summary, nil
+}
+
+type hostLookuper interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// pinnedResolver sends every query to server, bypassing resolv.conf
+func pinnedResolver(server string) hostLookuper {
+	address := net.JoinHostPort(server, "53")
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+func benchmarkDNS(ctx context.Context, servers []string, name string, newResolver func(string) hostLookuper) []DNSBenchmarkResult {
+	results := make([]DNSBenchmarkResult, len(servers))
+
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			lookupCtx, cancel := context.WithTimeout(ctx, dnsBenchmarkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			addresses, err := newResolver(server).LookupHost(lookupCtx, name)
+			result := DNSBenchmarkResult{
+				Server:    server,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			var dnsErr *net.DNSError
+			switch {
+			case errors.As(err, &dnsErr):
+				// DNSError names the resolv.conf server, not the one we pinned
+				result.Error = dnsErr.Err
+			case err != nil:
+				result.Error = err.Error()
+			default:
+				result.Success = true
+				result.Addresses = addresses
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+const resolvConfPath = "/etc/resolv.conf"
+
+// getResolverStatus asks systemd-resolved for the real upstreams, since resolv.conf
+// only points at its stub listener; without resolved, resolv.conf is the truth
+func getResolverStatus(ctx context.Context) (*ResolvedStatus, error) {
+	for _, command := range [][]string{
+		{"resolvectl", "status", "--no-pager"},
+		{"systemd-resolve", "--status", "--no-pager"},
+	} {
+		if !commandAvailable(command[0]) {
 			continue
 		}
+		output, err := runCommandOutput(ctx, command[0], command[1:]...)
+		if errors.Is(err, errCommandBusy) {
+			return nil, err
+		}
+		if err == nil {
+			status := parseResolvectlStatus(string(output))
+			status.Source = "systemd-resolved"
+			return status, nil
+		}
+	}
 
-		// nmcli -t output format: SSID:SIGNAL:SECURITY
-		parts := strings.Split(line, ":")
-		if len(parts) >= 3 {
-			ssid := parts[0]
-			signal := parts[1]
-			security := parts[2]
+	data, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return nil, fmt.Errorf("systemd-resolved is not running and %s is unreadable: %v", resolvConfPath, err)
+	}
+	return &ResolvedStatus{
+		Source:    "resolv.conf",
+		GlobalDNS: parseResolvConfNameservers(string(data)),
+		Links:     []ResolvedLink{},
+	}, nil
+}
 
-			// Skip empty SSIDs
-			if ssid == "" || ssid == "--" {
+// parseResolvectlStatus handles both resolvectl and the older systemd-resolve layout,
+// where server lists continue on indented lines without a key
+func parseResolvectlStatus(output string) *ResolvedStatus {
+	status := &ResolvedStatus{GlobalDNS: []string{}, Links: []ResolvedLink{}}
+
+	var link *ResolvedLink
+	var lastKey string
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+
+		if line == "Global" {
+			link, lastKey = nil, ""
+			continue
+		}
+		// e.g. "Link 2 (eth0)"
+		if strings.HasPrefix(line, "Link ") && strings.HasSuffix(line, ")") {
+			if open := strings.Index(line, "("); open >= 0 {
+				status.Links = append(status.Links, ResolvedLink{Interface: line[open+1 : len(line)-1], DNSServers: []string{}})
+				link = &status.Links[len(status.Links)-1]
+				lastKey = ""
 				continue
 			}
+		}
 
-			// Normalize security type
-			normalizedSecurity := normalizeSecurityType(security)
+		key, value, found := strings.Cut(line, ":")
+		// IPv6 servers contain colons too, so only treat known keys as keys
+		if !found || !resolvectlKeys[strings.TrimSpace(key)] {
+			key, value = lastKey, line
+		} else {
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			lastKey = key
+		}
 
-			networks = append(networks, WiFiNetwork{
-				SSID:     ssid,
-				Signal:   signal + "%",
-				Security: normalizedSecurity,
-			})
+		switch key {
+		case "DNS Servers":
+			if link != nil {
+				link.DNSServers = append(link.DNSServers, strings.Fields(value)...)
+			} else {
+				status.GlobalDNS = append(status.GlobalDNS, strings.Fields(value)...)
+			}
+		case "Current DNS Server":
+			if link != nil {
+				link.CurrentServer = value
+			}
+		case "DNS Domain":
+			if link != nil {
+				link.Domains = append(link.Domains, strings.Fields(value)...)
+			}
+		case "DNSSEC setting":
+			if link != nil {
+				link.DNSSEC = value
+			} else {
+				status.DNSSEC = value
+			}
+		case "Protocols":
+			// Newer resolvectl folds DNSSEC into the protocol list as "DNSSEC=no/unsupported"
+			for _, field := range strings.Fields(value) {
+				if mode, ok := strings.CutPrefix(field, "DNSSEC="); ok {
+					if link != nil {
+						link.DNSSEC = mode
+					} else {
+						status.DNSSEC = mode
+					}
+				}
+			}
 		}
 	}
 
-	return networks
+	return status
 }
 
-func normalizeSecurityType(security string) string {
-	security = strings.ToUpper(security)
-	if strings.Contains(security, "WPA3") {
-		return "WPA3"
-	} else if strings.Contains(security, "WPA2") {
-		return "WPA2"
-	} else if strings.Contains(security, "WPA") {
-		return "WPA"
-	} else if strings.Contains(security, "WEP") {
-		return "WEP"
-	} else if security == "" || security == "--" {
-		return "Open"
+var resolvectlKeys = map[string]bool{
+	"Protocols":            true,
+	"resolv.conf mode":     true,
+	"Current Scopes":       true,
+	"Current DNS Server":   true,
+	"DNS Servers":          true,
+	"Fallback DNS Servers": true,
+	"DNS Domain":           true,
+	"DNSSEC setting":       true,
+	"DNSSEC supported":     true,
+	"DefaultRoute setting": true,
+	"LLMNR setting":        true,
+	"MulticastDNS setting": true,
+	"DNSOverTLS setting":   true,
+	"DNSSEC NTA":           true,
+}
+
+func parseResolvConfNameservers(content string) []string {
+	servers := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// logDirs lists the directories /api/logs/file may read from, as a comma-separated CM_LOG_DIRS.
+// Nothing is readable until it is configured.
+func logDirs() []string {
+	var dirs []string
+	for _, dir := range strings.Split(os.Getenv("CM_LOG_DIRS"), ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, filepath.Clean(dir))
+		}
+	}
+	return dirs
+}
+
+var errLogPathNotAllowed = errors.New("path is outside the allowed log directories")
+
+// allowedLogPath resolves symlinks before checking the allowlist, so a link inside an
+// allowed directory can't point at an arbitrary file. A path that can't be resolved is
+// rejected; it only reads as missing when it lies inside an allowed directory, so the
+// response doesn't reveal whether files elsewhere exist.
+func allowedLogPath(path string, dirs []string) (string, error) {
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("no log directories are configured (set CM_LOG_DIRS)")
+	}
+	if path == "" || !filepath.IsAbs(path) || slices.Contains(strings.Split(path, "/"), "..") {
+		return "", fmt.Errorf("path must be an absolute path without '..'")
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if os.IsNotExist(err) && underLogDir(filepath.Clean(path), dirs) {
+			return "", fmt.Errorf("log file not found: %w", fs.ErrNotExist)
+		}
+		return "", errLogPathNotAllowed
+	}
+	if !underLogDir(resolved, dirs) {
+		return "", errLogPathNotAllowed
+	}
+	return resolved, nil
+}
+
+func underLogDir(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if realDir, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = realDir
+		}
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// openLogFile opens an allowed log file and then checks that the file it got is still the one
+// at the resolved path, so a symlink swapped in between the check and the open is refused
+func openLogFile(path string, dirs []string) (*os.File, string, error) {
+	resolved, err := allowedLogPath(path, dirs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := os.Open(resolved)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", fmt.Errorf("log file not found: %w", fs.ErrNotExist)
+		}
+		return nil, "", errLogPathNotAllowed
+	}
+
+	opened, err := file.Stat()
+	if err == nil {
+		var current os.FileInfo
+		if current, err = os.Lstat(resolved); err == nil && !os.SameFile(opened, current) {
+			err = errLogPathNotAllowed
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, "", errLogPathNotAllowed
+	}
+	if !opened.Mode().IsRegular() {
+		file.Close()
+		return nil, "", fmt.Errorf("%s is not a regular file", resolved)
+	}
+	return file, resolved, nil
+}
+
+// tailFile returns up to n trailing lines, reading backwards so large logs aren't loaded whole
+func tailFile(file *os.File, n int) ([]string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 4096
+	size := info.Size()
+	offset := size
+	var data []byte
+	for offset > 0 && bytes.Count(data, []byte("\n")) <= n && size-offset < maxLogTailBytes {
+		readSize := min(int64(chunkSize), offset)
+		offset -= readSize
+		chunk := make([]byte, readSize)
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		data = append(chunk, data...)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	// The first line is partial unless we reached the start of the file
+	if offset > 0 && len(lines) > 0 {
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		lines = []string{}
+	}
+	return lines, nil
+}
+
+// lookupPublicIP asks an IP-echo service which address our traffic leaves from. The service
+// may answer with the bare address or a JSON object with an "ip" field.
+func lookupPublicIP(ctx context.Context, serviceURL string) (*PublicIP, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serviceURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public IP service URL: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach public IP service %s (is the device offline?): %v", serviceURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("public IP service %s returned %s", serviceURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public IP response: %v", err)
+	}
+
+	value := strings.TrimSpace(string(body))
+	if strings.HasPrefix(value, "{") {
+		var payload struct {
+			IP string `json:"ip"`
+		}
+		if err := json.Unmarshal(body, &payload); err == nil {
+			value = payload.IP
+		}
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("public IP service %s returned an invalid address", serviceURL)
+	}
+
+	family := "ipv6"
+	if ip.To4() != nil {
+		family = "ipv4"
+	}
+	now := time.Now()
+	return &PublicIP{
+		IP:        ip.String(),
+		Family:    family,
+		Source:    serviceURL,
+		CheckedAt: now.Format(time.RFC3339),
+		checked:   now,
+	}, nil
+}
+
+func getAuthFailures(ctx context.Context, lines int) ([]AuthFailure, error) {
+	// Prefer the journal, covering both Debian (ssh) and RHEL (sshd) unit names
+	if commandAvailable("journalctl") {
+		output, err := runCommandOutput(ctx, "journalctl", "-u", "ssh", "-u", "sshd", "--grep", "Failed password",
+			"-n", strconv.Itoa(lines), "--no-pager", "-o", "short-iso")
+		if errors.Is(err, errCommandBusy) {
+			return nil, err
+		}
+		if err == nil {
+			return parseAuthFailures(string(output)), nil
+		}
+	}
+
+	// Fallback to the traditional syslog auth file
+	data, err := os.ReadFile("/var/log/auth.log")
+	if err != nil {
+		return nil, fmt.Errorf("no authentication log source available")
+	}
+
+	failures := parseAuthFailures(string(data))
+	if len(failures) > lines {
+		failures = failures[len(failures)-lines:]
+	}
+	return failures, nil
+}
+
+func parseAuthFailures(output string) []AuthFailure {
+	failures := []AuthFailure{}
+	lines := strings.Split(output, "\n")
+
+	for _, line := range lines {
+		// e.g. "Jan  2 10:00:00 host sshd[123]: Failed password for invalid user admin from 2001:db8::1 port 22 ssh2"
+		marker := strings.Index(line, "Failed password for ")
+		if marker < 0 {
+			continue
+		}
+
+		rest := line[marker+len("Failed password for "):]
+		rest = strings.TrimPrefix(rest, "invalid user ")
+		user, rest, found := strings.Cut(rest, " from ")
+		if !found {
+			continue
+		}
+		sourceIP, _, _ := strings.Cut(rest, " ")
+
+		// The timestamp is everything before the hostname that precedes the sshd tag
+		var timestamp string
+		if sshd := strings.Index(line, " sshd"); sshd > 0 {
+			prefix := strings.Fields(line[:sshd])
+			if len(prefix) > 1 {
+				timestamp = strings.Join(prefix[:len(prefix)-1], " ")
+			}
+		}
+
+		failures = append(failures, AuthFailure{
+			Timestamp: timestamp,
+			User:      user,
+			SourceIP:  sourceIP,
+		})
+	}
+
+	return failures
+}
+
+// matchProcessesByName returns PIDs whose name, or its base name, exactly equals name
+func matchProcessesByName(processes []Process, name string) []int {
+	var pids []int
+	self := os.Getpid()
+
+	for _, process := range processes {
+		if process.PID == self {
+			continue
+		}
+		if process.Name == name || filepath.Base(process.Name) == name {
+			pids = append(pids, process.PID)
+		}
+	}
+
+	return pids
+}
+
+// groupProcessesByUser sums CPU and memory per user, sorted by total CPU. The second result is
+// false when every process reports zero usage, which is what the ps -ef fallback produces.
+func groupProcessesByUser(processes []Process) ([]UserUsage, bool) {
+	totals := map[string]*UserUsage{}
+	usageAvailable := false
+
+	for _, process := range processes {
+		usage, ok := totals[process.User]
+		if !ok {
+			usage = &UserUsage{User: process.User}
+			totals[process.User] = usage
+		}
+
+		cpu := parsePercent(process.CPU)
+		memory := parsePercent(process.Memory)
+		if cpu > 0 || memory > 0 {
+			usageAvailable = true
+		}
+
+		usage.Processes++
+		usage.CPU += cpu
+		usage.Memory += memory
+	}
+
+	users := []UserUsage{}
+	for _, usage := range totals {
+		// Round away float accumulation noise
+		usage.CPU = math.Round(usage.CPU*10) / 10
+		usage.Memory = math.Round(usage.Memory*10) / 10
+		users = append(users, *usage)
+	}
+	slices.SortFunc(users, func(a, b UserUsage) int {
+		if a.CPU != b.CPU {
+			return cmp.Compare(b.CPU, a.CPU)
+		}
+		return strings.Compare(a.User, b.User)
+	})
+
+	return users, usageAvailable
+}
+
+// processStateLabels maps the leading character of a ps STAT code; the rest are modifiers
+// such as "s" (session leader) or "+" (foreground) that the label ignores
+var processStateLabels = map[byte]string{
+	'R': "Running",
+	'S': "Sleeping",
+	'D': "Uninterruptible",
+	'Z': "Zombie",
+	'T': "Stopped",
+	't': "Stopped",
+	'I': "Idle",
+	'X': "Dead",
+}
+
+func processStatusText(stat string) string {
+	if stat == "" {
+		return "Unknown"
+	}
+	if label, ok := processStateLabels[stat[0]]; ok {
+		return label
+	}
+	return "Unknown"
+}
+
+func parsePercent(value string) float64 {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0
+	}
+	return percent
+}
+
+// readProcessDetail reads a process's name, command line and cgroup from /proc/<pid>
+func readProcessDetail(pid int) (*ProcessDetail, error) {
+	comm, err := os.ReadFile(procFile(strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &ProcessDetail{PID: pid, Name: strings.TrimSpace(string(comm))}
+	// cmdline separates arguments with NULs
+	if cmdline, err := os.ReadFile(procFile(strconv.Itoa(pid), "cmdline")); err == nil {
+		detail.Command = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+	if cgroup, err := os.ReadFile(procFile(strconv.Itoa(pid), "cgroup")); err == nil {
+		detail.Cgroup = parseProcCgroup(string(cgroup))
+		detail.ContainerID = containerIDFromCgroup(detail.Cgroup)
+	}
+	return detail, nil
+}
+
+// parseProcCgroup returns the cgroup path from /proc/<pid>/cgroup, preferring the unified
+// (cgroup v2, "0::") hierarchy and otherwise the first v1 controller that names a path
+func parseProcCgroup(content string) string {
+	var fallback string
+	for _, line := range strings.Split(content, "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+		if fallback == "" && parts[2] != "/" {
+			fallback = parts[2]
+		}
+	}
+	return fallback
+}
+
+// containerIDPattern matches the 64-hex ID docker, containerd, CRI-O and podman put in the
+// last cgroup path segment, e.g. "/docker/<id>" or "docker-<id>.scope"
+var containerIDPattern = regexp.MustCompile(`^(?:docker-|cri-containerd-|crio-|libpod-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+func containerIDFromCgroup(path string) string {
+	if match := containerIDPattern.FindStringSubmatch(filepath.Base(path)); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// processSocketInodes returns the socket inodes held open by a process
+func processSocketInodes(pid int) (map[string]bool, error) {
+	fdDir := procFile(strconv.Itoa(pid), "fd")
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil, err
+	}
+
+	inodes := map[string]bool{}
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		// Socket descriptors link to "socket:[<inode>]"
+		if strings.HasPrefix(target, "socket:[") && strings.HasSuffix(target, "]") {
+			inodes[target[len("socket:["):len(target)-1]] = true
+		}
+	}
+	return inodes, nil
+}
+
+// pidsOwningInodes walks /proc/<pid>/fd for every process holding one of the socket inodes
+func pidsOwningInodes(inodes map[string]bool) map[int]bool {
+	pids := map[int]bool{}
+
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		return pids
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// Processes we can't inspect (or that already exited) are skipped
+		owned, err := processSocketInodes(pid)
+		if err != nil {
+			continue
+		}
+		for inode := range owned {
+			if inodes[inode] {
+				pids[pid] = true
+				break
+			}
+		}
 	}
-	return "Unknown"
+	return pids
 }
 
-func getCurrentWiFi() (*CurrentWiFi, error) {
-	// Get current WiFi connection using nmcli
-	cmd := exec.Command("nmcli", "-t", "-f", "ACTIVE,SSID,SIGNAL,SECURITY", "dev", "wifi")
-	output, err := cmd.Output()
-	if err != nil {
-		return &CurrentWiFi{Connected: false}, nil
+func readProcNetSockets() []ProcessSocket {
+	var sockets []ProcessSocket
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		data, err := os.ReadFile(procFile("net", protocol))
+		if err != nil {
+			continue
+		}
+		sockets = append(sockets, parseProcNetSockets(protocol, string(data))...)
 	}
+	return sockets
+}
 
-	return parseNmcliCurrentOutput(string(output)), nil
+// socketInodesForPort matches sockets bound to or connected to port
+func socketInodesForPort(sockets []ProcessSocket, port int) map[string]bool {
+	inodes := map[string]bool{}
+	want := strconv.Itoa(port)
+	for _, socket := range sockets {
+		// Inode 0 belongs to sockets in TIME_WAIT and similar, which no process owns anymore
+		if socket.Inode == "0" {
+			continue
+		}
+		for _, address := range []string{socket.LocalAddress, socket.RemoteAddress} {
+			if _, p, err := net.SplitHostPort(address); err == nil && p == want {
+				inodes[socket.Inode] = true
+			}
+		}
+	}
+	return inodes
 }
 
-func parseNmcliCurrentOutput(output string) *CurrentWiFi {
-	lines := strings.Split(output, "\n")
-	var currentWiFi CurrentWiFi
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+// parseProcNetSockets parses /proc/net/{tcp,tcp6,udp,udp6}
+func parseProcNetSockets(protocol, content string) []ProcessSocket {
+	var sockets []ProcessSocket
+
+	for i, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		if i == 0 || len(fields) < 10 {
 			continue
 		}
 
-		// nmcli -t output format: ACTIVE:SSID:SIGNAL:SECURITY
-		parts := strings.Split(line, ":")
-		if len(parts) >= 4 {
-			active := parts[0]
-			ssid := parts[1]
-			signal := parts[2]
-			security := parts[3]
-
-			// Check if this is an active connection
-			if active == "yes" && ssid != "" && ssid != "--" {
-				currentWiFi.SSID = ssid
-				currentWiFi.Signal = signal + "%"
-				currentWiFi.Security = normalizeSecurityType(security)
-				currentWiFi.Connected = true
-				break
+		state := tcpStates[fields[3]]
+		if strings.HasPrefix(protocol, "udp") {
+			// UDP has no connection state beyond bound/connected
+			state = "UNCONN"
+			if fields[3] == "01" {
+				state = "ESTABLISHED"
 			}
 		}
+
+		sockets = append(sockets, ProcessSocket{
+			Protocol:      protocol,
+			LocalAddress:  decodeProcNetAddress(fields[1]),
+			RemoteAddress: decodeProcNetAddress(fields[2]),
+			State:         state,
+			Inode:         fields[9],
+		})
 	}
 
-	return &currentWiFi
+	return sockets
 }
 
-func connectToWiFi(ssid, password, security string) error {
-	var cmd *exec.Cmd
-
-	switch security {
-	case "Open":
-		// Connect to open network
-		cmd = exec.Command("nmcli", "dev", "wifi", "connect", ssid)
-	case "WEP":
-		// Connect to WEP network
-		cmd = exec.Command("nmcli", "dev", "wifi", "connect", ssid, "password", password)
-	case "WPA", "WPA2", "WPA3":
-		// Connect to WPA network
-		cmd = exec.Command("nmcli", "dev", "wifi", "connect", ssid, "password", password)
-	default:
-		return fmt.Errorf("unsupported security type: %s", security)
+// decodeProcNetAddress converts "0100007F:0035" into "127.0.0.1:53", and the tcp6/udp6 form
+// "00000000000000000000000001000000:1F90" into "[::1]:8080"
+func decodeProcNetAddress(value string) string {
+	hexIP, hexPort, found := strings.Cut(value, ":")
+	if !found {
+		return value
 	}
 
-	output, err := cmd.CombinedOutput()
+	ip, err := decodeProcNetIP(hexIP)
+	if err != nil {
+		return value
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
 	if err != nil {
-		return fmt.Errorf("failed to connect to WiFi network %s: %v (output: %s)", ssid, err, string(output))
+		return value
 	}
 
-	return nil
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(port, 10))
 }
 
-func getProcesses() ([]Process, error) {
-	// Use ps command to get process information
-	// This is the most reliable cross-platform way to get process info
-	cmd := exec.Command("ps", "aux")
-	output, err := cmd.Output()
+// decodeProcNetIP decodes the 8 (IPv4) or 32 (IPv6) hex character addresses used throughout
+// /proc/net. The kernel prints each 32-bit word in host byte order, so on little-endian
+// machines the bytes within every word are reversed while the words themselves are in order.
+func decodeProcNetIP(value string) (net.IP, error) {
+	if len(value) != 8 && len(value) != 32 {
+		return nil, fmt.Errorf("unexpected address length %d in %q", len(value), value)
+	}
+
+	raw, err := hex.DecodeString(value)
 	if err != nil {
-		// Fallback to ps -ef if ps aux fails
-		cmd = exec.Command("ps", "-ef")
-		output, err = cmd.Output()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get process list: %v", err)
-		}
-		return parsePsEfOutput(string(output))
+		return nil, fmt.Errorf("invalid hex address %q: %v", value, err)
 	}
 
-	return parsePsAuxOutput(string(output))
+	// Each hex word is the numeric value of the word as it sits in memory, so writing it back
+	// in native order recovers the network-order address bytes
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		binary.NativeEndian.PutUint32(ip[word:], binary.BigEndian.Uint32(raw[word:]))
+	}
+	return ip, nil
 }
 
-func parsePsAuxOutput(output string) ([]Process, error) {
-	var processes []Process
-	lines := strings.Split(output, "\n")
+func signalProcess(pid int, sig syscall.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
 
-	for i, line := range lines {
-		if i == 0 || strings.TrimSpace(line) == "" {
-			continue // Skip header line and empty lines
-		}
+var passwdPath = "/etc/passwd"
 
-		fields := strings.Fields(line)
-		if len(fields) < 11 {
-			continue
+var (
+	passwdOnce  sync.Once
+	passwdUsers map[string]string
+)
+
+// resolveUser maps a numeric UID to a user name so ps -ef output matches ps aux
+func resolveUser(user string) string {
+	if _, err := strconv.Atoi(user); err != nil {
+		return user
+	}
+
+	passwdOnce.Do(func() {
+		passwdUsers = map[string]string{}
+		if data, err := os.ReadFile(passwdPath); err == nil {
+			passwdUsers = parsePasswd(string(data))
 		}
+	})
 
-		// ps aux format: USER PID %CPU %MEM VSZ RSS TTY STAT START TIME COMMAND
-		user := fields[0]
-		pidStr := fields[1]
-		cpu := fields[2]
-		mem := fields[3]
-		status := fields[7]
-		command := strings.Join(fields[10:], " ")
+	if name, ok := passwdUsers[user]; ok {
+		return name
+	}
+	return user
+}
 
-		pid, err := strconv.Atoi(pidStr)
-		if err != nil {
+// parsePasswd returns a UID to user name map from /etc/passwd content
+func parsePasswd(content string) map[string]string {
+	users := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-
-		// Extract process name from command
-		name := command
-		if spaceIndex := strings.Index(command, " "); spaceIndex > 0 {
-			name = command[:spaceIndex]
+		// name:password:UID:GID:GECOS:home:shell
+		parts := strings.Split(line, ":")
+		if len(parts) >= 3 {
+			if _, exists := users[parts[2]]; !exists {
+				users[parts[2]] = parts[0]
+			}
 		}
+	}
+	return users
+}
 
-		processes = append(processes, Process{
-			PID:     pid,
-			Name:    name,
-			Status:  status,
-			CPU:     cpu + "%",
-			Memory:  mem + "%",
-			User:    user,
-			Command: command,
-		})
+func checkNetworkConnectivity() bool {
+	// Try to connect to a reliable external service with a short timeout
+	return dialTCP("8.8.8.8:53", 3*time.Second) == nil
+}
+
+// dialTCP opens and immediately closes a TCP connection to address
+func dialTCP(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
 	}
+	conn.Close()
+	return nil
+}
 
-	return processes, nil
+// checkNetworkConnectivityVia is checkNetworkConnectivity pinned to one interface
+func checkNetworkConnectivityVia(device string) bool {
+	conn, err := deviceDialer(device, 3*time.Second).Dial("tcp", "8.8.8.8:53")
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
 }
 
-func parsePsEfOutput(output string) ([]Process, error) {
-	var processes []Process
-	lines := strings.Split(output, "\n")
+// procPath is the procfs mount point, overridable for restricted containers where /proc is masked
+var procPath = envOrDefault("CM_PROC_PATH", "/proc")
 
-	for i, line := range lines {
-		if i == 0 || strings.TrimSpace(line) == "" {
-			continue // Skip header line and empty lines
-		}
+var errProcUnavailable = errors.New("not supported in this environment: procfs is unavailable")
 
-		fields := strings.Fields(line)
-		if len(fields) < 8 {
-			continue
-		}
+func procFile(parts ...string) string {
+	return filepath.Join(append([]string{procPath}, parts...)...)
+}
 
-		// ps -ef format: UID PID PPID C STIME TTY TIME CMD
-		user := fields[0]
-		pidStr := fields[1]
-		command := strings.Join(fields[7:], " ")
+func procAvailable() bool {
+	_, err := os.Stat(procFile("stat"))
+	return err == nil
+}
 
-		pid, err := strconv.Atoi(pidStr)
-		if err != nil {
-			continue
+// writeProcUnavailable reports that a /proc-backed feature can't run here
+func writeProcUnavailable(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotImplemented, map[string]string{"error": errProcUnavailable.Error(), "code": "not_supported"})
+}
+
+// Capability bit numbers from linux/capability.h
+const (
+	capKill     = 5
+	capNetAdmin = 12
+	capSysBoot  = 22
+)
+
+// readEffectiveCapabilities parses the CapEff mask from /proc/self/status
+func readEffectiveCapabilities() (uint64, error) {
+	data, err := os.ReadFile(procFile("self", "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "CapEff:"); ok {
+			return strconv.ParseUint(strings.TrimSpace(value), 16, 64)
 		}
+	}
+	return 0, fmt.Errorf("CapEff not found in %s", procFile("self", "status"))
+}
 
-		// Extract process name from command
-		name := command
-		if spaceIndex := strings.Index(command, " "); spaceIndex > 0 {
-			name = command[:spaceIndex]
+// resolveCapabilities treats root as all-powerful and otherwise checks individual capability bits
+func resolveCapabilities(euid int, effective uint64) Capabilities {
+	has := func(bit uint) bool { return euid == 0 || effective&(1<<bit) != 0 }
+	return Capabilities{
+		EUID:             euid,
+		CanReboot:        has(capSysBoot),
+		CanKillAny:       has(capKill),
+		CanModifyNetwork: has(capNetAdmin),
+	}
+}
+
+func getBootTime() (time.Time, error) {
+	if !procAvailable() {
+		return time.Time{}, errProcUnavailable
+	}
+
+	// Prefer btime from /proc/stat since it is the exact boot epoch
+	if data, err := os.ReadFile(procFile("stat")); err == nil {
+		if bootTime, err := parseProcStatBootTime(string(data)); err == nil {
+			return bootTime, nil
 		}
+	}
 
-		processes = append(processes, Process{
-			PID:     pid,
-			Name:    name,
-			Status:  "R", // Running (default for ps -ef)
-			CPU:     "0%",
-			Memory:  "0%",
-			User:    user,
-			Command: command,
-		})
+	// Fallback to subtracting /proc/uptime from now
+	data, err := os.ReadFile(procFile("uptime"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read boot time: %v", err)
 	}
 
-	return processes, nil
-}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("unexpected /proc/uptime format")
+	}
 
-func checkNetworkConnectivity() bool {
-	// Try to connect to a reliable external service with a short timeout
-	conn, err := net.DialTimeout("tcp", "8.8.8.8:53", 3*time.Second)
+	seconds, err := strconv.ParseFloat(fields[0], 64)
 	if err != nil {
-		return false
+		return time.Time{}, fmt.Errorf("failed to parse /proc/uptime: %v", err)
 	}
-	conn.Close()
-	return true
+
+	return time.Now().Add(-time.Duration(seconds * float64(time.Second))).Truncate(time.Second), nil
+}
+
+func parseProcStatBootTime(output string) (time.Time, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "btime" {
+			epoch, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("failed to parse btime: %v", err)
+			}
+			return time.Unix(epoch, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("btime not found in /proc/stat")
 }
 
 func formatUptime(duration time.Duration) string {
@@ -624,33 +8171,297 @@ func formatUptime(duration time.Duration) string {
 	}
 }
 
-func main() {
-	// Set process title for better identification in process lists
-	os.Args[0] = "cm-utils"
+const staticCacheMaxAge = 5 * time.Minute
 
-	app := NewApp()
+// cacheFor marks responses that are effectively static for the process lifetime as cacheable
+func cacheFor(maxAge time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+		next(w, r)
+	}
+}
+
+// noStore marks live system data that must never be served from a cache
+func noStore(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		next(w, r)
+	}
+}
+
+// revalidate allows caching but requires an ETag check on every use
+func revalidate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		next(w, r)
+	}
+}
 
-	r := mux.NewRouter()
+// listenFDsStart is the first inherited descriptor under systemd's LISTEN_FDS convention
+const listenFDsStart = 3
+
+// inheritedListenerFD returns a listener descriptor handed over by the parent: CM_LISTEN_FD
+// names one explicitly (for graceful reloads), while systemd socket activation sets
+// LISTEN_FDS and LISTEN_PID. It returns -1 when nothing was inherited.
+func inheritedListenerFD() (int, error) {
+	if value := os.Getenv("CM_LISTEN_FD"); value != "" {
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 0 {
+			return -1, fmt.Errorf("invalid CM_LISTEN_FD: %q", value)
+		}
+		return fd, nil
+	}
+
+	// LISTEN_PID guards against a child process picking up descriptors meant for its parent
+	count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if count < 1 || pid != os.Getpid() {
+		return -1, nil
+	}
+	return listenFDsStart, nil
+}
+
+// listen takes over an inherited listening socket when present, or binds address itself
+func listen(address string) (net.Listener, error) {
+	fd, err := inheritedListenerFD()
+	if err != nil {
+		return nil, err
+	}
+	if fd < 0 {
+		return net.Listen("tcp", address)
+	}
+
+	file := os.NewFile(uintptr(fd), "inherited-listener")
+	if file == nil {
+		return nil, fmt.Errorf("inherited listener fd %d is not valid", fd)
+	}
+	// FileListener dups the descriptor, so the original can be closed
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use inherited listener fd %d: %v", fd, err)
+	}
+	for _, key := range []string{"CM_LISTEN_FD", "LISTEN_FDS", "LISTEN_PID", "LISTEN_FDNAMES"} {
+		os.Unsetenv(key)
+	}
+	log.Printf("Using inherited listener on %s (fd %d)", listener.Addr(), fd)
+	return listener, nil
+}
+
+// sdNotify sends a state update to systemd, doing nothing when not run under a notify-type unit
+func sdNotify(state string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+
+	// A leading @ denotes a socket in the abstract namespace
+	if strings.HasPrefix(socketPath, "@") {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to notify socket: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often to ping the systemd watchdog, or zero when it isn't enabled
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	// WATCHDOG_PID, when set, must name this process
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	// Ping at half the timeout so a single late tick doesn't get us killed
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+func startWatchdog() {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	log.Printf("systemd watchdog enabled, pinging every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				log.Printf("Failed to ping systemd watchdog: %v", err)
+			}
+		}
+	}()
+}
+
+// routes builds the router for every page and API endpoint, mounted under basePath
+func (app *App) routes() *mux.Router {
+	root := mux.NewRouter()
+	root.Use(app.recoveryMiddleware)
+	root.NotFoundHandler = http.HandlerFunc(app.notFoundHandler)
+
+	// CM_BASE_PATH mounts everything under a prefix when served behind a reverse proxy
+	r := root
+	if app.basePath != "" {
+		root.Handle(app.basePath, http.RedirectHandler(app.basePath+"/", http.StatusMovedPermanently))
+		r = root.PathPrefix(app.basePath).Subrouter()
+	}
 
 	// Static files from embedded filesystem
 	staticSubFS, _ := fs.Sub(staticFS, "build/static")
-	staticHandler := http.FileServer(http.FS(staticSubFS))
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", staticHandler))
+	r.PathPrefix("/static/").Handler(http.StripPrefix(app.basePath+"/static/", app.staticHandler(staticSubFS)))
 
 	// Routes
 	r.HandleFunc("/", app.homeHandler).Methods("GET")
 	r.HandleFunc("/processes", app.processesHandler).Methods("GET")
 	r.HandleFunc("/system", app.systemHandler).Methods("GET")
-	r.HandleFunc("/api/version", app.getVersionHandler).Methods("GET")
-	r.HandleFunc("/api/health", app.getSystemHealthHandler).Methods("GET")
-	r.HandleFunc("/api/nmcli/status", app.getNmcliStatusHandler).Methods("GET")
-	r.HandleFunc("/api/interfaces", app.getInterfacesHandler).Methods("GET")
-	r.HandleFunc("/api/wifi/scan", app.getWiFiNetworksHandler).Methods("GET")
-	r.HandleFunc("/api/wifi/current", app.getCurrentWiFiHandler).Methods("GET")
+	r.HandleFunc("/login", app.loginPageHandler).Methods("GET")
+	r.HandleFunc("/api/version", cacheFor(staticCacheMaxAge, app.getVersionHandler)).Methods("GET")
+	r.HandleFunc("/api/health", noStore(app.getSystemHealthHandler)).Methods("GET")
+	r.HandleFunc("/api/health/full", noStore(app.getFullHealthHandler)).Methods("GET")
+	r.HandleFunc("/api/stats", noStore(app.getStatsHandler)).Methods("GET")
+	r.HandleFunc("/api/capabilities", noStore(app.getCapabilitiesHandler)).Methods("GET")
+	r.HandleFunc("/api/info", cacheFor(staticCacheMaxAge, app.getSystemInfoHandler)).Methods("GET")
+	r.HandleFunc("/api/nmcli/status", noStore(app.getNmcliStatusHandler)).Methods("GET")
+	r.HandleFunc("/api/interfaces", noStore(app.getInterfacesHandler)).Methods("GET")
+	r.HandleFunc("/api/interfaces/history", noStore(app.getInterfaceHistoryHandler)).Methods("GET")
+	r.HandleFunc("/api/interfaces/events", app.interfaceEventsHandler).Methods("GET")
+	r.HandleFunc("/api/interfaces/{name}/dhcp/renew", app.renewDHCPHandler).Methods("POST")
+	r.HandleFunc("/api/interfaces/{name}/reapply", app.reapplyInterfaceHandler).Methods("POST")
+	r.HandleFunc("/api/interfaces/{name}/bandwidth/stream", app.interfaceBandwidthStreamHandler).Methods("GET")
+	r.HandleFunc("/api/interfaces/{name}/managed", app.setInterfaceManagedHandler).Methods("POST")
+	r.HandleFunc("/api/interfaces/{name}/dns", app.setInterfaceDNSHandler).Methods("POST")
+	r.HandleFunc("/api/interfaces/{name}/errors", noStore(app.getInterfaceErrorsHandler)).Methods("GET")
+	r.HandleFunc("/api/network/public-ip", noStore(app.getPublicIPHandler)).Methods("GET")
+	r.HandleFunc("/api/network/neighbors", noStore(app.getNeighborsHandler)).Methods("GET")
+	r.HandleFunc("/api/network/resolved", noStore(app.getResolvedStatusHandler)).Methods("GET")
+	r.HandleFunc("/api/network/port-check", app.portCheckHandler).Methods("POST")
+	r.HandleFunc("/api/network/dns-benchmark", app.dnsBenchmarkHandler).Methods("POST")
+	r.HandleFunc("/api/network/iperf", app.runIperfHandler).Methods("POST")
+	r.HandleFunc("/api/vpn/wireguard", noStore(app.getWireGuardHandler)).Methods("GET")
+	r.HandleFunc("/api/vpn/wireguard/{iface}/{action:up|down}", app.setWireGuardStateHandler).Methods("POST")
+	r.HandleFunc("/api/network/router-mode", app.requireDestructive(app.setRouterModeHandler)).Methods("POST")
+	r.HandleFunc("/api/wifi/scan", noStore(app.getWiFiNetworksHandler)).Methods("GET")
+	r.HandleFunc("/api/wifi/scan/meta", noStore(app.getWiFiScanMetaHandler)).Methods("GET")
+	r.HandleFunc("/api/wifi/current", noStore(app.getCurrentWiFiHandler)).Methods("GET")
+	r.HandleFunc("/api/wifi/link", noStore(app.getWiFiLinkHandler)).Methods("GET")
+	r.HandleFunc("/api/wifi/autoconnect", noStore(app.getWiFiAutoconnectHandler)).Methods("GET")
+	r.HandleFunc("/api/wifi/autoconnect", app.setWiFiAutoconnectHandler).Methods("POST")
+	r.HandleFunc("/api/wifi/errors", noStore(app.getWiFiErrorsHandler)).Methods("GET")
+	r.HandleFunc("/api/wifi/errors", app.clearWiFiErrorsHandler).Methods("DELETE")
+	r.HandleFunc("/api/wifi/self-heal", app.selfHealWiFiHandler).Methods("POST")
 	r.HandleFunc("/api/wifi/connect", app.connectWiFiHandler).Methods("POST")
-	r.HandleFunc("/api/processes", app.getProcessesHandler).Methods("GET")
+	r.HandleFunc("/api/wifi/connect-verify", app.connectVerifyWiFiHandler).Methods("POST")
+	r.HandleFunc("/api/wifi/mac-policy", noStore(app.getMACPolicyHandler)).Methods("GET")
+	r.HandleFunc("/api/wifi/mac-policy", app.setMACPolicyHandler).Methods("POST")
+	r.HandleFunc("/api/wifi/wps", app.wpsConnectHandler).Methods("POST")
+	r.HandleFunc("/api/wifi/provision", app.provisionWiFiHandler).Methods("POST")
+	r.HandleFunc("/api/wifi/saved/{ssid}/password", noStore(app.requireAuth(app.getSavedWiFiPasswordHandler))).Methods("GET")
+	r.HandleFunc("/api/wifi/saved/{ssid}/clear-secret", app.clearWiFiSecretHandler).Methods("POST")
+	r.HandleFunc("/api/nm/connections/orphaned", noStore(app.getOrphanedConnectionsHandler)).Methods("GET")
+	r.HandleFunc("/api/nm/connections/prune", app.pruneOrphanedConnectionsHandler).Methods("POST")
+	r.HandleFunc("/api/nm/connections/import", app.importConnectionHandler).Methods("POST")
+	// The process list carries an ETag, so it must revalidate rather than skip caching entirely
+	r.HandleFunc("/api/processes", revalidate(app.getProcessesHandler)).Methods("GET")
+	r.HandleFunc("/api/processes/by-user", noStore(app.getProcessesByUserHandler)).Methods("GET")
+	r.HandleFunc("/api/processes/kill-by-name", app.killProcessesByNameHandler).Methods("POST")
+	r.HandleFunc("/api/processes/snapshot", noStore(app.snapshotProcessesHandler)).Methods("POST")
+	r.HandleFunc("/api/processes/diff", noStore(app.getProcessDiffHandler)).Methods("GET")
+	r.HandleFunc("/api/processes/by-port/{port}", noStore(app.getProcessesByPortHandler)).Methods("GET")
+	r.HandleFunc("/api/processes/{pid:[0-9]+}", noStore(app.getProcessDetailHandler)).Methods("GET")
+	r.HandleFunc("/api/processes/{pid}/sockets", noStore(app.getProcessSocketsHandler)).Methods("GET")
 	r.HandleFunc("/api/system/reboot", app.rebootHandler).Methods("POST")
+	r.HandleFunc("/api/system/reboot/schedule", app.scheduleRebootHandler).Methods("POST")
+	r.HandleFunc("/api/system/reboot/cancel", app.cancelRebootHandler).Methods("POST")
+	r.HandleFunc("/api/self/restart", app.requireDestructive(app.selfRestartHandler)).Methods("POST")
+	r.HandleFunc("/api/logs/follow", app.followLogsHandler).Methods("GET")
+	r.HandleFunc("/api/logs/file", noStore(app.getLogFileHandler)).Methods("GET")
+	r.HandleFunc("/api/auth/login", noStore(app.loginHandler)).Methods("POST")
+	r.HandleFunc("/api/auth/logout", noStore(app.logoutHandler)).Methods("POST")
+	r.HandleFunc("/api/auth/rotate", noStore(app.requireAuth(app.rotateAuthTokenHandler))).Methods("POST")
+	r.HandleFunc("/api/security/auth-failures", noStore(app.getAuthFailuresHandler)).Methods("GET")
+	r.HandleFunc("/api/diagnostics.tar.gz", app.getDiagnosticsArchiveHandler).Methods("GET")
+	r.HandleFunc("/api/firewall/rules", noStore(app.getFirewallRulesHandler)).Methods("GET")
+	r.HandleFunc("/api/system/power", noStore(app.getPowerHandler)).Methods("GET")
+	r.HandleFunc("/api/system/memory", noStore(app.getMemoryHandler)).Methods("GET")
+	r.HandleFunc("/api/system/entropy", noStore(app.getEntropyHandler)).Methods("GET")
+	r.HandleFunc("/api/system/kernel", cacheFor(staticCacheMaxAge, app.getKernelHandler)).Methods("GET")
+	r.HandleFunc("/api/system/os-release", cacheFor(staticCacheMaxAge, app.getOSReleaseHandler)).Methods("GET")
+	r.HandleFunc("/api/system/packages", noStore(app.getPackagesHandler)).Methods("GET")
+	r.HandleFunc("/api/system/reboot-required", noStore(app.getRebootRequiredHandler)).Methods("GET")
+	r.HandleFunc("/api/system/cpu/governor", noStore(app.getCPUGovernorHandler)).Methods("GET")
+	r.HandleFunc("/api/system/cpu/governor", app.setCPUGovernorHandler).Methods("POST")
+	r.HandleFunc("/api/system/disks/{device}/smart", noStore(app.getDiskSmartHandler)).Methods("GET")
+	r.HandleFunc("/api/system/sysctl/{key}", noStore(app.getSysctlHandler)).Methods("GET")
+	r.HandleFunc("/api/system/sysctl", app.requireDestructive(app.setSysctlHandler)).Methods("POST")
+	r.HandleFunc("/api/system/maintenance", noStore(app.getMaintenanceHandler)).Methods("GET")
+	r.HandleFunc("/api/system/maintenance", app.setMaintenanceHandler).Methods("POST")
+
+	return root
+}
+
+func main() {
+	// Set process title for better identification in process lists
+	os.Args[0] = "cm-utils"
+
+	app := NewApp()
+	root := app.routes()
+
+	listener, err := listen(":9080")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("ControlMate Utils starting on %s%s/\n", listener.Addr(), app.basePath)
+	if err := sdNotify("READY=1"); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+	startWatchdog()
+	go app.watchInterfaces()
 
-	fmt.Println("ControlMate Utils starting on :9080")
-	log.Fatal(http.ListenAndServe(":9080", r))
+	// Stop background work and drain requests on SIGTERM/SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if interval := wifiAutoscanInterval(); interval > 0 && app.NmcliAvailable() {
+		log.Printf("Background WiFi scanning every %s", interval)
+		go app.autoscanWiFi(ctx, interval, scanWiFiNetworks)
+	}
+
+	if app.statsFile != "" {
+		go app.persistStats(ctx, statsSaveInterval)
+	}
+
+	server := &http.Server{Handler: root}
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		if err := sdNotify("STOPPING=1"); err != nil {
+			log.Printf("Failed to notify systemd: %v", err)
+		}
+		// Streaming endpoints never finish on their own, so don't wait on them for long
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+		app.saveStats()
+	}()
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	// Serve returns as soon as shutdown starts; wait for in-flight requests to drain
+	<-shutdown
 }
@@ -0,0 +1,5888 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBuildConnectArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		ssid     string
+		password string
+		security string
+		bssid    string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "open",
+			ssid:     "Cafe",
+			security: "Open",
+			want:     []string{"dev", "wifi", "connect", "Cafe"},
+		},
+		{
+			name:     "wpa2",
+			ssid:     "Office",
+			password: "supersecret",
+			security: "WPA2",
+			want:     []string{"dev", "wifi", "connect", "Office", "password", "supersecret"},
+		},
+		{
+			name:     "pinned bssid",
+			ssid:     "Office",
+			password: "supersecret",
+			security: "WPA2",
+			bssid:    "AA:BB:CC:DD:EE:FF",
+			want:     []string{"dev", "wifi", "connect", "Office", "password", "supersecret", "bssid", "AA:BB:CC:DD:EE:FF"},
+		},
+		{
+			name:     "unsupported security",
+			ssid:     "Office",
+			security: "Enterprise",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildConnectArgs(tt.ssid, tt.password, tt.security, tt.bssid)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildConnectArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("buildConnectArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConnectionRequestBSSID(t *testing.T) {
+	tests := []struct {
+		bssid string
+		valid bool
+	}{
+		{"", true},
+		{"aa:bb:cc:dd:ee:ff", true},
+		{"AA:BB:CC:DD:EE:FF", true},
+		{"AA:BB:CC:DD:EE", false},
+		{"AA-BB-CC-DD-EE-FF", false},
+		{"AA:BB:CC:DD:EE:GG", false},
+		{"AA:BB:CC:DD:EE:FF:00", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bssid, func(t *testing.T) {
+			req := ConnectionRequest{SSID: "Office", Password: "supersecret", Security: "WPA2", BSSID: tt.bssid}
+			if got := hasFieldError(validateConnectionRequest(req), "bssid"); got == tt.valid {
+				t.Errorf("BSSID %q: field error = %v, want valid = %v", tt.bssid, got, tt.valid)
+			}
+		})
+	}
+}
+
+func hasFieldError(err *ValidationError, field string) bool {
+	if err == nil {
+		return false
+	}
+	return slices.ContainsFunc(err.Errors, func(e FieldError) bool { return e.Field == field })
+}
+
+func TestSafeExecAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		allowed bool
+	}{
+		{"allowlisted", "nmcli", true},
+		{"not allowlisted", "rm", false},
+		{"path to allowlisted binary", "/usr/bin/nmcli", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := safeExec(tt.command, "--version")
+			if tt.allowed {
+				if err != nil || cmd == nil {
+					t.Fatalf("safeExec(%q) = %v, %v; want a command", tt.command, cmd, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("safeExec(%q) succeeded, want it refused", tt.command)
+			}
+			if _, err := runCommand(tt.command); err == nil {
+				t.Errorf("runCommand(%q) succeeded, want it refused", tt.command)
+			}
+		})
+	}
+}
+
+func TestParseProcStatBootTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		stat    string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "btime present",
+			stat: "cpu  2255 34 2290 22625563 6290 127 456 0 0 0\nintr 93326 12 0\nctxt 1990473\nbtime 1700000000\nprocesses 2915\n",
+			want: time.Unix(1700000000, 0),
+		},
+		{name: "btime missing", stat: "cpu  2255 34 2290\nctxt 1990473\n", wantErr: true},
+		{name: "btime malformed", stat: "btime soon\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProcStatBootTime(tt.stat)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProcStatBootTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseProcStatBootTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeCommands puts shell scripts named after system commands first on PATH and returns a
+// function reporting each invocation ("name arg..."), in order
+func fakeCommands(t *testing.T, scripts map[string]string) func() []string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands are shell scripts")
+	}
+
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls.log")
+	for name, script := range scripts {
+		content := fmt.Sprintf("#!/bin/sh\necho \"%s $*\" >> %q\n%s\n", name, calls, script)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return func() []string {
+		data, err := os.ReadFile(calls)
+		if err != nil {
+			return nil
+		}
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+}
+
+func TestBuildClearSecretArgs(t *testing.T) {
+	want := []string{"connection", "modify", "Office", "wifi-sec.psk", "", "wifi-sec.psk-flags", "2"}
+	if got := buildClearSecretArgs("Office"); !slices.Equal(got, want) {
+		t.Errorf("buildClearSecretArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestClearWiFiSecretHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		ssid       string
+		wantStatus int
+		wantModify bool
+	}{
+		{name: "saved profile", ssid: "Office", wantStatus: http.StatusOK, wantModify: true},
+		{name: "profile not found", ssid: "Elsewhere", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{
+				"nmcli": `[ "$1" = "-t" ] && printf 'Office:802-11-wireless\nWired connection 1:802-3-ethernet\n'; exit 0`,
+			})
+			app := &App{nmcliAvailable: true}
+
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/wifi/saved/"+tt.ssid+"/clear-secret", nil), map[string]string{"ssid": tt.ssid})
+			rec := httptest.NewRecorder()
+			app.clearWiFiSecretHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			modify := "nmcli " + strings.Join(buildClearSecretArgs(tt.ssid), " ")
+			if got := slices.Contains(calls(), modify); got != tt.wantModify {
+				t.Errorf("ran %q = %v, want %v (calls %q)", modify, got, tt.wantModify, calls())
+			}
+		})
+	}
+}
+
+// TestNmcliAvailableConcurrentAccess is meant for `go test -race`: readers hammer the accessors
+// while a background checker flips the flag
+func TestNmcliAvailableConcurrentAccess(t *testing.T) {
+	app := &App{version: "1.0.0"}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			app.setNmcliAvailable(i%2 == 0)
+		}
+	}()
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				app.NmcliAvailable()
+				if app.Version() != "1.0.0" {
+					t.Error("Version() changed underneath a reader")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	app.setNmcliAvailable(true)
+	if !app.NmcliAvailable() {
+		t.Error("NmcliAvailable() = false after setNmcliAvailable(true)")
+	}
+}
+
+func TestParseIwLinkOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   WiFiLink
+	}{
+		{
+			name: "connected",
+			output: `Connected to a4:2b:b0:c1:d2:e3 (on wlan0)
+	SSID: Office
+	freq: 5180
+	RX: 1827361 bytes (9234 packets)
+	TX: 293847 bytes (1830 packets)
+	signal: -57 dBm
+	rx bitrate: 433.3 MBit/s VHT-MCS 9 80MHz short GI VHT-NSS 1
+	tx bitrate: 390.0 MBit/s VHT-MCS 8 80MHz short GI VHT-NSS 1
+`,
+			want: WiFiLink{Connected: true, SSID: "Office", BSSID: "a4:2b:b0:c1:d2:e3", Freq: 5180, Channel: 36, RxRate: "433.3 MBit/s", TxRate: "390.0 MBit/s", SignalDBM: -57},
+		},
+		{
+			name:   "fractional frequency",
+			output: "Connected to 00:11:22:33:44:55 (on wlan0)\n\tSSID: Home\n\tfreq: 2437.0\n\tsignal: -70 dBm\n",
+			want:   WiFiLink{Connected: true, SSID: "Home", BSSID: "00:11:22:33:44:55", Freq: 2437, Channel: 6, SignalDBM: -70},
+		},
+		{name: "not connected", output: "Not connected.\n", want: WiFiLink{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseIwLinkOutput(tt.output); *got != tt.want {
+				t.Errorf("parseIwLinkOutput() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNmcliLinkOutput(t *testing.T) {
+	output := "no:Neighbour:11\\:22\\:33\\:44\\:55\\:66:2412 MHz:54 Mbit/s:40\nyes:Office:A4\\:2B\\:B0\\:C1\\:D2\\:E3:5180 MHz:270 Mbit/s:80\n"
+	want := WiFiLink{Connected: true, SSID: "Office", BSSID: "A4:2B:B0:C1:D2:E3", Freq: 5180, Channel: 36, RxRate: "270 Mbit/s", TxRate: "270 Mbit/s", SignalDBM: -60}
+	if got := parseNmcliLinkOutput(output); *got != want {
+		t.Errorf("parseNmcliLinkOutput() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestFrequencyToChannel(t *testing.T) {
+	tests := []struct {
+		freq int
+		want int
+	}{
+		{2412, 1},
+		{2437, 6},
+		{2484, 14},
+		{5180, 36},
+		{5825, 165},
+		{5955, 1},
+		{900, 0},
+	}
+	for _, tt := range tests {
+		if got := frequencyToChannel(tt.freq); got != tt.want {
+			t.Errorf("frequencyToChannel(%d) = %d, want %d", tt.freq, got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceStateRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		state MaintenanceState
+	}{
+		{"enabled", MaintenanceState{Enabled: true, Message: "Firmware update until 14:00", UpdatedAt: "2026-10-14T09:00:00Z"}},
+		{"disabled", MaintenanceState{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{stateDir: t.TempDir()}
+			if err := app.setMaintenance(tt.state); err != nil {
+				t.Fatalf("setMaintenance() error = %v", err)
+			}
+
+			got, err := loadMaintenanceState(app.maintenanceFile())
+			if err != nil {
+				t.Fatalf("loadMaintenanceState() error = %v", err)
+			}
+			if got != tt.state {
+				t.Errorf("loaded %+v, want %+v", got, tt.state)
+			}
+			if app.Maintenance() != tt.state {
+				t.Errorf("Maintenance() = %+v, want %+v", app.Maintenance(), tt.state)
+			}
+		})
+	}
+}
+
+func TestLoadMaintenanceStateMissingFile(t *testing.T) {
+	if _, err := loadMaintenanceState(filepath.Join(t.TempDir(), "maintenance.json")); !os.IsNotExist(err) {
+		t.Errorf("loadMaintenanceState() error = %v, want not-exist", err)
+	}
+}
+
+func TestValidateWiFiPassword(t *testing.T) {
+	tests := []struct {
+		security string
+		password string
+		valid    bool
+	}{
+		{"Open", "", true},
+		{"WEP", "abcde", true},
+		{"WEP", "abcdefghijklm", true},
+		{"WEP", "0123456789", true},
+		{"WEP", "0123456789abcdef0123456789", true},
+		{"WEP", "abcdefghijklmnop", true},
+		{"WEP", "correct horse battery", true},
+		{"WEP", strings.Repeat("x", 64), true},
+		{"WEP", "", false},
+		{"WEP", strings.Repeat("x", 65), false},
+		{"WPA", "1234567", false},
+		{"WPA2", "12345678", true},
+		{"WPA3", strings.Repeat("x", 63), true},
+		{"WPA3", strings.Repeat("x", 64), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.security+"/"+tt.password, func(t *testing.T) {
+			err := validateWiFiPassword(tt.security, tt.password)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateWiFiPassword(%q, %q) error = %v, want valid = %v", tt.security, tt.password, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestParseAuthFailures(t *testing.T) {
+	journal := `Oct 14 09:12:01 controlmate sshd[812]: Accepted publickey for pi from 192.168.1.20 port 50122 ssh2
+Oct 14 09:12:05 controlmate sshd[815]: Failed password for root from 203.0.113.7 port 41022 ssh2
+Oct  4 09:13:10 controlmate sshd[820]: Failed password for invalid user admin from 2001:db8::1 port 22 ssh2
+Oct 14 09:14:00 controlmate sshd[822]: Failed password for pi from fe80::1%wlan0 port 5555 ssh2
+Oct 14 09:15:00 controlmate CRON[900]: pam_unix(cron:session): session opened for user root
+`
+	want := []AuthFailure{
+		{Timestamp: "Oct 14 09:12:05", User: "root", SourceIP: "203.0.113.7"},
+		{Timestamp: "Oct 4 09:13:10", User: "admin", SourceIP: "2001:db8::1"},
+		{Timestamp: "Oct 14 09:14:00", User: "pi", SourceIP: "fe80::1%wlan0"},
+	}
+
+	if got := parseAuthFailures(journal); !slices.Equal(got, want) {
+		t.Errorf("parseAuthFailures() =\n%+v\nwant\n%+v", got, want)
+	}
+	if got := parseAuthFailures(""); got == nil || len(got) != 0 {
+		t.Errorf("parseAuthFailures(\"\") = %#v, want an empty slice", got)
+	}
+}
+
+func TestRenewDHCPLeaseFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		nmcli     bool
+		nmcliExit int
+		wantCalls []string
+	}{
+		{
+			name:      "nmcli reapply",
+			nmcli:     true,
+			wantCalls: []string{"nmcli device reapply eth0"},
+		},
+		{
+			name:      "nmcli fails, dhclient takes over",
+			nmcli:     true,
+			nmcliExit: 10,
+			wantCalls: []string{"nmcli device reapply eth0", "dhclient -r eth0", "dhclient eth0"},
+		},
+		{
+			name:      "no NetworkManager",
+			wantCalls: []string{"dhclient -r eth0", "dhclient eth0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{
+				"nmcli":    fmt.Sprintf("exit %d", tt.nmcliExit),
+				"dhclient": "exit 0",
+			})
+			if err := renewDHCPLease("eth0", tt.nmcli); err != nil {
+				t.Fatalf("renewDHCPLease() error = %v", err)
+			}
+			if got := calls(); !slices.Equal(got, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRenewDHCPHandlerUnknownInterface(t *testing.T) {
+	app := &App{}
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/interfaces/nosuch0/dhcp/renew", nil), map[string]string{"name": "nosuch0"})
+	rec := httptest.NewRecorder()
+	app.renewDHCPHandler(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestCheckRebootRequired(t *testing.T) {
+	tests := []struct {
+		name         string
+		flag         bool
+		packages     string
+		restartExit  int
+		wantRequired bool
+		wantPackages []string
+	}{
+		{name: "no flag", wantPackages: []string{}},
+		{name: "flag without package list", flag: true, wantRequired: true, wantPackages: []string{}},
+		{
+			name:         "flag with packages",
+			flag:         true,
+			packages:     "linux-image-6.1.0-13-arm64\nlibc6\n\nlibc6\n",
+			wantRequired: true,
+			wantPackages: []string{"linux-image-6.1.0-13-arm64", "libc6"},
+		},
+		{name: "needs-restarting reports a reboot", restartExit: 1, wantRequired: true, wantPackages: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommands(t, map[string]string{"needs-restarting": fmt.Sprintf("exit %d", tt.restartExit)})
+			dir := t.TempDir()
+			flagPath := filepath.Join(dir, "reboot-required")
+			pkgsPath := filepath.Join(dir, "reboot-required.pkgs")
+			if tt.flag {
+				writeTestFile(t, flagPath, "*** System restart required ***\n")
+			}
+			if tt.packages != "" {
+				writeTestFile(t, pkgsPath, tt.packages)
+			}
+
+			got, err := checkRebootRequired(context.Background(), flagPath, pkgsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Required != tt.wantRequired || !slices.Equal(got.Packages, tt.wantPackages) {
+				t.Errorf("checkRebootRequired() = %+v, want required %v packages %q", got, tt.wantRequired, tt.wantPackages)
+			}
+		})
+	}
+}
+
+// writeTestFile writes content to path, creating parent directories as needed
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandSlotsCapConcurrency(t *testing.T) {
+	limit := cap(commandSlots)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range limit * 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := acquireCommandSlot(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			defer releaseCommandSlot()
+
+			now := running.Add(1)
+			for {
+				if old := peak.Load(); now <= old || peak.CompareAndSwap(old, now) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if got := int(peak.Load()); got > limit {
+		t.Errorf("peak concurrency = %d, want at most %d", got, limit)
+	}
+}
+
+func TestCommandSlotsBusy(t *testing.T) {
+	for range cap(commandSlots) {
+		if err := acquireCommandSlot(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for range cap(commandSlots) {
+			releaseCommandSlot()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := runCommandContext(ctx, "uname"); !errors.Is(err, errCommandBusy) {
+		t.Errorf("runCommandContext() with no free slot error = %v, want errCommandBusy", err)
+	}
+	if got := commandErrorStatus(errCommandBusy); got != http.StatusServiceUnavailable {
+		t.Errorf("commandErrorStatus(errCommandBusy) = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRequestCommandsBusy(t *testing.T) {
+	fakeCommands(t, map[string]string{"journalctl": "exit 0", "needs-restarting": "exit 0"})
+	for range cap(commandSlots) {
+		if err := acquireCommandSlot(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for range cap(commandSlots) {
+			releaseCommandSlot()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	newTestApp(t).getAuthFailuresHandler(rec, httptest.NewRequest(http.MethodGet, "/api/security/auth-failures", nil).WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), errCommandBusy.Error()) {
+		t.Errorf("auth failures response = %d %s, want 503 with the busy error", rec.Code, rec.Body)
+	}
+
+	dir := t.TempDir()
+	if _, err := checkRebootRequired(ctx, filepath.Join(dir, "reboot-required"), filepath.Join(dir, "reboot-required.pkgs")); !errors.Is(err, errCommandBusy) {
+		t.Errorf("checkRebootRequired() error = %v, want errCommandBusy", err)
+	}
+}
+
+func TestMaxConcurrentCommands(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", defaultMaxConcurrentCommands},
+		{"8", 8},
+		{"0", defaultMaxConcurrentCommands},
+		{"many", defaultMaxConcurrentCommands},
+	}
+	for _, tt := range tests {
+		t.Setenv("CM_MAX_CONCURRENT_COMMANDS", tt.value)
+		if got := maxConcurrentCommands(); got != tt.want {
+			t.Errorf("CM_MAX_CONCURRENT_COMMANDS=%q: maxConcurrentCommands() = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+// fakeCPUSysfs lays out cpu<N>/cpufreq for each governor in current
+func fakeCPUSysfs(t *testing.T, current ...string) string {
+	t.Helper()
+	base := t.TempDir()
+	for i, governor := range current {
+		dir := filepath.Join(base, fmt.Sprintf("cpu%d", i), "cpufreq")
+		writeTestFile(t, filepath.Join(dir, "scaling_governor"), governor+"\n")
+		writeTestFile(t, filepath.Join(dir, "scaling_available_governors"), "conservative ondemand userspace powersave performance schedutil \n")
+	}
+	// Non-CPU entries sit alongside the cores in sysfs
+	writeTestFile(t, filepath.Join(base, "cpuidle", "current_driver"), "psci_idle\n")
+	return base
+}
+
+func TestReadCPUGovernors(t *testing.T) {
+	got, err := readCPUGovernors(fakeCPUSysfs(t, "ondemand", "performance"))
+	if err != nil {
+		t.Fatalf("readCPUGovernors() error = %v", err)
+	}
+	if want := map[string]string{"cpu0": "ondemand", "cpu1": "performance"}; !maps.Equal(got.Governors, want) {
+		t.Errorf("Governors = %v, want %v", got.Governors, want)
+	}
+	if want := []string{"conservative", "ondemand", "userspace", "powersave", "performance", "schedutil"}; !slices.Equal(got.Available, want) {
+		t.Errorf("Available = %q, want %q", got.Available, want)
+	}
+
+	if _, err := readCPUGovernors(t.TempDir()); err == nil {
+		t.Error("readCPUGovernors() without cpufreq succeeded, want an error")
+	}
+}
+
+func TestValidateCPUGovernor(t *testing.T) {
+	current, err := readCPUGovernors(fakeCPUSysfs(t, "ondemand"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		governor string
+		valid    bool
+	}{
+		{"powersave", true},
+		{"schedutil", true},
+		{"turbo", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := validateCPUGovernor(current.Available, tt.governor); (err == nil) != tt.valid {
+			t.Errorf("validateCPUGovernor(%q) error = %v, want valid = %v", tt.governor, err, tt.valid)
+		}
+	}
+}
+
+func TestWriteCPUGovernor(t *testing.T) {
+	base := fakeCPUSysfs(t, "ondemand", "ondemand", "performance")
+	if err := writeCPUGovernor(base, "powersave"); err != nil {
+		t.Fatalf("writeCPUGovernor() error = %v", err)
+	}
+
+	got, err := readCPUGovernors(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cpu, governor := range got.Governors {
+		if governor != "powersave" {
+			t.Errorf("%s governor = %q after write, want %q", cpu, governor, "powersave")
+		}
+	}
+}
+
+func TestClassifyInterface(t *testing.T) {
+	sys := t.TempDir()
+	// Names that don't hint at their kind, so only sysfs can classify them
+	writeTestFile(t, filepath.Join(sys, "radio0", "wireless", "phy80211"), "")
+	writeTestFile(t, filepath.Join(sys, "lan", "bridge", "stp_state"), "0\n")
+	writeTestFile(t, filepath.Join(sys, "vpn0", "type"), "65534\n")
+	writeTestFile(t, filepath.Join(sys, "uplink", "type"), "1\n")
+
+	tests := []struct {
+		name  string
+		flags net.Flags
+		want  string
+		linux bool
+	}{
+		{name: "lo", flags: net.FlagLoopback | net.FlagUp, want: "loopback"},
+		{name: "radio0", want: "wifi", linux: true},
+		{name: "lan", want: "bridge", linux: true},
+		{name: "vpn0", want: "tun", linux: true},
+		{name: "docker0", want: "docker"},
+		{name: "veth1a2b3c", want: "veth"},
+		{name: "br-lan", want: "bridge"},
+		{name: "wg0", want: "tun"},
+		{name: "wlan0", want: "wifi"},
+		{name: "wlp2s0", want: "wifi"},
+		{name: "eth0", want: "ethernet"},
+		{name: "enp3s0", want: "ethernet"},
+		{name: "uplink", want: "ethernet", linux: true},
+		{name: "can0", want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.linux && runtime.GOOS != "linux" {
+				t.Skip("sysfs classification is Linux-only")
+			}
+			if got := classifyInterface(tt.name, tt.flags, sys); got != tt.want {
+				t.Errorf("classifyInterface(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSelfRestartCommand(t *testing.T) {
+	tests := []struct {
+		initSystem string
+		want       []string
+		wantErr    bool
+	}{
+		{initSystem: "systemd", want: []string{"systemctl", "restart", "cm-utils"}},
+		{initSystem: "openrc", want: []string{"rc-service", "cm-utils", "restart"}},
+		{initSystem: "sysv", want: []string{"service", "cm-utils", "restart"}},
+		{initSystem: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.initSystem, func(t *testing.T) {
+			got, err := buildSelfRestartCommand(tt.initSystem, "cm-utils")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildSelfRestartCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("buildSelfRestartCommand() = %q, want %q", got, tt.want)
+			}
+			if len(got) > 0 && !execAllowlist[got[0]] {
+				t.Errorf("%s is not in the exec allowlist", got[0])
+			}
+		})
+	}
+}
+
+func TestSelfRestartHandlerDevelopmentMachine(t *testing.T) {
+	defer func(previous bool) { developmentMachine = previous }(developmentMachine)
+	developmentMachine = true
+	logs := captureLog(t)
+	calls := fakeCommands(t, map[string]string{"systemctl": "exit 0"})
+
+	app := &App{initSystem: "systemd", serviceName: "cm-utils", allowDestructive: true}
+	rec := httptest.NewRecorder()
+	app.requireDestructive(app.selfRestartHandler)(rec, httptest.NewRequest(http.MethodPost, "/api/self/restart", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"logged"`) {
+		t.Errorf("response = %d %s, want 200 with status logged", rec.Code, rec.Body)
+	}
+	if !strings.Contains(logs.String(), "logging action instead of restarting") {
+		t.Errorf("log = %q, want the development-machine message", logs.String())
+	}
+	if got := calls(); len(got) != 0 {
+		t.Errorf("ran %q on a development machine, want nothing", got)
+	}
+}
+
+func TestRequireDestructive(t *testing.T) {
+	tests := []struct {
+		name       string
+		allow      bool
+		wantStatus int
+	}{
+		{"disabled", false, http.StatusForbidden},
+		{"enabled", true, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{allowDestructive: tt.allow}
+			next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+			rec := httptest.NewRecorder()
+			app.requireDestructive(next)(rec, httptest.NewRequest(http.MethodPost, "/api/self/restart", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDestructiveActionsAllowed(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", true},
+		{"1", true},
+		{"true", true},
+		{"0", false},
+		{"false", false},
+		{"NO", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("CM_ALLOW_DESTRUCTIVE_ACTIONS", tt.value)
+		if got := destructiveActionsAllowed(); got != tt.want {
+			t.Errorf("CM_ALLOW_DESTRUCTIVE_ACTIONS=%q: destructiveActionsAllowed() = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDestructiveOptOutRoutes(t *testing.T) {
+	defer func(previous bool) { developmentMachine = previous }(developmentMachine)
+	developmentMachine = true
+	captureLog(t)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		// Opting out only switches off the self-restart, not the existing reboot
+		{"/api/self/restart", http.StatusForbidden},
+		{"/api/system/reboot", http.StatusOK},
+	}
+
+	app := newTestApp(t)
+	app.allowDestructive = false
+	routes := app.routes()
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+// captureLog redirects the standard logger for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &buf
+}
+
+const minimalKeyfile = `[connection]
+id=Office
+type=wifi
+
+[wifi]
+ssid=Office
+
+[wifi-security]
+key-mgmt=wpa-psk
+psk=supersecret
+`
+
+func TestValidateKeyfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantID  string
+		wantErr bool
+	}{
+		{name: "minimal wifi keyfile", content: minimalKeyfile, wantID: "Office"},
+		{name: "missing type", content: "[connection]\nid=Office\n", wantErr: true},
+		{name: "long-form wifi type", content: "[connection]\nid=Office\ntype=802-11-wireless\n", wantID: "Office"},
+		{name: "non-wifi type", content: "[connection]\nid=Uplink\ntype=ethernet\n", wantErr: true},
+		{name: "id outside connection section", content: "[wifi]\nid=Office\ntype=wifi\n", wantErr: true},
+		{name: "path in id", content: "[connection]\nid=../../etc/passwd\ntype=wifi\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := validateKeyfile(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateKeyfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if id != tt.wantID {
+				t.Errorf("validateKeyfile() id = %q, want %q", id, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestImportKeyfile(t *testing.T) {
+	calls := fakeCommands(t, map[string]string{"nmcli": "exit 0"})
+	dir := t.TempDir()
+
+	if err := importKeyfile(dir, "Office", []byte(minimalKeyfile)); err != nil {
+		t.Fatalf("importKeyfile() error = %v", err)
+	}
+
+	path := filepath.Join(dir, "Office.nmconnection")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("keyfile not installed: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("keyfile mode = %v, want 0600", info.Mode().Perm())
+	}
+	if want := []string{"nmcli connection load " + path}; !slices.Equal(calls(), want) {
+		t.Errorf("calls = %q, want %q", calls(), want)
+	}
+
+	// A second import under the same id must not replace the first
+	if err := importKeyfile(dir, "Office", []byte("[connection]\nid=Office\ntype=ethernet\n")); !errors.Is(err, errKeyfileExists) {
+		t.Errorf("second importKeyfile() error = %v, want errKeyfileExists", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != minimalKeyfile {
+		t.Errorf("existing keyfile was overwritten:\n%s", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("import left %d entries behind, want just the keyfile", len(entries))
+	}
+}
+
+func TestImportKeyfileLoadFailure(t *testing.T) {
+	fakeCommands(t, map[string]string{"nmcli": "echo 'invalid connection' >&2; exit 1"})
+	dir := t.TempDir()
+
+	if err := importKeyfile(dir, "Office", []byte(minimalKeyfile)); err == nil {
+		t.Fatal("importKeyfile() succeeded although nmcli failed to load it")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Office.nmconnection")); !os.IsNotExist(err) {
+		t.Errorf("keyfile left installed after a failed load (stat error %v)", err)
+	}
+}
+
+// useProcFixture points procPath at a temporary tree holding files (relative path -> content)
+func useProcFixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(dir, filepath.FromSlash(name)), content)
+	}
+	previous := procPath
+	procPath = dir
+	t.Cleanup(func() { procPath = previous })
+	return dir
+}
+
+func TestProcPathFixture(t *testing.T) {
+	useProcFixture(t, map[string]string{
+		"stat":                            "cpu  1 2 3 4\nbtime 1700000000\n",
+		"sys/kernel/random/entropy_avail": "3021\n",
+	})
+
+	if !procAvailable() {
+		t.Fatal("procAvailable() = false with a fixture /proc/stat")
+	}
+	if got, err := getBootTime(); err != nil || !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("getBootTime() = %v, %v; want the fixture btime", got, err)
+	}
+	if runtime.GOOS == "linux" {
+		rec := httptest.NewRecorder()
+		(&App{}).getEntropyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/system/entropy", nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"available":3021`) {
+			t.Errorf("entropy response = %d %s, want the fixture value", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestProcUnavailable(t *testing.T) {
+	useProcFixture(t, nil)
+
+	if procAvailable() {
+		t.Fatal("procAvailable() = true for an empty directory")
+	}
+	if _, err := getBootTime(); !errors.Is(err, errProcUnavailable) {
+		t.Errorf("getBootTime() error = %v, want errProcUnavailable", err)
+	}
+
+	rec := httptest.NewRecorder()
+	(&App{}).getMemoryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/system/memory", nil))
+	if rec.Code != http.StatusNotImplemented || !strings.Contains(rec.Body.String(), `"code":"not_supported"`) {
+		t.Errorf("memory response = %d %s, want 501 not_supported", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+}
+
+// scanFixture is a small scan result spanning bands, security types and signal strengths
+var scanFixture = []WiFiNetwork{
+	{SSID: "Office", Signal: "82", Security: "WPA2", Band: "5GHz"},
+	{SSID: "Office-Guest", Signal: "76", Security: "Open", Band: "2.4GHz"},
+	{SSID: "Warehouse", Signal: "40", Security: "WPA2", Band: "2.4GHz"},
+	{SSID: "Lab", Signal: "55", Security: "WPA3", Band: "6GHz"},
+	{SSID: "Printer", Signal: "30", Security: "WEP"},
+}
+
+func TestSummarizeScan(t *testing.T) {
+	got := summarizeScan(scanFixture, 2345*time.Millisecond)
+
+	if got.DurationMs != 2345 || got.APCount != len(scanFixture) {
+		t.Errorf("duration/count = %d/%d, want 2345/%d", got.DurationMs, got.APCount, len(scanFixture))
+	}
+	if want := map[string]int{"2.4GHz": 2, "5GHz": 1, "6GHz": 1, "unknown": 1}; !maps.Equal(got.Bands, want) {
+		t.Errorf("Bands = %v, want %v", got.Bands, want)
+	}
+	if want := map[string]int{"WPA2": 2, "Open": 1, "WPA3": 1, "WEP": 1}; !maps.Equal(got.Security, want) {
+		t.Errorf("Security = %v, want %v", got.Security, want)
+	}
+}
+
+func TestFrequencyToBand(t *testing.T) {
+	tests := []struct {
+		freq int
+		want string
+	}{
+		{2412, "2.4GHz"},
+		{2484, "2.4GHz"},
+		{5180, "5GHz"},
+		{5885, "5GHz"},
+		{5955, "6GHz"},
+		{7115, "6GHz"},
+		{60480, ""},
+	}
+	for _, tt := range tests {
+		if got := frequencyToBand(tt.freq); got != tt.want {
+			t.Errorf("frequencyToBand(%d) = %q, want %q", tt.freq, got, tt.want)
+		}
+	}
+}
+
+func ssidsOf(networks []WiFiNetwork) []string {
+	ssids := []string{}
+	for _, network := range networks {
+		ssids = append(ssids, network.SSID)
+	}
+	return ssids
+}
+
+func TestFilterNetworks(t *testing.T) {
+	tests := []struct {
+		security  string
+		minSignal int
+		want      []string
+	}{
+		{"all", 0, []string{"Office", "Office-Guest", "Warehouse", "Lab", "Printer"}},
+		{"secured", 0, []string{"Office", "Warehouse", "Lab", "Printer"}},
+		{"open", 0, []string{"Office-Guest"}},
+		{"all", 55, []string{"Office", "Office-Guest", "Lab"}},
+		{"all", 56, []string{"Office", "Office-Guest"}},
+		{"secured", 55, []string{"Office", "Lab"}},
+		{"open", 77, []string{}},
+		{"all", 101, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.security, tt.minSignal), func(t *testing.T) {
+			if got := ssidsOf(filterNetworks(scanFixture, tt.security, tt.minSignal)); !slices.Equal(got, tt.want) {
+				t.Errorf("filterNetworks(%q, %d) = %q, want %q", tt.security, tt.minSignal, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSmartctlOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "ata disk",
+			output: `{
+  "json_format_version": [1, 0],
+  "smartctl": {"version": [7, 3], "exit_status": 4},
+  "device": {"name": "/dev/sda", "type": "sat"},
+  "smart_status": {"passed": true},
+  "ata_smart_attributes": {"revision": 16, "table": [
+    {"id": 5, "name": "Reallocated_Sector_Ct", "value": 100, "raw": {"value": 8, "string": "8"}},
+    {"id": 9, "name": "Power_On_Hours", "value": 95, "raw": {"value": 20311, "string": "20311"}}
+  ]},
+  "power_on_time": {"hours": 20311},
+  "temperature": {"current": 38}
+}`,
+			want: `{"device":"sda","health":"PASSED","reallocated_sectors":8,"temperature_c":38,"power_on_hours":20311}`,
+		},
+		{
+			name:   "failing nvme without an attribute table",
+			output: `{"smart_status": {"passed": false}, "temperature": {"current": 71}}`,
+			want:   `{"device":"sda","health":"FAILED","temperature_c":71}`,
+		},
+		{
+			name:   "no smart support",
+			output: `{"smartctl": {"exit_status": 2, "messages": [{"string": "Unknown USB bridge", "severity": "error"}]}}`,
+			want:   `{"device":"sda","health":"UNKNOWN"}`,
+		},
+		{name: "not json", output: "smartctl: command failed", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSmartctlOutput("sda", []byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSmartctlOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if data, _ := json.Marshal(got); string(data) != tt.want {
+				t.Errorf("parseSmartctlOutput() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockDeviceExists(t *testing.T) {
+	base := t.TempDir()
+	writeTestFile(t, filepath.Join(base, "sda", "size"), "0\n")
+
+	tests := []struct {
+		device string
+		want   bool
+	}{
+		{"sda", true},
+		{"sdb", false},
+		{"", false},
+		{"../sda", false},
+		{".", false},
+	}
+	for _, tt := range tests {
+		if got := blockDeviceExists(base, tt.device); got != tt.want {
+			t.Errorf("blockDeviceExists(%q) = %v, want %v", tt.device, got, tt.want)
+		}
+	}
+}
+
+// noRealReboots makes sure a test that fires a reboot timer only logs it
+func noRealReboots(t *testing.T) {
+	t.Helper()
+	previous := developmentMachine
+	developmentMachine = true
+	t.Cleanup(func() { developmentMachine = previous })
+	fakeCommands(t, map[string]string{"reboot": "exit 1", "systemctl": "exit 1", "shutdown": "exit 1"})
+}
+
+func TestPendingRebootClearedOnCancel(t *testing.T) {
+	noRealReboots(t)
+	app := &App{stateDir: t.TempDir()}
+
+	if err := app.scheduleReboot(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("scheduleReboot() error = %v", err)
+	}
+	if app.PendingReboot() == nil {
+		t.Fatal("PendingReboot() = nil after scheduling")
+	}
+	if _, err := os.Stat(app.rebootScheduleFile()); err != nil {
+		t.Fatalf("schedule not persisted: %v", err)
+	}
+
+	if !app.cancelReboot() {
+		t.Fatal("cancelReboot() = false with a pending reboot")
+	}
+	if app.PendingReboot() != nil {
+		t.Error("PendingReboot() still set after cancel")
+	}
+	if _, err := os.Stat(app.rebootScheduleFile()); !os.IsNotExist(err) {
+		t.Errorf("schedule file still present after cancel (stat error %v)", err)
+	}
+	if app.cancelReboot() {
+		t.Error("second cancelReboot() = true, want false")
+	}
+}
+
+// logSignal closes fired once a log line containing match is written
+type logSignal struct {
+	match string
+	fired chan struct{}
+	once  sync.Once
+}
+
+func (l *logSignal) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte(l.match)) {
+		l.once.Do(func() { close(l.fired) })
+	}
+	return len(p), nil
+}
+
+func TestPendingRebootClearedWhenElapsed(t *testing.T) {
+	noRealReboots(t)
+	app := &App{stateDir: t.TempDir()}
+	// The timer goroutine reads developmentMachine after clearing the schedule, so the test
+	// must not restore it (or PATH) until the goroutine has finished
+	fired := &logSignal{match: "Scheduled reboot fired", fired: make(chan struct{})}
+	previous := log.Writer()
+	log.SetOutput(fired)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	if err := app.scheduleReboot(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("scheduleReboot() error = %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for app.PendingReboot() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("PendingReboot() still set after the scheduled time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := os.Stat(app.rebootScheduleFile()); !os.IsNotExist(err) {
+		t.Errorf("schedule file still present after firing (stat error %v)", err)
+	}
+	select {
+	case <-fired.fired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("scheduled reboot never reported firing")
+	}
+}
+
+func TestRestoreRebootSchedule(t *testing.T) {
+	tests := []struct {
+		name        string
+		at          time.Time
+		wantPending bool
+	}{
+		{"future schedule is re-armed", time.Now().Add(time.Hour), true},
+		{"elapsed schedule is dropped", time.Now().Add(-time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			noRealReboots(t)
+			app := &App{stateDir: t.TempDir()}
+			if err := saveJSONState(app.rebootScheduleFile(), PendingReboot{ScheduledAt: tt.at.Format(time.RFC3339)}); err != nil {
+				t.Fatal(err)
+			}
+
+			app.restoreRebootSchedule()
+			defer app.cancelReboot()
+
+			if got := app.PendingReboot() != nil; got != tt.wantPending {
+				t.Errorf("pending after restore = %v, want %v", got, tt.wantPending)
+			}
+			if _, err := os.Stat(app.rebootScheduleFile()); os.IsNotExist(err) == tt.wantPending {
+				t.Errorf("schedule file present = %v, want %v", err == nil, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestMatchProcessesByName(t *testing.T) {
+	processes := []Process{
+		{PID: 101, Name: "python3"},
+		{PID: 102, Name: "/usr/bin/python3"},
+		{PID: 103, Name: "python3.11"},
+		{PID: 104, Name: "nginx"},
+		{PID: os.Getpid(), Name: "python3"},
+	}
+
+	tests := []struct {
+		name string
+		want []int
+	}{
+		{"python3", []int{101, 102}},
+		{"nginx", []int{104}},
+		{"python", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := matchProcessesByName(processes, tt.name); !slices.Equal(got, tt.want) {
+			t.Errorf("matchProcessesByName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKillProcessesByNameGuards(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"protected name", `{"name":"sshd"}`, http.StatusForbidden},
+		{"protected path", `{"name":"/lib/systemd/systemd"}`, http.StatusForbidden},
+		{"protected init", `{"name":"init","signal":"KILL"}`, http.StatusForbidden},
+		{"missing name", `{"signal":"TERM"}`, http.StatusBadRequest},
+		{"unknown signal", `{"name":"python3","signal":"STOP"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			(&App{}).killProcessesByNameHandler(rec, httptest.NewRequest(http.MethodPost, "/api/processes/kill-by-name", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+// newTestApp returns an App with the real templates and a throwaway state directory
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	return &App{
+		templates:   template.Must(template.ParseFS(templateFS, "src/templates/*.html")),
+		startTime:   time.Now(),
+		stateDir:    t.TempDir(),
+		serviceName: defaultServiceName,
+	}
+}
+
+func TestWriteErrorNegotiation(t *testing.T) {
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{"json client", "application/json", "application/json", `{"error":"Interface not found: eth9"}`},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html; charset=utf-8", "Interface not found: eth9"},
+		{"both listed", "text/html, application/json", "application/json", `{"error":`},
+		{"no accept header", "", "application/json", `{"error":`},
+	}
+
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/interfaces/eth9", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			app.writeError(rec, req, http.StatusNotFound, "Interface not found: eth9")
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body, tt.wantBody)
+			}
+			if strings.HasPrefix(tt.wantContentType, "text/html") && !strings.Contains(rec.Body.String(), "<html") {
+				t.Errorf("body is not an HTML page: %q", rec.Body)
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	captureLog(t)
+	handler := app.recoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), `"error":"Internal server error"`) {
+		t.Errorf("response = %d %s, want a JSON 500", rec.Code, rec.Body)
+	}
+}
+
+const psAuxFixture = `USER         PID %CPU %MEM    VSZ   RSS TTY      STAT START   TIME COMMAND
+root           1  0.0  0.3 167764 12876 ?        Ss   Oct13   0:04 /sbin/init
+root           2  0.0  0.0      0     0 ?        S    Oct13   0:00 [kthreadd]
+root         612  0.1  0.5  23340  9876 ?        Ss   Oct13   1:02 /usr/sbin/NetworkManager --no-daemon
+pi          1042  2.5  4.1 812344 80212 ?        Sl   Oct13  12:40 /usr/bin/python3 /opt/app/server.py
+www-data    1200  0.3  1.2  55012 24010 ?        S    Oct13   0:30 nginx: worker process
+`
+
+func TestProcessesConditionalGet(t *testing.T) {
+	fakeCommands(t, map[string]string{"ps": "cat <<'EOF'\n" + psAuxFixture + "EOF"})
+	app := newTestApp(t)
+
+	first := httptest.NewRecorder()
+	app.getProcessesHandler(first, httptest.NewRequest(http.MethodGet, "/api/processes", nil))
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first response = %d with ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/processes", nil)
+	req.Header.Set("If-None-Match", etag)
+	second := httptest.NewRecorder()
+	app.getProcessesHandler(second, req)
+	if second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+		t.Errorf("second response = %d with %d body bytes, want an empty 304", second.Code, second.Body.Len())
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := weakETag([]byte(`[{"pid":1}]`))
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{etag, true},
+		{`"other", ` + etag, true},
+		{"*", true},
+		{strings.TrimPrefix(etag, "W/"), true},
+		{`W/"other"`, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.ifNoneMatch, etag, got, tt.want)
+		}
+	}
+	if weakETag([]byte("a")) == weakETag([]byte("b")) {
+		t.Error("weakETag() is the same for different bodies")
+	}
+}
+
+const passwdFixture = `root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+# a comment line
+pi:x:1000:1000:,,,:/home/pi:/bin/bash
+pi-alias:x:1000:1000::/home/pi:/bin/bash
+www-data:x:33:33:www-data:/var/www:/usr/sbin/nologin
+`
+
+// usePasswdFixture points resolveUser at a fixture passwd file
+func usePasswdFixture(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "passwd")
+	writeTestFile(t, path, content)
+
+	previous := passwdPath
+	passwdPath, passwdOnce, passwdUsers = path, sync.Once{}, nil
+	t.Cleanup(func() { passwdPath, passwdOnce, passwdUsers = previous, sync.Once{}, nil })
+}
+
+func TestParsePasswd(t *testing.T) {
+	want := map[string]string{"0": "root", "1": "daemon", "1000": "pi", "33": "www-data"}
+	if got := parsePasswd(passwdFixture); !maps.Equal(got, want) {
+		t.Errorf("parsePasswd() = %v, want %v", got, want)
+	}
+}
+
+func TestPsEfResolvesUIDs(t *testing.T) {
+	usePasswdFixture(t, passwdFixture)
+
+	output := `UID          PID    PPID  C STIME TTY          TIME CMD
+0              1       0  0 Oct13 ?        00:00:04 /sbin/init
+1000        1042       1  2 Oct13 ?        00:12:40 /usr/bin/python3 /opt/app/server.py
+33          1200       1  0 Oct13 ?        00:00:30 nginx: worker process
+4242        1300       1  0 Oct13 ?        00:00:01 /opt/orphan
+syslog       800       1  0 Oct13 ?        00:00:02 /usr/sbin/rsyslogd -n
+`
+	processes, err := parsePsEfOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, process := range processes {
+		got = append(got, process.User)
+	}
+	if want := []string{"root", "pi", "www-data", "4242", "syslog"}; !slices.Equal(got, want) {
+		t.Errorf("users = %q, want %q", got, want)
+	}
+}
+
+func TestSdNotifyWritesToSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not available")
+	}
+	// t.TempDir can exceed the unix socket path limit
+	dir, err := os.MkdirTemp("", "sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+
+	for _, payload := range []string{"READY=1", "WATCHDOG=1", "STOPPING=1"} {
+		if err := sdNotify(payload); err != nil {
+			t.Fatalf("sdNotify(%q) error = %v", payload, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("reading %q from the socket: %v", payload, err)
+		}
+		if got := string(buf[:n]); got != payload {
+			t.Errorf("socket received %q, want %q", got, payload)
+		}
+	}
+}
+
+func TestSdNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("sdNotify() without NOTIFY_SOCKET error = %v, want nil", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{"disabled", "", "", 0},
+		{"half the timeout", "30000000", "", 15 * time.Second},
+		{"for this process", "10000000", strconv.Itoa(os.Getpid()), 5 * time.Second},
+		{"for another process", "10000000", "1", 0},
+		{"malformed", "soon", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			if got := watchdogInterval(); got != tt.want {
+				t.Errorf("watchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFirewallRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		parse  func(string) []FirewallChain
+		output string
+		want   []FirewallChain
+	}{
+		{
+			name:  "iptables-save",
+			parse: parseIptablesSave,
+			output: `# Generated by iptables-save v1.8.9 on Tue Oct 14 09:00:00 2026
+*filter
+:INPUT DROP [0:0]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [120:9120]
+:f2b-sshd - [0:0]
+-A INPUT -i lo -j ACCEPT
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 22 -j f2b-sshd
+-A f2b-sshd -j RETURN
+COMMIT
+*nat
+:PREROUTING ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+-A POSTROUTING -o eth0 -j MASQUERADE
+COMMIT
+`,
+			want: []FirewallChain{
+				{Table: "filter", Name: "INPUT", Rules: 3},
+				{Table: "filter", Name: "FORWARD"},
+				{Table: "filter", Name: "OUTPUT"},
+				{Table: "filter", Name: "f2b-sshd", Rules: 1},
+				{Table: "nat", Name: "PREROUTING"},
+				{Table: "nat", Name: "POSTROUTING", Rules: 1},
+			},
+		},
+		{
+			name:  "nft ruleset",
+			parse: parseNftRuleset,
+			output: `table inet filter {
+	chain input {
+		type filter hook input priority filter; policy drop;
+		iif "lo" accept
+		ct state established,related accept
+		tcp dport 22 accept
+	}
+	chain output {
+		type filter hook output priority filter; policy accept;
+	}
+}
+table ip nat {
+	chain postrouting {
+		type nat hook postrouting priority srcnat; policy accept;
+		oifname "eth0" masquerade
+	}
+}
+`,
+			want: []FirewallChain{
+				{Table: "inet filter", Name: "input", Rules: 3},
+				{Table: "inet filter", Name: "output"},
+				{Table: "ip nat", Name: "postrouting", Rules: 1},
+			},
+		},
+		{name: "empty", parse: parseIptablesSave, output: "", want: []FirewallChain{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.parse(tt.output); !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidCloneMAC(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"random", true},
+		{"stable", true},
+		{"permanent", true},
+		{"02:11:22:33:44:55", true},
+		{"Random", false},
+		{"preserve", false},
+		{"02:11:22:33:44", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validCloneMAC(tt.value); got != tt.valid {
+			t.Errorf("validCloneMAC(%q) = %v, want %v", tt.value, got, tt.valid)
+		}
+		req := ConnectionRequest{SSID: "Office", Security: "Open", CloneMAC: tt.value}
+		if got := hasFieldError(validateConnectionRequest(req), "clone_mac"); tt.value != "" && got == tt.valid {
+			t.Errorf("clone_mac %q: field error = %v, want valid = %v", tt.value, got, tt.valid)
+		}
+	}
+}
+
+func TestBuildClonedMACConnectArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ConnectionRequest
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "keyword",
+			req:  ConnectionRequest{SSID: "Office", Password: "supersecret", Security: "WPA2", CloneMAC: "random"},
+			want: []string{"connection", "add", "type", "wifi", "con-name", "Office", "ifname", "wlan0", "ssid", "Office",
+				"wifi-sec.key-mgmt", "wpa-psk", "wifi-sec.psk", "supersecret", "802-11-wireless.cloned-mac-address", "random"},
+		},
+		{
+			name: "address and bssid on an open network",
+			req:  ConnectionRequest{SSID: "Cafe", Security: "Open", BSSID: "AA:BB:CC:DD:EE:FF", CloneMAC: "02:11:22:33:44:55"},
+			want: []string{"connection", "add", "type", "wifi", "con-name", "Cafe", "ifname", "wlan0", "ssid", "Cafe",
+				"802-11-wireless.bssid", "AA:BB:CC:DD:EE:FF", "802-11-wireless.cloned-mac-address", "02:11:22:33:44:55"},
+		},
+		{
+			name:    "unknown security",
+			req:     ConnectionRequest{SSID: "Office", Password: "supersecret", Security: "WPA4", CloneMAC: "random"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildClonedMACConnectArgs(tt.req, "wlan0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildClonedMACConnectArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("buildClonedMACConnectArgs() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildProvisionArgs(t *testing.T) {
+	profile := []string{"connection", "add", "type", "wifi", "con-name", "Office", "ifname", "wlan0", "ssid", "Office"}
+	tests := []struct {
+		name    string
+		req     ProvisionRequest
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "open",
+			req:  ProvisionRequest{SSID: "Office", Security: "Open"},
+			want: profile,
+		},
+		{
+			name: "wpa3 with static ipv4",
+			req: ProvisionRequest{SSID: "Office", Password: "supersecret", Security: "WPA3",
+				IPv4: &StaticIPv4Config{Address: "192.168.1.50/24", Gateway: "192.168.1.1", DNS: []string{"1.1.1.1", "8.8.8.8"}}},
+			want: append(slices.Clone(profile), "wifi-sec.key-mgmt", "sae", "wifi-sec.psk", "supersecret",
+				"ipv4.method", "manual", "ipv4.addresses", "192.168.1.50/24", "ipv4.gateway", "192.168.1.1", "ipv4.dns", "1.1.1.1 8.8.8.8"),
+		},
+		{
+			name:    "unknown security",
+			req:     ProvisionRequest{SSID: "Office", Password: "supersecret", Security: "WPA4"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildProvisionArgs(tt.req, "wlan0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildProvisionArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("buildProvisionArgs() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// /proc/net fixtures below are captured from a little-endian machine
+func skipOnBigEndian(t *testing.T) {
+	t.Helper()
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixture addresses are in little-endian byte order")
+	}
+}
+
+const procNetTCPFixture = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 12345 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0035 00000000:0000 0A 00000000:00000000 00:00000000 00000000   101        0 22222 1 0000000000000000 100 0 0 10 0
+   2: 0B01A8C0:1F90 1401A8C0:C350 01 00000000:00000000 02:000A7D6A 00000000     0        0 12346 2 0000000000000000 20 4 30 10 -1
+   3: 0B01A8C0:1F90 1501A8C0:C351 06 00000000:00000000 03:00001723 00000000     0        0 0 3 0000000000000000
+`
+
+// linkFakeFD makes /proc/<pid>/fd/<fd> in a fixture point at target, as the kernel does
+func linkFakeFD(t *testing.T, proc string, pid, fd int, target string) {
+	t.Helper()
+	dir := filepath.Join(proc, strconv.Itoa(pid), "fd")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, strconv.Itoa(fd))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessSocketsFromFakeProc(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the handler only serves /proc on Linux")
+	}
+	skipOnBigEndian(t)
+	proc := useProcFixture(t, map[string]string{"stat": "btime 1700000000\n", "net/tcp": procNetTCPFixture})
+	linkFakeFD(t, proc, 4242, 0, "/dev/null")
+	linkFakeFD(t, proc, 4242, 3, "socket:[12345]")
+	linkFakeFD(t, proc, 4242, 4, "socket:[12346]")
+	linkFakeFD(t, proc, 4242, 5, "pipe:[99999]")
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/processes/4242/sockets", nil), map[string]string{"pid": "4242"})
+	rec := httptest.NewRecorder()
+	(&App{}).getProcessSocketsHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body)
+	}
+
+	var got []ProcessSocket
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []ProcessSocket{
+		{Protocol: "tcp", LocalAddress: "0.0.0.0:8080", RemoteAddress: "0.0.0.0:0", State: "LISTEN", Inode: "12345"},
+		{Protocol: "tcp", LocalAddress: "192.168.1.11:8080", RemoteAddress: "192.168.1.20:50000", State: "ESTABLISHED", Inode: "12346"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("sockets =\n%+v\nwant\n%+v", got, want)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/processes/4243/sockets", nil), map[string]string{"pid": "4243"})
+	rec = httptest.NewRecorder()
+	(&App{}).getProcessSocketsHandler(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown pid status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDeviceLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		label    string
+		wantPage string
+	}{
+		{"labelled", "Line 3 <PLC>", "Line 3 &lt;PLC&gt;"},
+		{"unlabelled", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useProcFixture(t, nil)
+			app := newTestApp(t)
+			app.deviceLabel = tt.label
+
+			page := httptest.NewRecorder()
+			app.homeHandler(page, httptest.NewRequest(http.MethodGet, "/", nil))
+			if tt.wantPage != "" && !strings.Contains(page.Body.String(), tt.wantPage) {
+				t.Errorf("home page doesn't show the label %q", tt.wantPage)
+			}
+			if tt.label == "" && strings.Contains(page.Body.String(), "&lt;PLC&gt;") {
+				t.Error("home page shows a label that isn't configured")
+			}
+
+			rec := httptest.NewRecorder()
+			app.getSystemInfoHandler(rec, httptest.NewRequest(http.MethodGet, "/api/info", nil))
+			var info SystemInfo
+			if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+				t.Fatal(err)
+			}
+			if info.DeviceLabel != tt.label {
+				t.Errorf("info device_label = %q, want %q", info.DeviceLabel, tt.label)
+			}
+		})
+	}
+}
+
+// fakeNmcliScan answers "dev wifi list" with listing, and fails a rescan with rescanStderr
+// when that is set
+func fakeNmcliScan(rescanStderr, listing string) string {
+	return fmt.Sprintf(`case "$*" in
+*rescan*) [ -n %[1]q ] && { echo %[1]q >&2; exit 1; }; exit 0 ;;
+*"wifi list"*) printf '%%b' %[2]q ;;
+esac`, rescanStderr, listing)
+}
+
+const nmcliScanFixture = "Office:82:WPA2:5180 MHz\nOffice-Guest:76::2437 MHz\n--:20:WPA2:2412 MHz\n"
+
+func TestScanWiFiNetworksRescanErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		stderr  string
+		wantErr bool
+	}{
+		{"already scanning", "Error: Scanning not allowed while already scanning.", false},
+		{"alternate wording", "Error: Device is already scanning", false},
+		{"real failure", "Error: No Wi-Fi device found.", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommands(t, map[string]string{"nmcli": fakeNmcliScan(tt.stderr, nmcliScanFixture)})
+			networks, err := scanWiFiNetworks(context.Background(), "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scanWiFiNetworks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := ssidsOf(networks); !slices.Equal(got, []string{"Office", "Office-Guest"}) {
+				t.Errorf("networks = %q, want the cached list", got)
+			}
+		})
+	}
+}
+
+func TestSysctlPath(t *testing.T) {
+	proc := useProcFixture(t, map[string]string{
+		"stat":                    "btime 1700000000\n",
+		"sys/net/ipv4/ip_forward": "0\n",
+		"sys/vm/swappiness":       "60\n",
+		"secret":                  "outside /proc/sys\n",
+	})
+
+	tests := []struct {
+		key      string
+		wantPath string
+	}{
+		{key: "net.ipv4.ip_forward", wantPath: filepath.Join(proc, "sys", "net", "ipv4", "ip_forward")},
+		{key: "vm.swappiness", wantPath: filepath.Join(proc, "sys", "vm", "swappiness")},
+		{key: "net.ipv4"},
+		{key: "vm.nosuchkey"},
+		{key: "../secret"},
+		{key: "net/../../secret"},
+		{key: "..secret"},
+		{key: "vm..swappiness"},
+		{key: "swappiness"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			path, err := sysctlPath(tt.key)
+			if tt.wantPath == "" {
+				if err == nil {
+					t.Errorf("sysctlPath(%q) = %q, want it rejected", tt.key, path)
+				}
+				return
+			}
+			if err != nil || path != tt.wantPath {
+				t.Errorf("sysctlPath(%q) = %q, %v; want %q", tt.key, path, err, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestGetSysctlAllowlist(t *testing.T) {
+	useProcFixture(t, map[string]string{
+		"stat":                    "btime 1700000000\n",
+		"sys/net/ipv4/ip_forward": "1\n",
+		"sys/kernel/panic":        "10\n",
+	})
+
+	tests := []struct {
+		name       string
+		allowlist  string
+		key        string
+		wantStatus int
+	}{
+		{"allowlisted", "", "net.ipv4.ip_forward", http.StatusOK},
+		{"not on the default allowlist", "", "kernel.panic", http.StatusForbidden},
+		{"custom allowlist", "kernel.panic", "kernel.panic", http.StatusOK},
+		{"custom allowlist replaces the default", "kernel.panic", "net.ipv4.ip_forward", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CM_SYSCTL_ALLOWLIST", tt.allowlist)
+			rec := httptest.NewRecorder()
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/system/sysctl/"+tt.key, nil), map[string]string{"key": tt.key})
+			(&App{}).getSysctlHandler(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestSetSysctlAllowlist(t *testing.T) {
+	proc := useProcFixture(t, map[string]string{
+		"stat":                    "btime 1700000000\n",
+		"sys/net/ipv4/ip_forward": "0\n",
+		"sys/kernel/panic":        "0\n",
+	})
+
+	tests := []struct {
+		name       string
+		allowlist  string
+		body       string
+		wantStatus int
+		wantValue  map[string]string
+	}{
+		{"allowlisted", "", `{"key":"net.ipv4.ip_forward","value":"1"}`, http.StatusOK, map[string]string{"sys/net/ipv4/ip_forward": "1"}},
+		{"not on the default allowlist", "", `{"key":"kernel.panic","value":"10"}`, http.StatusForbidden, map[string]string{"sys/kernel/panic": "0\n"}},
+		{"custom allowlist", "kernel.panic", `{"key":"kernel.panic","value":"10"}`, http.StatusOK, map[string]string{"sys/kernel/panic": "10"}},
+		{"custom allowlist replaces the default", "kernel.panic", `{"key":"net.ipv4.ip_forward","value":"1"}`, http.StatusForbidden, nil},
+		{"multi-line value", "", `{"key":"net.ipv4.ip_forward","value":"1\n0"}`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CM_SYSCTL_ALLOWLIST", tt.allowlist)
+			rec := httptest.NewRecorder()
+			(&App{}).setSysctlHandler(rec, httptest.NewRequest(http.MethodPost, "/api/system/sysctl", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			for file, want := range tt.wantValue {
+				if data, _ := os.ReadFile(filepath.Join(proc, filepath.FromSlash(file))); string(data) != want {
+					t.Errorf("%s = %q, want %q", file, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"static version", "/api/version", fmt.Sprintf("public, max-age=%d", int(staticCacheMaxAge.Seconds()))},
+		{"dynamic error log", "/api/wifi/errors", "no-store"},
+		{"dynamic interface history", "/api/interfaces/history", "no-store"},
+	}
+
+	routes := newTestApp(t).routes()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The ETag-carrying process list must revalidate rather than be cached blindly
+	rec := httptest.NewRecorder()
+	revalidate(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/processes", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("revalidate Cache-Control = %q, want no-cache", got)
+	}
+}
+
+func TestInterfaceErrorDeltas(t *testing.T) {
+	writeCounters := func(dir string, values map[string]string) {
+		for file, value := range values {
+			writeTestFile(t, filepath.Join(dir, "eth0", "statistics", file), value+"\n")
+		}
+	}
+
+	tests := []struct {
+		name   string
+		first  map[string]string
+		second map[string]string
+		want   InterfaceErrorCounters
+	}{
+		{
+			"counters grow",
+			map[string]string{"rx_errors": "3", "tx_errors": "0", "rx_dropped": "10", "tx_dropped": "1", "collisions": "0"},
+			map[string]string{"rx_errors": "5", "tx_errors": "2", "rx_dropped": "10", "tx_dropped": "4", "collisions": "1"},
+			InterfaceErrorCounters{RxErrors: 2, TxErrors: 2, TxDropped: 3, Collisions: 1},
+		},
+		{
+			"driver reset counts from zero",
+			map[string]string{"rx_errors": "100", "tx_errors": "7", "rx_dropped": "50", "tx_dropped": "0", "collisions": "0"},
+			map[string]string{"rx_errors": "4", "tx_errors": "9", "rx_dropped": "50", "tx_dropped": "0", "collisions": "0"},
+			InterfaceErrorCounters{RxErrors: 4, TxErrors: 2},
+		},
+	}
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			app := &App{}
+
+			writeCounters(dir, tt.first)
+			counters, err := readInterfaceErrorCounters(dir, "eth0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first := app.recordInterfaceErrors("eth0", counters, start); first.Deltas != nil {
+				t.Errorf("first sample deltas = %+v, want nil", first.Deltas)
+			}
+
+			writeCounters(dir, tt.second)
+			counters, err = readInterfaceErrorCounters(dir, "eth0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			second := app.recordInterfaceErrors("eth0", counters, start.Add(30*time.Second))
+			if second.Deltas == nil || *second.Deltas != tt.want {
+				t.Errorf("deltas = %+v, want %+v", second.Deltas, tt.want)
+			}
+			if second.IntervalSeconds != 30 {
+				t.Errorf("interval = %v, want 30", second.IntervalSeconds)
+			}
+		})
+	}
+
+	if _, err := readInterfaceErrorCounters(t.TempDir(), "eth0"); err == nil {
+		t.Error("missing statistics directory: want error")
+	}
+}
+
+func TestParseAddedConnectionUUID(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"added", "Connection 'Office' (5f9c1b0e-2a4d-4c1e-9e7a-0d3b8f6a2c11) successfully added.\n", "5f9c1b0e-2a4d-4c1e-9e7a-0d3b8f6a2c11"},
+		{"warning before the message", "Warning: password will be stored in plain text.\nConnection 'Lab' (A1B2C3D4-0000-1111-2222-333344445555) successfully added.\n", "A1B2C3D4-0000-1111-2222-333344445555"},
+		{"no uuid", "Error: connection.interface-name: 'wlan9': interface not found\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAddedConnectionUUID(tt.output); got != tt.want {
+				t.Errorf("parseAddedConnectionUUID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddAndActivateProfile(t *testing.T) {
+	const uuid = "5f9c1b0e-2a4d-4c1e-9e7a-0d3b8f6a2c11"
+	const list = "nmcli -t -f NAME,TYPE connection show"
+	tests := []struct {
+		name      string
+		saved     string
+		upExit    int
+		wantErr   bool
+		wantCalls []string
+	}{
+		{"activates the new profile", "", 0, false, []string{
+			list,
+			"nmcli connection add type wifi con-name Office ssid Office",
+			"nmcli connection up uuid " + uuid,
+		}},
+		{"replaces a saved profile of the same name", "Office:802-11-wireless", 0, false, []string{
+			list,
+			"nmcli connection delete id Office",
+			"nmcli connection add type wifi con-name Office ssid Office",
+			"nmcli connection up uuid " + uuid,
+		}},
+		{"rolls back when activation fails", "", 4, true, []string{
+			list,
+			"nmcli connection add type wifi con-name Office ssid Office",
+			"nmcli connection up uuid " + uuid,
+			"nmcli connection delete uuid " + uuid,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{"nmcli": fmt.Sprintf(`case "$*" in
+"-t -f NAME,TYPE connection show") echo %q ;;
+"connection add"*) echo "Connection 'Office' (%s) successfully added." ;;
+"connection up"*) echo "Error: Connection activation failed: Secrets were required" >&2; exit %d ;;
+esac`, tt.saved, uuid, tt.upExit)})
+
+			err := addAndActivateProfile("Office", []string{"connection", "add", "type", "wifi", "con-name", "Office", "ssid", "Office"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("addAndActivateProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls(); !slices.Equal(got, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestBuildRouterModeCommands(t *testing.T) {
+	commands := buildRouterModeCommands("eth0", "wlan0")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"masquerade out of wan", "add rule ip " + routerTable + " postrouting oifname eth0 masquerade"},
+		{"lan to wan forward", "add rule ip " + routerTable + " forward iifname wlan0 oifname eth0 accept"},
+		{"return traffic", "add rule ip " + routerTable + " forward iifname eth0 oifname wlan0 ct state related,established accept"},
+	}
+
+	joined := make([]string, len(commands))
+	for i, args := range commands {
+		joined[i] = strings.Join(args, " ")
+	}
+	if joined[0] != "add table ip "+routerTable {
+		t.Errorf("first command = %q, want the table created first", joined[0])
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !slices.Contains(joined, tt.want) {
+				t.Errorf("commands %q missing %q", joined, tt.want)
+			}
+		})
+	}
+
+	if got, want := strings.Join(buildRouterTeardownCommand(), " "), "delete table ip "+routerTable; got != want {
+		t.Errorf("teardown = %q, want %q", got, want)
+	}
+}
+
+func TestRouterModeRestoresIPForward(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+	}{
+		{"forwarding was off", "0"},
+		{"forwarding was already on", "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := useProcFixture(t, map[string]string{"sys/net/ipv4/ip_forward": tt.original + "\n"})
+			calls := fakeCommands(t, map[string]string{"nft": "exit 0"})
+			statePath := filepath.Join(t.TempDir(), "router-mode.json")
+			forward := func() string {
+				data, _ := os.ReadFile(filepath.Join(proc, "sys", "net", "ipv4", "ip_forward"))
+				return strings.TrimSpace(string(data))
+			}
+
+			if err := enableRouterMode(statePath, "eth0", "wlan0"); err != nil {
+				t.Fatal(err)
+			}
+			// Re-enabling must not record the forwarding value router mode itself set
+			if err := enableRouterMode(statePath, "eth0", "wlan1"); err != nil {
+				t.Fatal(err)
+			}
+			if got := forward(); got != "1" {
+				t.Errorf("ip_forward while enabled = %q, want 1", got)
+			}
+
+			if err := disableRouterMode(statePath); err != nil {
+				t.Fatal(err)
+			}
+			if got := forward(); got != tt.original {
+				t.Errorf("ip_forward after disable = %q, want %q", got, tt.original)
+			}
+			if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+				t.Errorf("state file still present after disable: %v", err)
+			}
+			if got := calls(); got[len(got)-1] != "nft delete table ip "+routerTable {
+				t.Errorf("last call = %q, want the table torn down", got[len(got)-1])
+			}
+		})
+	}
+
+	t.Run("disable without enable leaves forwarding alone", func(t *testing.T) {
+		proc := useProcFixture(t, map[string]string{"sys/net/ipv4/ip_forward": "1\n"})
+		fakeCommands(t, map[string]string{"nft": "exit 0"})
+		if err := disableRouterMode(filepath.Join(t.TempDir(), "router-mode.json")); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(proc, "sys", "net", "ipv4", "ip_forward")); string(data) != "1\n" {
+			t.Errorf("ip_forward = %q, want it untouched", data)
+		}
+	})
+}
+
+func TestDetectInitSystem(t *testing.T) {
+	tests := []struct {
+		name  string
+		dirs  []string
+		files []string
+		want  string
+	}{
+		{"systemd booted", []string{"run/systemd/system", "etc/init.d"}, nil, "systemd"},
+		{"systemd marker must be a directory", nil, []string{"run/systemd/system"}, "unknown"},
+		{"openrc running", []string{"run/openrc", "etc/init.d"}, nil, "openrc"},
+		{"openrc installed", []string{"etc/init.d"}, []string{"sbin/openrc-run"}, "openrc"},
+		{"sysv scripts only", []string{"etc/init.d"}, nil, "sysv"},
+		{"empty root", nil, nil, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, dir := range tt.dirs {
+				if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, file := range tt.files {
+				writeTestFile(t, filepath.Join(root, filepath.FromSlash(file)), "")
+			}
+			if got := detectInitSystem(root); got != tt.want {
+				t.Errorf("detectInitSystem() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffInterfaceStates(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	up := interfaceState{status: "up", carrier: true}
+	tests := []struct {
+		name     string
+		previous map[string]interfaceState
+		current  map[string]interfaceState
+		want     []InterfaceEvent
+	}{
+		{"no change", map[string]interfaceState{"eth0": up}, map[string]interfaceState{"eth0": up}, nil},
+		{
+			"carrier lost",
+			map[string]interfaceState{"eth0": up},
+			map[string]interfaceState{"eth0": {status: "up"}},
+			[]InterfaceEvent{{Name: "eth0", Status: "up", Time: "2024-05-01T12:00:00Z"}},
+		},
+		{
+			"added and removed",
+			map[string]interfaceState{"wlan0": up},
+			map[string]interfaceState{"eth0": up},
+			[]InterfaceEvent{
+				{Name: "eth0", Status: "up", Carrier: true, Time: "2024-05-01T12:00:00Z"},
+				{Name: "wlan0", Status: "removed", Time: "2024-05-01T12:00:00Z"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffInterfaceStates(tt.previous, tt.current, now); !slices.Equal(got, tt.want) {
+				t.Errorf("diffInterfaceStates() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterfaceEventsStream(t *testing.T) {
+	app := newTestApp(t)
+	server := httptest.NewServer(http.HandlerFunc(app.interfaceEventsHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	// Headers are flushed before the handler subscribes, so wait for the subscription
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		app.mu.RLock()
+		subscribed := len(app.ifaceWatchers) == 1
+		app.mu.RUnlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("handler never subscribed to interface events")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	previous := map[string]interfaceState{"eth0": {status: "up", carrier: true}}
+	current := map[string]interfaceState{"eth0": {status: "down"}}
+	for _, event := range diffInterfaceStates(previous, current, time.Now()) {
+		app.publishInterfaceEvent(event)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if line, _ := reader.ReadString('\n'); line != "event: interface\n" {
+		t.Fatalf("first line = %q, want the interface event", line)
+	}
+	line, _ := reader.ReadString('\n')
+	var event InterfaceEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+		t.Fatalf("data line %q: %v", line, err)
+	}
+	if event.Name != "eth0" || event.Status != "down" || event.Carrier {
+		t.Errorf("event = %+v, want eth0 down without carrier", event)
+	}
+}
+
+func TestSavedWiFiPasswordEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		authToken  string
+		auth       string
+		ssid       string
+		wantStatus int
+		wantSecret string
+	}{
+		{name: "auth disabled", ssid: "Office", wantStatus: http.StatusForbidden},
+		{name: "missing token", authToken: "s3cret", ssid: "Office", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", authToken: "s3cret", auth: "Bearer guess", ssid: "Office", wantStatus: http.StatusUnauthorized},
+		{name: "unknown profile", authToken: "s3cret", auth: "Bearer s3cret", ssid: "Elsewhere", wantStatus: http.StatusNotFound},
+		{name: "saved profile", authToken: "s3cret", auth: "Bearer s3cret", ssid: "Office", wantStatus: http.StatusOK, wantSecret: "hunter22"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{
+				"nmcli": `[ "$1" = "-t" ] && printf 'Office:802-11-wireless\nWired connection 1:802-3-ethernet\n'
+[ "$1" = "-s" ] && echo hunter22
+exit 0`,
+			})
+			app := &App{nmcliAvailable: true, authToken: tt.authToken}
+
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/wifi/saved/"+tt.ssid+"/password", nil), map[string]string{"ssid": tt.ssid})
+			req.Header.Set("Accept", "application/json")
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			app.requireAuth(app.getSavedWiFiPasswordHandler)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var body map[string]string
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body["password"] != tt.wantSecret {
+				t.Errorf("password = %q, want %q", body["password"], tt.wantSecret)
+			}
+			// The secret must never be fetched for a request the gate rejected
+			readSecret := slices.ContainsFunc(calls(), func(call string) bool { return strings.HasPrefix(call, "nmcli -s") })
+			if readSecret != (tt.wantSecret != "") {
+				t.Errorf("read the secret = %v (calls %q)", readSecret, calls())
+			}
+		})
+	}
+}
+
+func TestProcessesServeStaleSnapshotOnTimeout(t *testing.T) {
+	cached := []Process{{User: "root", PID: 1, Command: "/sbin/init"}}
+	tests := []struct {
+		name      string
+		cached    []Process
+		cachedAge time.Duration
+		wantStale bool
+	}{
+		{"recent snapshot", cached, 10 * time.Second, true},
+		{"snapshot too old", cached, maxStaleProcessAge + time.Second, false},
+		{"no snapshot", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// exec keeps the fake ps as the process the deadline kills
+			fakeCommands(t, map[string]string{"ps": "exec sleep 5"})
+			app := newTestApp(t)
+			app.lastProcesses = tt.cached
+			app.lastProcessAt = time.Now().Add(-tt.cachedAge)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			req := httptest.NewRequest(http.MethodGet, "/api/processes", nil).WithContext(ctx)
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			app.getProcessesHandler(rec, req)
+
+			// Without a usable snapshot the timeout surfaces as a 500, or a 503 when the
+			// ps -ef fallback can't get a command slot before the deadline
+			if (rec.Code == http.StatusOK) != tt.wantStale {
+				t.Fatalf("status = %d, want success only when stale (body %s)", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("X-Stale") == "true"; got != tt.wantStale {
+				t.Errorf("X-Stale = %v, want %v", got, tt.wantStale)
+			}
+			if !tt.wantStale {
+				return
+			}
+
+			var body staleProcessList
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("stale body %s: %v", rec.Body, err)
+			}
+			if !body.Stale || body.StaleAge < 10 || len(body.Processes) != 1 || body.Processes[0].PID != 1 {
+				t.Errorf("body = %+v, want the cached snapshot marked stale", body)
+			}
+		})
+	}
+
+	t.Run("fresh list stays a plain array", func(t *testing.T) {
+		fakeCommands(t, map[string]string{"ps": "cat <<'EOF'\n" + psAuxFixture + "EOF"})
+		rec := httptest.NewRecorder()
+		newTestApp(t).getProcessesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/processes", nil))
+		var processes []Process
+		if err := json.Unmarshal(rec.Body.Bytes(), &processes); err != nil || len(processes) == 0 {
+			t.Errorf("body %s: want a non-empty array (%v)", rec.Body, err)
+		}
+		if rec.Header().Get("X-Stale") != "" {
+			t.Error("fresh list marked stale")
+		}
+	})
+}
+
+func TestWEPKeyType(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"40-bit hex", "0123456789", "1"},
+		{"104-bit hex", "0123456789abcdef0123456789", "1"},
+		{"40-bit ascii", "abcde", "1"},
+		{"104-bit ascii", "abcdefghijklm", "1"},
+		{"ten characters that are not hex", "office-key", "2"},
+		{"passphrase", "correct horse battery", "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wepKeyType(tt.key); got != tt.want {
+				t.Errorf("wepKeyType(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildWEPConnectionArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		bssid string
+		want  []string
+	}{
+		{"hex key", "0123456789", "", []string{"connection", "add", "type", "wifi", "con-name", "Legacy", "ifname", "wlan0", "ssid", "Legacy",
+			"wifi-sec.key-mgmt", "none", "wifi-sec.wep-key-type", "1", "wifi-sec.wep-key0", "0123456789"}},
+		{"passphrase pinned to a bssid", "let me in", "AA:BB:CC:DD:EE:FF", []string{"connection", "add", "type", "wifi", "con-name", "Legacy", "ifname", "wlan0", "ssid", "Legacy",
+			"wifi-sec.key-mgmt", "none", "wifi-sec.wep-key-type", "2", "wifi-sec.wep-key0", "let me in", "802-11-wireless.bssid", "AA:BB:CC:DD:EE:FF"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildWEPConnectionArgs("Legacy", tt.key, tt.bssid, "wlan0"); !slices.Equal(got, tt.want) {
+				t.Errorf("buildWEPConnectionArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWEPConnectRequestArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		wantKeyType string // "" when the request is rejected
+	}{
+		{"hex key", "0123456789abcdef0123456789", "1"},
+		{"ascii key", "abcde", "1"},
+		{"ten characters that are not hex", "office-key", "2"},
+		{"passphrase", "correct horse battery", "2"},
+		{"passphrase too long", strings.Repeat("x", 65), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ConnectionRequest{SSID: "Legacy", Password: tt.password, Security: "WEP"}
+			problems := validateConnectionRequest(req)
+			if rejected := hasFieldError(problems, "password"); rejected != (tt.wantKeyType == "") {
+				t.Fatalf("validateConnectionRequest() = %v, want rejected = %v", problems, tt.wantKeyType == "")
+			}
+			if tt.wantKeyType == "" {
+				return
+			}
+
+			args := buildWEPConnectionArgs(req.SSID, req.Password, req.BSSID, "wlan0")
+			i := slices.Index(args, "wifi-sec.wep-key-type")
+			if i < 0 || args[i+1] != tt.wantKeyType {
+				t.Errorf("args = %q, want wep-key-type %s", args, tt.wantKeyType)
+			}
+		})
+	}
+}
+
+func TestGroupProcessesByUser(t *testing.T) {
+	auxProcesses, err := parsePsAuxOutput(psAuxFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	efProcesses := []Process{
+		{User: "root", PID: 1, CPU: "0%", Memory: "0%"},
+		{User: "pi", PID: 1042, CPU: "0%", Memory: "0%"},
+	}
+
+	tests := []struct {
+		name          string
+		processes     []Process
+		want          []UserUsage
+		wantAvailable bool
+	}{
+		{"ps aux", auxProcesses, []UserUsage{
+			{User: "pi", Processes: 1, CPU: 2.5, Memory: 4.1},
+			{User: "www-data", Processes: 1, CPU: 0.3, Memory: 1.2},
+			{User: "root", Processes: 3, CPU: 0.1, Memory: 0.8},
+		}, true},
+		{"ps -ef has no usage", efProcesses, []UserUsage{
+			{User: "pi", Processes: 1},
+			{User: "root", Processes: 1},
+		}, false},
+		{"no processes", nil, []UserUsage{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, available := groupProcessesByUser(tt.processes)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("groupProcessesByUser() = %+v, want %+v", got, tt.want)
+			}
+			if available != tt.wantAvailable {
+				t.Errorf("usage available = %v, want %v", available, tt.wantAvailable)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsArchiveEntries(t *testing.T) {
+	fakeCommands(t, map[string]string{
+		"ip":         "echo '1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536'",
+		"nmcli":      "echo 'GENERAL.DEVICE: wlan0'",
+		"ps":         "cat <<'EOF'\n" + psAuxFixture + "EOF",
+		"journalctl": "echo 'No journal files were found.' >&2; exit 1",
+	})
+
+	rec := httptest.NewRecorder()
+	newTestApp(t).getDiagnosticsArchiveHandler(rec, httptest.NewRequest(http.MethodGet, "/api/diagnostics.tar.gz", nil))
+	if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment; filename=") {
+		t.Errorf("Content-Disposition = %q, want an attachment", got)
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		entries[header.Name] = string(data)
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"ip-addr.txt", "LOOPBACK"},
+		{"nmcli-dev-show.txt", "GENERAL.DEVICE"},
+		{"ps-aux.txt", "/sbin/init"},
+		{"journalctl.error.txt", "journalctl -n 500 --no-pager failed"},
+	}
+	if len(entries) != len(tests) {
+		t.Errorf("archive has %d entries %q, want %d", len(entries), slices.Sorted(maps.Keys(entries)), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, ok := entries[tt.file]
+			if !ok {
+				t.Fatalf("archive is missing %s", tt.file)
+			}
+			if !strings.Contains(content, tt.want) {
+				t.Errorf("%s = %q, want it to contain %q", tt.file, content, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeProcNetAddress(t *testing.T) {
+	skipOnBigEndian(t)
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"ipv4 loopback", "0100007F:0035", "127.0.0.1:53"},
+		{"ipv4 any", "00000000:1F90", "0.0.0.0:8080"},
+		{"ipv6 any", "00000000000000000000000000000000:0016", "[::]:22"},
+		{"ipv6 loopback", "00000000000000000000000001000000:1F90", "[::1]:8080"},
+		{"ipv6 documentation address", "B80D0120000000000000000001000000:01BB", "[2001:db8::1]:443"},
+		{"ipv6 link-local", "000080FE00000000FFEB27BA563412FE:C350", "[fe80::ba27:ebff:fe12:3456]:50000"},
+		{"ipv4-mapped ipv6", "0000000000000000FFFF00000100007F:0050", "127.0.0.1:80"},
+		{"bad length passes through", "0100007F00:0035", "0100007F00:0035"},
+		{"not hex passes through", "ZZ00007F:0035", "ZZ00007F:0035"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeProcNetAddress(tt.value); got != tt.want {
+				t.Errorf("decodeProcNetAddress(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+const iperfTCPFixture = `{
+	"start": {"connected": [{"socket": 5, "local_host": "10.0.0.2", "remote_host": "10.0.0.1", "remote_port": 5201}]},
+	"intervals": [],
+	"end": {
+		"streams": [],
+		"sum_sent": {"start": 0, "end": 5.00, "seconds": 5.00, "bytes": 58982400, "bits_per_second": 94371840.5, "retransmits": 12, "sender": true},
+		"sum_received": {"start": 0, "end": 5.04, "seconds": 5.04, "bytes": 58720256, "bits_per_second": 93206349.2, "sender": true},
+		"cpu_utilization_percent": {"host_total": 3.1, "remote_total": 1.2}
+	}
+}`
+
+const iperfUDPFixture = `{
+	"end": {
+		"sum": {"start": 0, "end": 5.00, "seconds": 5.00, "bytes": 655360, "bits_per_second": 1048576, "jitter_ms": 0.042, "lost_packets": 0, "packets": 480, "lost_percent": 0},
+		"cpu_utilization_percent": {"host_total": 0.8}
+	}
+}`
+
+func TestParseIperfOutput(t *testing.T) {
+	jitter := 0.042
+	tests := []struct {
+		name    string
+		output  string
+		want    *iperfSummary
+		wantErr string
+	}{
+		{"tcp uses the receiver's rate", iperfTCPFixture, &iperfSummary{mbps: 93.21, retransmits: 12}, ""},
+		{"udp reports jitter", iperfUDPFixture, &iperfSummary{mbps: 1.05, jitterMs: &jitter}, ""},
+		{"server busy", `{"start": {}, "end": {}, "error": "the server is busy running a test. try again later"}`, nil, "iperf3: the server is busy"},
+		{"no summary", `{"end": {}}`, nil, "no summary"},
+		{"not json", "iperf3: error - unable to connect to server", nil, "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIperfOutput([]byte(tt.output))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseIperfOutput() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.mbps != tt.want.mbps || got.retransmits != tt.want.retransmits {
+				t.Errorf("parseIperfOutput() = %+v, want %+v", got, tt.want)
+			}
+			if (got.jitterMs == nil) != (tt.want.jitterMs == nil) || (got.jitterMs != nil && *got.jitterMs != *tt.want.jitterMs) {
+				t.Errorf("jitter = %v, want %v", got.jitterMs, tt.want.jitterMs)
+			}
+		})
+	}
+}
+
+func TestStaticHandlerEmptyFS(t *testing.T) {
+	tests := []struct {
+		name        string
+		fsys        fstest.MapFS
+		wantStatus  int
+		wantBody    string
+		wantWarning bool
+	}{
+		{"built assets", fstest.MapFS{"styles.css": {Data: []byte("body{}")}, "app.js": {Data: []byte("init()")}}, http.StatusOK, "body{}", false},
+		{"empty embed", fstest.MapFS{}, http.StatusInternalServerError, "npm run build", true},
+		{"partial build", fstest.MapFS{"app.js": {Data: []byte("init()")}}, http.StatusInternalServerError, "npm run build", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			handler := newTestApp(t).staticHandler(tt.fsys)
+			if got := strings.Contains(logs.String(), "WARNING: embedded static assets are missing"); got != tt.wantWarning {
+				t.Errorf("startup warning logged = %v, want %v (log %q)", got, tt.wantWarning, logs)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/styles.css", nil))
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("GET /styles.css = %d %q, want %d containing %q", rec.Code, rec.Body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+// fakeConnectStages reports association with ssid and the given addresses and internet result
+func fakeConnectStages(ssid string, addrs []string, internet bool) connectStages {
+	return connectStages{
+		currentSSID: func() (string, bool) { return ssid, ssid != "" },
+		addresses:   func(time.Duration) []string { return addrs },
+		internet:    func() bool { return internet },
+	}
+}
+
+func TestVerifyWiFiConnection(t *testing.T) {
+	tests := []struct {
+		name         string
+		stages       connectStages
+		wantSSID     any
+		wantConnect  bool
+		wantIP       bool
+		wantInternet bool
+	}{
+		{"online", fakeConnectStages("Office", []string{"192.168.1.20"}, true), "Office", true, true, true},
+		{"joined but no internet", fakeConnectStages("Office", []string{"192.168.1.20"}, false), "Office", true, true, false},
+		{"no dhcp lease", fakeConnectStages("Office", []string{}, true), "Office", true, false, false},
+		{"fell back to another profile", fakeConnectStages("Office-Guest", []string{"10.0.0.5"}, true), "Office-Guest", false, false, false},
+		{"never associated", fakeConnectStages("", nil, true), nil, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := verifyWiFiConnection("Office", 0, tt.stages)
+			if result["ssid"] != tt.wantSSID {
+				t.Errorf("ssid = %v, want %v", result["ssid"], tt.wantSSID)
+			}
+			if result["connected"] != tt.wantConnect || result["has_ip"] != tt.wantIP || result["internet"] != tt.wantInternet {
+				t.Errorf("result = %v, want connected=%v has_ip=%v internet=%v", result, tt.wantConnect, tt.wantIP, tt.wantInternet)
+			}
+		})
+	}
+}
+
+func TestConnectVerifyWiFiHandler(t *testing.T) {
+	if readWiFiRfkill(sysClassRfkillPath).Blocked() {
+		t.Skip("this machine's WiFi radio is blocked")
+	}
+
+	tests := []struct {
+		name         string
+		connectExit  int
+		internet     bool
+		wantStatus   int
+		wantInternet bool
+		wantErrorLog bool
+	}{
+		{"connected and online", 0, true, http.StatusOK, true, false},
+		{"captive portal", 0, false, http.StatusOK, false, false},
+		{"connect fails", 4, true, http.StatusInternalServerError, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{
+				"nmcli": fmt.Sprintf("echo 'Error: No network with SSID found.' >&2; exit %d", tt.connectExit),
+			})
+			previous := wifiConnectStages
+			wifiConnectStages = fakeConnectStages("Office", []string{"192.168.1.20"}, tt.internet)
+			t.Cleanup(func() { wifiConnectStages = previous })
+
+			app := &App{nmcliAvailable: true}
+			rec := httptest.NewRecorder()
+			app.connectVerifyWiFiHandler(rec, httptest.NewRequest(http.MethodPost, "/api/wifi/connect-verify",
+				strings.NewReader(`{"ssid":"Office","password":"correct horse","security":"WPA2"}`)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !slices.ContainsFunc(calls(), func(call string) bool { return strings.HasPrefix(call, "nmcli dev wifi connect Office") }) {
+				t.Errorf("calls = %q, want a connect to Office", calls())
+			}
+			if got := len(app.WiFiErrors()) > 0; got != tt.wantErrorLog {
+				t.Errorf("error logged = %v, want %v", got, tt.wantErrorLog)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result["connected"] != true || result["has_ip"] != true || result["internet"] != tt.wantInternet {
+				t.Errorf("result = %v, want connected with internet=%v", result, tt.wantInternet)
+			}
+		})
+	}
+}
+
+func TestParseSavedConnections(t *testing.T) {
+	output := "Office:5f9c1b0e-2a4d-4c1e-9e7a-0d3b8f6a2c11:802-11-wireless:1714560000\n" +
+		"Wired connection 1:0ad2f1c6-8d0a-4b1f-a3c2-1e2f3a4b5c6d:802-3-ethernet:1714560000\n" +
+		"Cafe\\: Free:1b2c3d4e-0000-1111-2222-333344445555:802-11-wireless:0\n"
+	want := []SavedConnection{
+		{Name: "Office", UUID: "5f9c1b0e-2a4d-4c1e-9e7a-0d3b8f6a2c11", Timestamp: 1714560000},
+		{Name: "Cafe: Free", UUID: "1b2c3d4e-0000-1111-2222-333344445555"},
+	}
+	if got := parseSavedConnections(output); !slices.Equal(got, want) {
+		t.Errorf("parseSavedConnections() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOrphanedConnections(t *testing.T) {
+	devices := map[string]bool{"wlan0": true}
+	tests := []struct {
+		name       string
+		connection SavedConnection
+		wantReason string
+	}{
+		{"connected before, any device", SavedConnection{Name: "Office", Timestamp: 1714560000}, ""},
+		{"connected before, bound to a present device", SavedConnection{Name: "Lab", Timestamp: 1714560000, InterfaceName: "wlan0"}, ""},
+		{"never connected", SavedConnection{Name: "Cafe"}, "never successfully connected"},
+		{"bound to a removed device", SavedConnection{Name: "Dongle", Timestamp: 1714560000, InterfaceName: "wlx00c0ca123456"}, "device wlx00c0ca123456 no longer exists"},
+		{"missing device wins over never connected", SavedConnection{Name: "Old", InterfaceName: "wlan1"}, "device wlan1 no longer exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orphans := orphanedConnections([]SavedConnection{tt.connection}, func(name string) bool { return devices[name] })
+			if tt.wantReason == "" {
+				if len(orphans) != 0 {
+					t.Errorf("orphans = %+v, want none", orphans)
+				}
+				return
+			}
+			if len(orphans) != 1 || orphans[0].Reason != tt.wantReason {
+				t.Errorf("orphans = %+v, want one with reason %q", orphans, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestPruneOrphanedConnectionsRequiresConfirm(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no body", ""},
+		{"confirm false", `{"confirm":false}`},
+		{"confirm as a string", `{"confirm":"yes"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{"nmcli": "exit 0"})
+			rec := httptest.NewRecorder()
+			(&App{nmcliAvailable: true}).pruneOrphanedConnectionsHandler(rec, httptest.NewRequest(http.MethodPost, "/api/nm/connections/prune", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+			if got := calls(); len(got) != 0 {
+				t.Errorf("calls = %q, want nmcli untouched", got)
+			}
+		})
+	}
+}
+
+// fakeResolver answers after a fixed delay, or fails with err
+type fakeResolver struct {
+	delay time.Duration
+	err   error
+}
+
+func (f fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []string{"93.184.216.34"}, nil
+}
+
+func TestBenchmarkDNS(t *testing.T) {
+	resolvers := map[string]fakeResolver{
+		"1.1.1.1": {delay: 10 * time.Millisecond},
+		"8.8.8.8": {delay: 80 * time.Millisecond},
+		"9.9.9.9": {delay: 5 * time.Millisecond, err: &net.DNSError{Err: "no such host", Name: "example.com", Server: "127.0.0.53:53", IsNotFound: true}},
+	}
+	tests := []struct {
+		server      string
+		wantSuccess bool
+		wantError   string
+		minLatency  float64
+		maxLatency  float64
+	}{
+		{"1.1.1.1", true, "", 10, 80},
+		{"8.8.8.8", true, "", 80, 1000},
+		{"9.9.9.9", false, "no such host", 5, 80},
+	}
+
+	servers := make([]string, len(tests))
+	for i, tt := range tests {
+		servers[i] = tt.server
+	}
+	results := benchmarkDNS(context.Background(), servers, "example.com", func(server string) hostLookuper { return resolvers[server] })
+	if len(results) != len(tests) {
+		t.Fatalf("got %d results, want %d", len(results), len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			result := results[i]
+			if result.Server != tt.server || result.Success != tt.wantSuccess || result.Error != tt.wantError {
+				t.Errorf("result = %+v, want server %s success=%v error %q", result, tt.server, tt.wantSuccess, tt.wantError)
+			}
+			// Lookups run concurrently, so each latency reflects only its own resolver
+			if result.LatencyMs < tt.minLatency || result.LatencyMs > tt.maxLatency {
+				t.Errorf("latency = %vms, want between %v and %v", result.LatencyMs, tt.minLatency, tt.maxLatency)
+			}
+		})
+	}
+}
+
+func TestDNSBenchmarkValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no servers", `{"servers":[]}`},
+		{"too many servers", `{"servers":["1.1.1.1","1.0.0.1","8.8.8.8","8.8.4.4","9.9.9.9","149.112.112.112","208.67.222.222","208.67.220.220","94.140.14.14"]}`},
+		{"hostname as server", `{"servers":["dns.google"]}`},
+		{"invalid name", `{"servers":["1.1.1.1"],"name":"bad name;"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			(&App{}).dnsBenchmarkHandler(rec, httptest.NewRequest(http.MethodPost, "/api/network/dns-benchmark", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400 (body %s)", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+// failingResponseWriter records headers but fails every body write, like a client that hung up
+type failingResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (f *failingResponseWriter) Header() http.Header {
+	if f.header == nil {
+		f.header = http.Header{}
+	}
+	return f.header
+}
+
+func (f *failingResponseWriter) WriteHeader(status int) { f.status = status }
+
+func (f *failingResponseWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write tcp 127.0.0.1:9080->127.0.0.1:51234: write: broken pipe")
+}
+
+func TestWriteJSONErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      any
+		wantStatus int
+		wantLog    string
+	}{
+		{"client disconnected", map[string]string{"status": "ok"}, http.StatusOK, "Failed to write JSON response: write tcp"},
+		{"value can't be encoded", map[string]any{"rate": math.NaN()}, http.StatusInternalServerError, "Failed to encode JSON response: json: unsupported value: NaN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			w := &failingResponseWriter{}
+			writeJSON(w, http.StatusOK, tt.value)
+			if w.status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.status, tt.wantStatus)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log = %q, want it to contain %q", logs, tt.wantLog)
+			}
+		})
+	}
+
+	t.Run("encode failure falls back to a 500", func(t *testing.T) {
+		captureLog(t)
+		rec := httptest.NewRecorder()
+		writeJSON(rec, http.StatusOK, map[string]any{"rate": math.Inf(1)})
+		if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "failed to encode response") {
+			t.Errorf("response = %d %q, want a 500 explaining the encode failure", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestValidateDNSServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []string
+		wantErr bool
+	}{
+		{"two servers", []string{"1.1.1.1", "9.9.9.9"}, false},
+		{"clear", []string{}, false},
+		{"hostname", []string{"dns.google"}, true},
+		{"ipv6 isn't accepted by ipv4.dns", []string{"2606:4700:4700::1111"}, true},
+		{"one bad entry", []string{"1.1.1.1", "1.1.1"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDNSServers(tt.servers); (err != nil) != tt.wantErr {
+				t.Errorf("validateDNSServers(%q) error = %v, wantErr %v", tt.servers, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetInterfaceDNSHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantModify string
+	}{
+		{"pin servers", `{"servers":["1.1.1.1","9.9.9.9"]}`, http.StatusOK,
+			"nmcli connection modify id Wired connection 1 ipv4.dns 1.1.1.1,9.9.9.9 ipv4.ignore-auto-dns yes"},
+		{"clear reverts to dhcp dns", `{"servers":[]}`, http.StatusOK,
+			"nmcli connection modify id Wired connection 1 ipv4.dns  ipv4.ignore-auto-dns no"},
+		{"invalid server", `{"servers":["1.1.1.1","resolver.local"]}`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{
+				"nmcli": `[ "$1" = "-g" ] && echo 'Wired connection 1'; exit 0`,
+			})
+			// Any interface that exists will do; the loopback is always there
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/interfaces/lo/dns", strings.NewReader(tt.body)), map[string]string{"name": loopbackName(t)})
+			rec := httptest.NewRecorder()
+			(&App{nmcliAvailable: true}).setInterfaceDNSHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantModify == "" {
+				if got := calls(); len(got) != 0 {
+					t.Errorf("calls = %q, want nmcli untouched", got)
+				}
+				return
+			}
+			if got := calls(); !slices.Contains(got, tt.wantModify) || got[len(got)-1] != "nmcli device reapply "+loopbackName(t) {
+				t.Errorf("calls = %q, want %q followed by a reapply", got, tt.wantModify)
+			}
+		})
+	}
+}
+
+// loopbackName finds the loopback interface, which isn't called lo everywhere
+func loopbackName(t *testing.T) string {
+	t.Helper()
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestSignalPercentToDBM(t *testing.T) {
+	tests := []struct {
+		percent int
+		want    int
+	}{
+		{0, -100},
+		{50, -75},
+		{82, -59},
+		{100, -50},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.percent), func(t *testing.T) {
+			if got := signalPercentToDBM(tt.percent); got != tt.want {
+				t.Errorf("signalPercentToDBM(%d) = %d, want %d", tt.percent, got, tt.want)
+			}
+		})
+	}
+}
+
+const iwScanDumpFixture = `BSS aa:bb:cc:dd:ee:01(on wlan0) -- associated
+	TSF: 1234567890 usec (0d, 00:20:34)
+	freq: 5180
+	beacon interval: 100 TUs
+	signal: -54.00 dBm
+	last seen: 120 ms ago
+	SSID: Office
+BSS aa:bb:cc:dd:ee:02(on wlan0)
+	freq: 2437
+	signal: -71.50 dBm
+	SSID: Office
+BSS aa:bb:cc:dd:ee:03(on wlan0)
+	freq: 2412
+	signal: -80.00 dBm
+	SSID: Warehouse
+BSS aa:bb:cc:dd:ee:04(on wlan0)
+	freq: 2462
+	SSID: NoSignalLine
+`
+
+func TestParseIwScanSignals(t *testing.T) {
+	signals := parseIwScanSignals(iwScanDumpFixture)
+	tests := []struct {
+		ssid   string
+		want   int
+		wantOK bool
+	}{
+		{"Office", -54, true},
+		{"Warehouse", -80, true},
+		{"NoSignalLine", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ssid, func(t *testing.T) {
+			got, ok := signals[tt.ssid]
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("signals[%q] = %d, %v, want %d, %v", tt.ssid, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	networks := []WiFiNetwork{{SSID: "Office", SignalDBM: signalPercentToDBM(82)}, {SSID: "Lab", SignalDBM: signalPercentToDBM(55)}}
+	applyIwSignals(networks, signals)
+	if networks[0].SignalDBM != -54 || networks[1].SignalDBM != -73 {
+		t.Errorf("after applyIwSignals = %+v, want iw's dBm for Office and the conversion kept for Lab", networks)
+	}
+}
+
+func TestReapplyInterfaceHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       string
+		wantStatus  int
+		wantReapply bool
+		wantState   string
+	}{
+		{"managed", "100 (connected)", http.StatusOK, true, "connected"},
+		{"managed but disconnected", "30 (disconnected)", http.StatusOK, true, "disconnected"},
+		{"unmanaged", "10 (unmanaged)", http.StatusConflict, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{
+				"nmcli": fmt.Sprintf(`[ "$1" = "-g" ] && echo '%s'; exit 0`, tt.state),
+			})
+			name := loopbackName(t)
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/interfaces/"+name+"/reapply", nil), map[string]string{"name": name})
+			rec := httptest.NewRecorder()
+			(&App{nmcliAvailable: true}).reapplyInterfaceHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := slices.Contains(calls(), "nmcli device reapply "+name); got != tt.wantReapply {
+				t.Errorf("reapplied = %v, want %v (calls %q)", got, tt.wantReapply, calls())
+			}
+			var body map[string]string
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body["state"] != tt.wantState {
+				t.Errorf("state = %q, want %q", body["state"], tt.wantState)
+			}
+		})
+	}
+
+	t.Run("unknown interface", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/interfaces/nope0/reapply", nil), map[string]string{"name": "nope0"})
+		rec := httptest.NewRecorder()
+		(&App{nmcliAvailable: true}).reapplyInterfaceHandler(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	})
+}
+
+func TestProcessesByPort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the handler only serves /proc on Linux")
+	}
+	skipOnBigEndian(t)
+	proc := useProcFixture(t, map[string]string{"stat": "btime 1700000000\n", "net/tcp": procNetTCPFixture})
+	linkFakeFD(t, proc, 1042, 3, "socket:[12345]")
+	linkFakeFD(t, proc, 612, 7, "socket:[55555]")
+	fakeCommands(t, map[string]string{"ps": "cat <<'EOF'\n" + psAuxFixture + "EOF"})
+
+	tests := []struct {
+		name       string
+		port       string
+		wantStatus int
+		wantPIDs   []int
+	}{
+		{"listening socket owned by a process", "8080", http.StatusOK, []int{1042}},
+		{"socket nobody in the fixture owns", "53", http.StatusOK, []int{}},
+		{"nothing on the port", "9999", http.StatusOK, []int{}},
+		{"port zero", "0", http.StatusBadRequest, nil},
+		{"port out of range", "65536", http.StatusBadRequest, nil},
+		{"not a number", "http", http.StatusBadRequest, nil},
+	}
+
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/processes/by-port/"+tt.port, nil), map[string]string{"port": tt.port})
+			rec := httptest.NewRecorder()
+			app.getProcessesByPortHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantPIDs == nil {
+				return
+			}
+			var processes []Process
+			if err := json.Unmarshal(rec.Body.Bytes(), &processes); err != nil {
+				t.Fatalf("body %s: %v", rec.Body, err)
+			}
+			pids := []int{}
+			for _, process := range processes {
+				pids = append(pids, process.PID)
+			}
+			if !slices.Equal(pids, tt.wantPIDs) {
+				t.Errorf("pids = %v, want %v", pids, tt.wantPIDs)
+			}
+		})
+	}
+}
+
+const resolvectlModernFixture = `Global
+           Protocols: +LLMNR +mDNS -DNSOverTLS DNSSEC=allow-downgrade/supported
+    resolv.conf mode: stub
+         DNS Servers: 9.9.9.9
+Fallback DNS Servers: 1.1.1.1 8.8.8.8
+
+Link 2 (eth0)
+    Current Scopes: DNS LLMNR/IPv4 LLMNR/IPv6
+         Protocols: +DefaultRoute +LLMNR -mDNS -DNSOverTLS DNSSEC=no/unsupported
+Current DNS Server: 192.168.1.1
+       DNS Servers: 192.168.1.1
+                    2001:db8::53
+        DNS Domain: lan plant.example
+
+Link 3 (wlan0)
+Current Scopes: none
+     Protocols: -DefaultRoute +LLMNR -mDNS -DNSOverTLS DNSSEC=no/unsupported
+`
+
+const resolvectlLegacyFixture = `Global
+       LLMNR setting: yes
+MulticastDNS setting: yes
+  DNSOverTLS setting: no
+      DNSSEC setting: allow-downgrade
+    DNSSEC supported: yes
+          DNSSEC NTA: 10.in-addr.arpa
+                      168.192.in-addr.arpa
+
+Link 2 (eth0)
+      Current Scopes: DNS
+DefaultRoute setting: yes
+       LLMNR setting: yes
+      DNSSEC setting: allow-downgrade
+  Current DNS Server: 10.0.0.1
+         DNS Servers: 10.0.0.1
+                      10.0.0.2
+`
+
+func TestParseResolvectlStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   *ResolvedStatus
+	}{
+		{"resolvectl status", resolvectlModernFixture, &ResolvedStatus{
+			GlobalDNS: []string{"9.9.9.9"},
+			DNSSEC:    "allow-downgrade/supported",
+			Links: []ResolvedLink{
+				{Interface: "eth0", CurrentServer: "192.168.1.1", DNSServers: []string{"192.168.1.1", "2001:db8::53"}, Domains: []string{"lan", "plant.example"}, DNSSEC: "no/unsupported"},
+				{Interface: "wlan0", DNSServers: []string{}, DNSSEC: "no/unsupported"},
+			},
+		}},
+		{"systemd-resolve --status", resolvectlLegacyFixture, &ResolvedStatus{
+			GlobalDNS: []string{},
+			DNSSEC:    "allow-downgrade",
+			Links: []ResolvedLink{
+				{Interface: "eth0", CurrentServer: "10.0.0.1", DNSServers: []string{"10.0.0.1", "10.0.0.2"}, DNSSEC: "allow-downgrade"},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseResolvectlStatus(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseResolvectlStatus() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseResolvConfNameservers(t *testing.T) {
+	content := "# Generated by NetworkManager\nsearch lan\nnameserver 192.168.1.1\nnameserver 2001:db8::53\noptions edns0\nnameserver\n"
+	if got, want := parseResolvConfNameservers(content), []string{"192.168.1.1", "2001:db8::53"}; !slices.Equal(got, want) {
+		t.Errorf("parseResolvConfNameservers() = %q, want %q", got, want)
+	}
+}
+
+func TestParseActiveWirelessConnections(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []activeWireless
+	}{
+		{"wireless among others", "Wired connection 1:802-3-ethernet:eth0\nOffice:802-11-wireless:wlan0\nlo:loopback:lo\n",
+			[]activeWireless{{name: "Office", device: "wlan0"}}},
+		{"escaped colon in the name", "Cafe\\: Free:802-11-wireless:wlan0\n", []activeWireless{{name: "Cafe: Free", device: "wlan0"}}},
+		{"two radios", "Office:802-11-wireless:wlan0\nUplink:wifi:wlan1\n",
+			[]activeWireless{{name: "Office", device: "wlan0"}, {name: "Uplink", device: "wlan1"}}},
+		{"activating without a device", "Office:802-11-wireless:\n", nil},
+		{"nothing active", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseActiveWirelessConnections(tt.output); !slices.Equal(got, tt.want) {
+				t.Errorf("parseActiveWirelessConnections() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+const autoconnectFixture = `Office:11111111-1111-1111-1111-111111111111:802-11-wireless:yes
+Cafe\: Free WiFi:22222222-2222-2222-2222-222222222222:802-11-wireless:yes
+Lab Bench:33333333-3333-3333-3333-333333333333:802-11-wireless:no
+Wired connection 1:44444444-4444-4444-4444-444444444444:802-3-ethernet:yes
+`
+
+func TestParseWiFiAutoconnect(t *testing.T) {
+	want := []wifiAutoconnect{
+		{Name: "Office", UUID: "11111111-1111-1111-1111-111111111111", Autoconnect: true},
+		{Name: "Cafe: Free WiFi", UUID: "22222222-2222-2222-2222-222222222222", Autoconnect: true},
+		{Name: "Lab Bench", UUID: "33333333-3333-3333-3333-333333333333", Autoconnect: false},
+	}
+	if got := parseWiFiAutoconnect(autoconnectFixture); !slices.Equal(got, want) {
+		t.Errorf("parseWiFiAutoconnect() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSetWiFiAutoconnect(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantModify  []string
+		wantUpdated float64
+	}{
+		{"disable all", `{"enabled":false}`, http.StatusOK, []string{
+			"nmcli connection modify uuid 11111111-1111-1111-1111-111111111111 connection.autoconnect no",
+			"nmcli connection modify uuid 22222222-2222-2222-2222-222222222222 connection.autoconnect no",
+		}, 2},
+		{"enable all", `{"enabled":true}`, http.StatusOK, []string{
+			"nmcli connection modify uuid 33333333-3333-3333-3333-333333333333 connection.autoconnect yes",
+		}, 1},
+		{"missing enabled", `{}`, http.StatusBadRequest, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{
+				"nmcli": "[ \"$1\" = \"-t\" ] && cat <<'EOF'\n" + autoconnectFixture + "EOF\nexit 0",
+			})
+			rec := httptest.NewRecorder()
+			(&App{nmcliAvailable: true}).setWiFiAutoconnectHandler(rec, httptest.NewRequest(http.MethodPost, "/api/wifi/autoconnect", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var modified []string
+			for _, call := range calls() {
+				if strings.HasPrefix(call, "nmcli connection modify") {
+					modified = append(modified, call)
+				}
+			}
+			if !slices.Equal(modified, tt.wantModify) {
+				t.Errorf("modified = %q, want %q", modified, tt.wantModify)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var body map[string]any
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body["updated"] != tt.wantUpdated {
+				t.Errorf("updated = %v, want %v", body["updated"], tt.wantUpdated)
+			}
+		})
+	}
+}
+
+func TestConnectValidationReportsEveryField(t *testing.T) {
+	if readWiFiRfkill(sysClassRfkillPath).Blocked() {
+		t.Skip("this machine's WiFi radio is blocked")
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantFields []string
+	}{
+		{"three bad fields", `{"ssid":"","bssid":"not-a-mac","security":"WPA2","password":"short"}`, []string{"ssid", "bssid", "password"}},
+		{"bad clone mac and wep key", `{"ssid":"Legacy","security":"WEP","password":"","clone_mac":"sometimes"}`, []string{"clone_mac", "password"}},
+		{"only the ssid", `{"ssid":"","security":"Open"}`, []string{"ssid"}},
+		{"unknown security", `{"ssid":"Office","security":"WPA4","password":"supersecret"}`, []string{"security"}},
+		{"missing security", `{"ssid":"Office","password":"supersecret"}`, []string{"security"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{"nmcli": "exit 0"})
+			rec := httptest.NewRecorder()
+			(&App{nmcliAvailable: true}).connectWiFiHandler(rec, httptest.NewRequest(http.MethodPost, "/api/wifi/connect", strings.NewReader(tt.body)))
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want 422 (body %s)", rec.Code, rec.Body)
+			}
+			var body ValidationError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			var fields []string
+			for _, fieldErr := range body.Errors {
+				if fieldErr.Message == "" {
+					t.Errorf("field %s has no message", fieldErr.Field)
+				}
+				fields = append(fields, fieldErr.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("fields = %q, want %q", fields, tt.wantFields)
+			}
+			if got := calls(); len(got) != 0 {
+				t.Errorf("calls = %q, want nothing run for an invalid request", got)
+			}
+		})
+	}
+}
+
+func TestBandwidthRate(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		previous byteCounters
+		current  byteCounters
+		elapsed  time.Duration
+		wantRx   float64
+		wantTx   float64
+	}{
+		{"steady traffic", byteCounters{rx: 1000, tx: 500}, byteCounters{rx: 3000, tx: 1500}, 2 * time.Second, 1000, 500},
+		{"counter reset", byteCounters{rx: 1 << 32, tx: 500}, byteCounters{rx: 100, tx: 600}, time.Second, 0, 100},
+		{"no elapsed time", byteCounters{rx: 1000}, byteCounters{rx: 2000}, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bandwidthRate("eth0", tt.previous, tt.current, tt.elapsed, now)
+			if got.RxBytesPerSecond != tt.wantRx || got.TxBytesPerSecond != tt.wantTx || got.Time != "2024-05-01T12:00:00Z" {
+				t.Errorf("bandwidthRate() = %+v, want rx %v tx %v", got, tt.wantRx, tt.wantTx)
+			}
+		})
+	}
+}
+
+func TestInterfaceBandwidthStream(t *testing.T) {
+	name := loopbackName(t)
+	if _, err := readInterfaceByteCounters(sysClassNetPath, name); err != nil {
+		t.Skipf("no sysfs statistics for %s: %v", name, err)
+	}
+
+	app := newTestApp(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/interfaces/{name}/bandwidth/stream", app.interfaceBandwidthStreamHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/interfaces/nope0/bandwidth/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown interface status = %d, want 404 before streaming", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/api/interfaces/" + name + "/bandwidth/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	for i := range 2 {
+		if line, _ := reader.ReadString('\n'); line != "event: bandwidth\n" {
+			t.Fatalf("event %d starts with %q, want a bandwidth event", i, line)
+		}
+		line, _ := reader.ReadString('\n')
+		// Decode loosely so a rate encoded as a string would fail the type check below
+		var event map[string]any
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("event %d data %q: %v", i, line, err)
+		}
+		for _, field := range []string{"rx_bytes_per_second", "tx_bytes_per_second"} {
+			if rate, ok := event[field].(float64); !ok || rate < 0 {
+				t.Errorf("event %d %s = %v, want a non-negative number", i, field, event[field])
+			}
+		}
+		if event["name"] != name {
+			t.Errorf("event %d name = %v, want %s", i, event["name"], name)
+		}
+		reader.ReadString('\n')
+	}
+}
+
+func TestParseNmcliCurrentOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		want     CurrentWiFi
+		wantRows int
+	}{
+		{"strongest active row wins", "no:Warehouse:40:WPA2\nyes:Uplink:48:WPA2\nyes:Office:82:WPA2 WPA3\nno:Office-Guest:76:\n",
+			CurrentWiFi{SSID: "Office", Signal: "82%", SignalLevel: 82, Security: "WPA3", Connected: true}, 2},
+		{"order doesn't matter", "yes:Office:82:WPA2\nyes:Uplink:48:WPA2\n",
+			CurrentWiFi{SSID: "Office", Signal: "82%", SignalLevel: 82, Security: "WPA2", Connected: true}, 2},
+		{"single active row", "no:Office:82:WPA2\nyes:Lab:55:WPA3\n",
+			CurrentWiFi{SSID: "Lab", Signal: "55%", SignalLevel: 55, Security: "WPA3", Connected: true}, 1},
+		{"nothing active", "no:Office:82:WPA2\n", CurrentWiFi{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNmcliCurrentOutput(tt.output); *got != tt.want {
+				t.Errorf("parseNmcliCurrentOutput() = %+v, want %+v", *got, tt.want)
+			}
+			if got := parseNmcliActiveRows(tt.output); len(got) != tt.wantRows {
+				t.Errorf("parseNmcliActiveRows() returned %d rows, want %d", len(got), tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestProcessStatusText(t *testing.T) {
+	tests := []struct {
+		stat string
+		want string
+	}{
+		{"Ssl", "Sleeping"},
+		{"Ss", "Sleeping"},
+		{"R+", "Running"},
+		{"D<", "Uninterruptible"},
+		{"Z", "Zombie"},
+		{"T", "Stopped"},
+		{"t", "Stopped"},
+		{"I<", "Idle"},
+		{"Sl+", "Sleeping"},
+		{"W", "Unknown"},
+		{"", "Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stat, func(t *testing.T) {
+			if got := processStatusText(tt.stat); got != tt.want {
+				t.Errorf("processStatusText(%q) = %q, want %q", tt.stat, got, tt.want)
+			}
+		})
+	}
+
+	processes, err := parsePsAuxOutput(psAuxFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The raw STAT code is kept alongside the label
+	if got := processes[3]; got.Status != "Sl" || got.StatusText != "Sleeping" {
+		t.Errorf("parsed status = %q/%q, want Sl/Sleeping", got.Status, got.StatusText)
+	}
+}
+
+func TestClassifyWiFiError(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"Error: Connection activation failed: Secrets were required, but not provided.", "auth_failed"},
+		{"Error: No network with SSID 'Office' found.", "ssid_not_found"},
+		{"did not associate within 20s", "timeout"},
+		{"associated but no IPv4 address was assigned", "no_ip"},
+		{"wlan0 lost carrier (down)", "carrier_lost"},
+		{"Error: Device 'wlan0' not ready", "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := classifyWiFiError(tt.message); got != tt.want {
+				t.Errorf("classifyWiFiError(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWiFiErrorLog(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		record    int
+		wantLen   int
+		wantFirst string
+	}{
+		{"accumulates", 3, 3, "ssid-0"},
+		{"at the cap", maxWiFiErrors, maxWiFiErrors, "ssid-0"},
+		{"evicts the oldest past the cap", maxWiFiErrors + 5, maxWiFiErrors, "ssid-5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{}
+			for i := range tt.record {
+				app.recordWiFiError("connect", fmt.Sprintf("ssid-%d", i), "Error: No network with SSID found.", start.Add(time.Duration(i)*time.Second))
+			}
+
+			rec := httptest.NewRecorder()
+			app.getWiFiErrorsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/wifi/errors", nil))
+			var entries []WiFiErrorEntry
+			if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+				t.Fatalf("body %s: %v", rec.Body, err)
+			}
+			if len(entries) != tt.wantLen || entries[0].SSID != tt.wantFirst {
+				t.Fatalf("got %d entries starting at %q, want %d starting at %q", len(entries), entries[0].SSID, tt.wantLen, tt.wantFirst)
+			}
+			if last := entries[len(entries)-1]; last.Code != "ssid_not_found" || last.Time != start.Add(time.Duration(tt.record-1)*time.Second).Format(time.RFC3339) {
+				t.Errorf("newest entry = %+v, want the last recorded error with its code", last)
+			}
+
+			rec = httptest.NewRecorder()
+			app.clearWiFiErrorsHandler(rec, httptest.NewRequest(http.MethodDelete, "/api/wifi/errors", nil))
+			var cleared map[string]any
+			json.Unmarshal(rec.Body.Bytes(), &cleared)
+			if cleared["cleared"] != float64(tt.wantLen) {
+				t.Errorf("cleared = %v, want %d", cleared["cleared"], tt.wantLen)
+			}
+			if got := app.WiFiErrors(); len(got) != 0 {
+				t.Errorf("after clearing, log has %d entries", len(got))
+			}
+		})
+	}
+}
+
+func TestResolveScanDevice(t *testing.T) {
+	radios := []string{"wlan0", "wlan1"}
+	tests := []struct {
+		name      string
+		requested string
+		devices   []string
+		want      string
+		wantErr   bool
+	}{
+		{"defaults to the first radio", "", radios, "wlan0", false},
+		{"specific radio", "wlan1", radios, "wlan1", false},
+		{"wired interface", "eth0", radios, "", true},
+		{"unknown interface", "wlan7", radios, "", true},
+		{"no radios lets nmcli pick", "", nil, "", false},
+		{"no radios rejects a request", "wlan0", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveScanDevice(tt.requested, tt.devices)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("resolveScanDevice(%q) = %q, %v, want %q, wantErr %v", tt.requested, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildScanArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		device     string
+		wantRescan []string
+		wantList   []string
+	}{
+		{"default device", "", []string{"device", "wifi", "rescan"},
+			[]string{"-t", "-f", "SSID,SIGNAL,SECURITY,FREQ", "dev", "wifi", "list"}},
+		{"pinned device", "wlan1", []string{"device", "wifi", "rescan", "ifname", "wlan1"},
+			[]string{"-t", "-f", "SSID,SIGNAL,SECURITY,FREQ", "dev", "wifi", "list", "ifname", "wlan1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rescan, list := buildScanArgs(tt.device)
+			if !slices.Equal(rescan, tt.wantRescan) || !slices.Equal(list, tt.wantList) {
+				t.Errorf("buildScanArgs(%q) = %q, %q, want %q, %q", tt.device, rescan, list, tt.wantRescan, tt.wantList)
+			}
+		})
+	}
+}
+
+func TestResolveCapabilities(t *testing.T) {
+	tests := []struct {
+		name      string
+		euid      int
+		effective uint64
+		want      Capabilities
+	}{
+		{"root", 0, 0, Capabilities{EUID: 0, CanReboot: true, CanKillAny: true, CanModifyNetwork: true}},
+		{"unprivileged", 1000, 0, Capabilities{EUID: 1000}},
+		{"service with CAP_SYS_BOOT", 998, 1 << capSysBoot, Capabilities{EUID: 998, CanReboot: true}},
+		{"service with CAP_KILL and CAP_NET_ADMIN", 998, 1<<capKill | 1<<capNetAdmin, Capabilities{EUID: 998, CanKillAny: true, CanModifyNetwork: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveCapabilities(tt.euid, tt.effective); got != tt.want {
+				t.Errorf("resolveCapabilities(%d, %#x) = %+v, want %+v", tt.euid, tt.effective, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadEffectiveCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		want    uint64
+		wantErr bool
+	}{
+		{"full set", "Name:\tcm-utils\nCapInh:\t0000000000000000\nCapEff:\t000001ffffffffff\n", 0x000001ffffffffff, false},
+		{"CAP_SYS_BOOT only", "CapEff:\t0000000000400000\n", 1 << capSysBoot, false},
+		{"missing", "Name:\tcm-utils\n", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useProcFixture(t, map[string]string{"self/status": tt.status})
+			got, err := readEffectiveCapabilities()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("readEffectiveCapabilities() = %#x, %v, want %#x, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogFileAllowlist(t *testing.T) {
+	root := t.TempDir()
+	logs := filepath.Join(root, "logs")
+	writeTestFile(t, filepath.Join(logs, "app.log"), "starting\nready\n")
+	writeTestFile(t, filepath.Join(root, "secret.txt"), "hunter2\n")
+	if err := os.MkdirAll(filepath.Join(logs, "archive"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(logs, "escape.log")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		dirs       string
+		path       string
+		wantStatus int
+	}{
+		{"file in an allowed dir", logs, filepath.Join(logs, "app.log"), http.StatusOK},
+		{"nothing configured", "", filepath.Join(logs, "app.log"), http.StatusForbidden},
+		{"outside the allowlist", logs, filepath.Join(root, "secret.txt"), http.StatusForbidden},
+		{"dot-dot escape", logs, logs + "/../secret.txt", http.StatusForbidden},
+		{"relative path", logs, "app.log", http.StatusForbidden},
+		{"symlink pointing outside", logs, filepath.Join(logs, "escape.log"), http.StatusForbidden},
+		{"missing file in an allowed dir", logs, filepath.Join(logs, "gone.log"), http.StatusNotFound},
+		{"missing file elsewhere doesn't reveal existence", logs, filepath.Join(root, "gone.log"), http.StatusForbidden},
+		{"directory", logs, filepath.Join(logs, "archive"), http.StatusForbidden},
+		{"prefix of an allowed dir isn't inside it", logs, logs + "-old/app.log", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.Contains(tt.name, "symlink") && runtime.GOOS == "windows" {
+				t.Skip("symlinks need privileges on Windows")
+			}
+			t.Setenv("CM_LOG_DIRS", tt.dirs)
+			rec := httptest.NewRecorder()
+			(&App{}).getLogFileHandler(rec, httptest.NewRequest(http.MethodGet, "/api/logs/file?path="+url.QueryEscape(tt.path), nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusOK && strings.Contains(rec.Body.String(), "hunter2") {
+				t.Errorf("rejected response leaked file content: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestTailFile(t *testing.T) {
+	var long strings.Builder
+	for i := range 2000 {
+		fmt.Fprintf(&long, "line %04d of a log that spans several read chunks\n", i)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		n       int
+		want    []string
+	}{
+		{"last lines", "one\ntwo\nthree\nfour\n", 2, []string{"three", "four"}},
+		{"fewer lines than asked", "one\ntwo\n", 10, []string{"one", "two"}},
+		{"no trailing newline", "one\ntwo", 1, []string{"two"}},
+		{"empty file", "", 5, []string{}},
+		{"across chunk boundaries", long.String(), 3, []string{
+			"line 1997 of a log that spans several read chunks",
+			"line 1998 of a log that spans several read chunks",
+			"line 1999 of a log that spans several read chunks",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			writeTestFile(t, path, tt.content)
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			got, err := tailFile(file, tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tailFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowLogsForwardsJournalLines(t *testing.T) {
+	calls := fakeCommands(t, map[string]string{"journalctl": `cat <<'EOF'
+{"__REALTIME_TIMESTAMP":"1714560000000000","_SYSTEMD_UNIT":"cm-utils.service","MESSAGE":"ControlMate Utils starting on [::]:9080/"}
+-- No entries --
+EOF`})
+
+	rec := httptest.NewRecorder()
+	newTestApp(t).followLogsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/logs/follow?unit=cm-utils.service", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream (body %s)", got, rec.Body)
+	}
+	want := "event: log\ndata: {\"__REALTIME_TIMESTAMP\":\"1714560000000000\",\"_SYSTEMD_UNIT\":\"cm-utils.service\",\"MESSAGE\":\"ControlMate Utils starting on [::]:9080/\"}\n\n" +
+		"event: end\ndata: {}\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("stream =\n%q\nwant\n%q", got, want)
+	}
+	if got := calls(); !slices.Equal(got, []string{"journalctl -u cm-utils.service -f -o json --no-pager"}) {
+		t.Errorf("calls = %q", got)
+	}
+}
+
+func TestFollowLogsValidatesUnit(t *testing.T) {
+	tests := []struct {
+		name string
+		unit string
+	}{
+		{"missing", ""},
+		{"option injection", "-f"},
+		{"shell metacharacters", "cm-utils;reboot"},
+		{"path", "../etc/passwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/logs/follow?unit="+url.QueryEscape(tt.unit), nil)
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			newTestApp(t).followLogsHandler(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestMACVendor(t *testing.T) {
+	tests := []struct {
+		mac  string
+		want string
+	}{
+		{"b8:27:eb:12:34:56", "Raspberry Pi Foundation"},
+		{"DC:A6:32:AB:CD:EF", "Raspberry Pi Trading"},
+		{"00-0C-29-01-02-03", "VMware"},
+		{"52:54:00:aa:bb:cc", "QEMU/KVM"},
+		{"02:42:ac:11:00:02", ""},
+		{"not-a-mac", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mac, func(t *testing.T) {
+			if got := macVendor(tt.mac); got != tt.want {
+				t.Errorf("macVendor(%q) = %q, want %q", tt.mac, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProcNetARP(t *testing.T) {
+	content := `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.1      0x1         0x2         b8:27:eb:12:34:56     *        eth0
+192.168.1.50     0x1         0x0         00:00:00:00:00:00     *        eth0
+192.168.1.77     0x1         0x2         02:42:ac:11:00:02     *        wlan0
+`
+	want := []Neighbor{
+		{IP: "192.168.1.1", MAC: "b8:27:eb:12:34:56", Vendor: "Raspberry Pi Foundation", Interface: "eth0"},
+		{IP: "192.168.1.77", MAC: "02:42:ac:11:00:02", Interface: "wlan0"},
+	}
+	if got := parseProcNetARP(content); !slices.Equal(got, want) {
+		t.Errorf("parseProcNetARP() = %+v, want %+v", got, want)
+	}
+}
+
+func TestInheritedListenerFD(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name      string
+		listenFD  string
+		listenFDs string
+		listenPID string
+		want      int
+		wantErr   bool
+	}{
+		{"nothing inherited", "", "", "", -1, false},
+		{"explicit fd", "7", "", "", 7, false},
+		{"invalid explicit fd", "seven", "", "", -1, true},
+		{"negative explicit fd", "-1", "", "", -1, true},
+		{"systemd socket activation", "", "1", pid, listenFDsStart, false},
+		{"activation meant for another process", "", "1", "1", -1, false},
+		{"explicit fd wins over activation", "9", "1", pid, 9, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CM_LISTEN_FD", tt.listenFD)
+			t.Setenv("LISTEN_FDS", tt.listenFDs)
+			t.Setenv("LISTEN_PID", tt.listenPID)
+			got, err := inheritedListenerFD()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("inheritedListenerFD() = %d, %v, want %d, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	content := `# os-release for the gateway image
+PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+NAME="Debian GNU/Linux"
+VERSION_ID="12"
+VERSION="12 (bookworm)"
+ID=debian
+HOME_URL='https://www.debian.org/'
+BUG_REPORT_URL="https://bugs.debian.org/\"quoted\""
+
+not a key value line
+`
+	want := map[string]string{
+		"PRETTY_NAME":    "Debian GNU/Linux 12 (bookworm)",
+		"NAME":           "Debian GNU/Linux",
+		"VERSION_ID":     "12",
+		"VERSION":        "12 (bookworm)",
+		"ID":             "debian",
+		"HOME_URL":       "https://www.debian.org/",
+		"BUG_REPORT_URL": `https://bugs.debian.org/"quoted"`,
+	}
+	if got := parseOSRelease(content); !maps.Equal(got, want) {
+		t.Errorf("parseOSRelease() = %v, want %v", got, want)
+	}
+}
+
+func TestPackageQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []PackageInfo
+	}{
+		{"dpkg-query", "nginx\t1.22.1-9\tinstalled\nopenssl\t3.0.11-1~deb12u2\tinstalled\n", []PackageInfo{
+			{Name: "nginx", Installed: true, Version: "1.22.1-9"},
+			{Name: "openssl", Installed: true, Version: "3.0.11-1~deb12u2"},
+			{Name: "network-manager", Version: "not installed"},
+		}},
+		{"dpkg-query with arch and leftover config", "nginx:arm64\t1.22.1-9\tinstalled\nnetwork-manager\t1.42.4-1\tconfig-files\n", []PackageInfo{
+			{Name: "nginx", Installed: true, Version: "1.22.1-9"},
+			{Name: "openssl", Version: "not installed"},
+			{Name: "network-manager", Version: "not installed"},
+		}},
+		{"rpm", "nginx\t1.20.1-14.el9\tinstalled\npackage openssl is not installed\nNetworkManager\t1.44.0-3.el9\tinstalled\n", []PackageInfo{
+			{Name: "nginx", Installed: true, Version: "1.20.1-14.el9"},
+			{Name: "openssl", Version: "not installed"},
+			{Name: "network-manager", Version: "not installed"},
+		}},
+	}
+
+	names := []string{"nginx", "openssl", "network-manager"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := packageVersions(names, parsePackageQuery(tt.output)); !slices.Equal(got, tt.want) {
+				t.Errorf("packages = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrongestNetworks(t *testing.T) {
+	// A second, weaker Office access point should collapse into the first
+	networks := append(slices.Clone(scanFixture), WiFiNetwork{SSID: "Office", Signal: "60", Security: "WPA2", Band: "2.4GHz"})
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{"top two", 2, []string{"Office", "Office-Guest"}},
+		{"unlimited", 0, []string{"Office", "Office-Guest", "Lab", "Warehouse", "Printer"}},
+		{"limit above count", 10, []string{"Office", "Office-Guest", "Lab", "Warehouse", "Printer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strongestNetworks(networks, tt.limit)
+			if ssids := ssidsOf(got); !slices.Equal(ssids, tt.want) {
+				t.Errorf("ssids = %v, want %v", ssids, tt.want)
+			}
+			if got[0].Signal != "82" {
+				t.Errorf("Office kept signal %q, want the strongest access point", got[0].Signal)
+			}
+		})
+	}
+}
+
+func TestWifiScanLimit(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", 0},
+		{"5", 5},
+		{"-3", 0},
+		{"many", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("CM_WIFI_SCAN_LIMIT", tt.env)
+			if got := wifiScanLimit(); got != tt.want {
+				t.Errorf("wifiScanLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupPublicIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantIP     string
+		wantFamily string
+		wantErr    bool
+	}{
+		{"bare ipv4", http.StatusOK, "203.0.113.7\n", "203.0.113.7", "ipv4", false},
+		{"json ipv4", http.StatusOK, `{"ip":"198.51.100.20"}`, "198.51.100.20", "ipv4", false},
+		{"bare ipv6", http.StatusOK, "2001:db8::1", "2001:db8::1", "ipv6", false},
+		{"not an address", http.StatusOK, "<html>captive portal</html>", "", "", true},
+		{"service error", http.StatusServiceUnavailable, "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			got, err := lookupPublicIP(context.Background(), server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookupPublicIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.IP != tt.wantIP || got.Family != tt.wantFamily || got.Source != server.URL {
+				t.Errorf("lookupPublicIP() = %+v, want ip %s family %s from %s", got, tt.wantIP, tt.wantFamily, server.URL)
+			}
+		})
+	}
+}
+
+func TestParseSignalLevel(t *testing.T) {
+	tests := []struct {
+		signal  string
+		want    int
+		wantLog string
+	}{
+		{"72", 72, ""},
+		{" 100 ", 100, ""},
+		{"142", 100, "Clamping"},
+		{"-5", 0, "Clamping"},
+		{"--", 0, "non-numeric"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.signal, func(t *testing.T) {
+			logs := captureLog(t)
+			if got := parseSignalLevel("Office", tt.signal); got != tt.want {
+				t.Errorf("parseSignalLevel(%q) = %d, want %d", tt.signal, got, tt.want)
+			}
+			if tt.wantLog == "" && logs.Len() > 0 {
+				t.Errorf("unexpected log %q", logs.String())
+			}
+			if tt.wantLog != "" && !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log = %q, want it to mention %q", logs.String(), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestGetKernelHandler(t *testing.T) {
+	app := newTestApp(t)
+	rec := httptest.NewRecorder()
+	app.getKernelHandler(rec, httptest.NewRequest(http.MethodGet, "/api/system/kernel", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var info KernelInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	tests := []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{"system", info.System, ""},
+		{"machine", info.Machine, ""},
+		{"hostname", info.Hostname, hostname},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if tt.got == "" {
+				t.Errorf("%s is empty", tt.field)
+			}
+			if tt.want != "" && tt.got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.field, tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectWiFiHandlerAlreadyConnected(t *testing.T) {
+	if readWiFiRfkill(sysClassRfkillPath).Blocked() {
+		t.Skip("this machine's WiFi radio is blocked")
+	}
+
+	nmcli := `case "$*" in
+*"connection show --active"*) echo 'Office:802-11-wireless:wlan0' ;;
+*"dev wifi list"*) echo 'yes:Office:82:WPA2' ;;
+esac`
+
+	tests := []struct {
+		name        string
+		url         string
+		body        string
+		wantStatus  string
+		wantConnect bool
+	}{
+		{"same network short-circuits", "/api/wifi/connect", `{"ssid":"Office","password":"correct horse","security":"WPA2"}`, "already_connected", false},
+		{"force reconnects", "/api/wifi/connect?force=true", `{"ssid":"Office","password":"correct horse","security":"WPA2"}`, "success", true},
+		{"pinned BSSID reconnects", "/api/wifi/connect", `{"ssid":"Office","password":"correct horse","security":"WPA2","bssid":"AA:BB:CC:DD:EE:01"}`, "success", true},
+		{"other network connects", "/api/wifi/connect", `{"ssid":"Warehouse","password":"correct horse","security":"WPA2"}`, "success", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{"nmcli": nmcli})
+			app := &App{nmcliAvailable: true}
+			rec := httptest.NewRecorder()
+			app.connectWiFiHandler(rec, httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body)))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body)
+			}
+			var result map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result["status"] != tt.wantStatus {
+				t.Errorf("status = %q, want %q", result["status"], tt.wantStatus)
+			}
+			connected := slices.ContainsFunc(calls(), func(call string) bool { return strings.HasPrefix(call, "nmcli dev wifi connect") })
+			if connected != tt.wantConnect {
+				t.Errorf("ran connect = %v, want %v (calls %q)", connected, tt.wantConnect, calls())
+			}
+		})
+	}
+}
+
+func fakePowerSupply(t *testing.T, supplies map[string]map[string]string) string {
+	t.Helper()
+	base := t.TempDir()
+	for name, files := range supplies {
+		for file, content := range files {
+			writeTestFile(t, filepath.Join(base, name, file), content+"\n")
+		}
+	}
+	return base
+}
+
+func TestReadPowerStatus(t *testing.T) {
+	mains := func(online string) map[string]string { return map[string]string{"type": "Mains", "online": online} }
+	battery := func(capacity, status string) map[string]string {
+		return map[string]string{"type": "Battery", "scope": "System", "capacity": capacity, "status": status}
+	}
+
+	tests := []struct {
+		name          string
+		supplies      map[string]map[string]string
+		wantBatteries []BatteryStatus
+		wantAC        string
+		wantOnBattery bool
+	}{
+		{"desktop", map[string]map[string]string{"AC": mains("1")}, []BatteryStatus{}, "online", false},
+		{"charging laptop", map[string]map[string]string{"AC": mains("1"), "BAT0": battery("64", "Charging")},
+			[]BatteryStatus{{Name: "BAT0", Capacity: 64, Status: "Charging"}}, "online", false},
+		{"unplugged laptop", map[string]map[string]string{"AC": mains("0"), "BAT0": battery("41", "Discharging")},
+			[]BatteryStatus{{Name: "BAT0", Capacity: 41, Status: "Discharging"}}, "offline", true},
+		{"ups with no mains reported", map[string]map[string]string{"ups": {"type": "UPS", "capacity": "100", "status": "Discharging"}},
+			[]BatteryStatus{{Name: "ups", Capacity: 100, Status: "Discharging"}}, "unknown", true},
+		{"peripheral battery ignored", map[string]map[string]string{"AC": mains("1"), "hidpp_battery_0": {"type": "Battery", "scope": "Device", "capacity": "15", "status": "Discharging"}},
+			[]BatteryStatus{}, "online", false},
+		{"no power_supply class", nil, []BatteryStatus{}, "unknown", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "missing")
+			if tt.supplies != nil {
+				base = fakePowerSupply(t, tt.supplies)
+			}
+			got := readPowerStatus(base)
+
+			if !slices.Equal(got.Batteries, tt.wantBatteries) {
+				t.Errorf("batteries = %+v, want %+v", got.Batteries, tt.wantBatteries)
+			}
+			if got.HasBattery != (len(tt.wantBatteries) > 0) {
+				t.Errorf("has_battery = %v with %d batteries", got.HasBattery, len(tt.wantBatteries))
+			}
+			ac := "unknown"
+			if got.ACOnline != nil {
+				ac = map[bool]string{true: "online", false: "offline"}[*got.ACOnline]
+			}
+			if ac != tt.wantAC {
+				t.Errorf("ac = %s, want %s", ac, tt.wantAC)
+			}
+			if got.OnBattery != tt.wantOnBattery {
+				t.Errorf("on_battery = %v, want %v", got.OnBattery, tt.wantOnBattery)
+			}
+		})
+	}
+}
+
+func TestBuildManagedArgs(t *testing.T) {
+	tests := []struct {
+		managed bool
+		want    []string
+	}{
+		{true, []string{"device", "set", "eth1", "managed", "yes"}},
+		{false, []string{"device", "set", "eth1", "managed", "no"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.FormatBool(tt.managed), func(t *testing.T) {
+			if got := buildManagedArgs("eth1", tt.managed); !slices.Equal(got, tt.want) {
+				t.Errorf("buildManagedArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyManagedStates(t *testing.T) {
+	states := parseDeviceStates("wlan0:connected\neth0:unmanaged\nlo:unmanaged\np2p-dev-wlan0:disconnected\n")
+	interfaces := []NetworkInterface{{Name: "wlan0"}, {Name: "eth0"}, {Name: "docker0"}}
+	applyManagedStates(interfaces, states)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"wlan0", "true"},
+		{"eth0", "false"},
+		{"docker0", "omitted"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := "omitted"
+			if interfaces[i].Managed != nil {
+				got = strconv.FormatBool(*interfaces[i].Managed)
+			}
+			if got != tt.want {
+				t.Errorf("managed = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetInterfaceManagedHandler(t *testing.T) {
+	loopback := loopbackName(t)
+
+	tests := []struct {
+		name       string
+		nmcli      bool
+		iface      string
+		body       string
+		wantStatus int
+		wantCall   string
+	}{
+		{"unmanage", true, loopback, `{"managed":false}`, http.StatusOK, "nmcli device set " + loopback + " managed no"},
+		{"manage", true, loopback, `{"managed":true}`, http.StatusOK, "nmcli device set " + loopback + " managed yes"},
+		{"missing field", true, loopback, `{}`, http.StatusBadRequest, ""},
+		{"unknown device", true, "nosuchdev0", `{"managed":false}`, http.StatusNotFound, ""},
+		{"no nmcli", false, loopback, `{"managed":false}`, http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{"nmcli": ""})
+			app := &App{nmcliAvailable: tt.nmcli}
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/interfaces/"+tt.iface+"/managed", strings.NewReader(tt.body)),
+				map[string]string{"name": tt.iface})
+			rec := httptest.NewRecorder()
+			app.setInterfaceManagedHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := calls(); tt.wantCall == "" && len(got) > 0 || tt.wantCall != "" && !slices.Contains(got, tt.wantCall) {
+				t.Errorf("calls = %q, want %q", got, tt.wantCall)
+			}
+		})
+	}
+}
+
+func TestFilterNetworksByBand(t *testing.T) {
+	// Parse real-looking nmcli rows so the filter sees bands derived from FREQ
+	networks := parseNmcliOutput("Office:82:WPA2:5180 MHz\n" +
+		"Office-Guest:76::2412 MHz\n" +
+		"Warehouse:40:WPA2:2437 MHz\n" +
+		"Lab:55:WPA3:5955 MHz\n" +
+		"Printer:30:WEP\n")
+
+	tests := []struct {
+		band string
+		want []string
+	}{
+		{"all", []string{"Office", "Office-Guest", "Warehouse", "Lab", "Printer"}},
+		{"2.4", []string{"Office-Guest", "Warehouse"}},
+		{"5", []string{"Office"}},
+		{"6", []string{"Lab"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.band, func(t *testing.T) {
+			if got := ssidsOf(filterNetworksByBand(networks, tt.band)); !slices.Equal(got, tt.want) {
+				t.Errorf("filterNetworksByBand(%q) = %v, want %v", tt.band, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateAuthToken(t *testing.T) {
+	app := newTestApp(t)
+	app.authToken = "original-token"
+	protected := app.requireAuth(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	call := func(handler http.HandlerFunc, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/rotate", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	rec := call(app.requireAuth(app.rotateAuthTokenHandler), "original-token")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var result map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	rotated := result["token"]
+	if len(rotated) != 64 || rotated == "original-token" {
+		t.Fatalf("rotated token = %q, want 32 fresh random bytes in hex", rotated)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"old token rejected", "original-token", http.StatusUnauthorized},
+		{"new token accepted", rotated, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := call(protected, tt.token).Code; got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+
+	t.Run("persisted across restarts", func(t *testing.T) {
+		t.Setenv("CM_AUTH_TOKEN", "original-token")
+		restarted := &App{stateDir: app.stateDir}
+		if got := restarted.loadAuthToken(); got != rotated {
+			t.Errorf("loadAuthToken() = %q, want the rotated token", got)
+		}
+		info, err := os.Stat(app.authTokenFile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+			t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+		}
+	})
+}
+
+func TestCollectDiagnostics(t *testing.T) {
+	quick := func(output string) func(context.Context) ([]byte, error) {
+		return func(context.Context) ([]byte, error) { return []byte(output), nil }
+	}
+	// The stuck section ignores its context entirely, like a command that won't die
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	sections := []diagnosticsSection{
+		{File: "stuck.txt", Collect: func(context.Context) ([]byte, error) { <-stuck; return nil, nil }},
+		{File: "failing.txt", Collect: func(context.Context) ([]byte, error) { return []byte("partial"), errors.New("exit status 1") }},
+	}
+	for i := range 2 * diagnosticsWorkers {
+		sections = append(sections, diagnosticsSection{File: fmt.Sprintf("quick-%d.txt", i), Collect: quick("ok")})
+	}
+
+	start := time.Now()
+	got := map[string]string{}
+	for result := range collectDiagnostics(context.Background(), sections, 100*time.Millisecond) {
+		got[result.file] = string(result.output)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("collection took %v, want the stuck section cut off at its timeout", elapsed)
+	}
+	if len(got) != len(sections) {
+		t.Errorf("got %d results, want one per section (%d)", len(got), len(sections))
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"stuck.error.txt", "section did not finish"},
+		{"failing.error.txt", "exit status 1\n\npartial"},
+		{"quick-0.txt", "ok"},
+		{fmt.Sprintf("quick-%d.txt", 2*diagnosticsWorkers-1), "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			output, ok := got[tt.file]
+			if !ok {
+				t.Fatalf("missing %s in %v", tt.file, slices.Sorted(maps.Keys(got)))
+			}
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("%s = %q, want it to contain %q", tt.file, output, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessCgroup(t *testing.T) {
+	const id = "4f5c8a1e2b3d4c5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6"
+	tests := []struct {
+		name     string
+		content  string
+		wantPath string
+		wantID   string
+	}{
+		{"docker v1", "12:pids:/docker/" + id + "\n11:memory:/docker/" + id + "\n1:name=systemd:/docker/" + id + "\n",
+			"/docker/" + id, id},
+		{"docker systemd driver v2", "0::/system.slice/docker-" + id + ".scope\n", "/system.slice/docker-" + id + ".scope", id},
+		{"containerd under kubepods", "0::/kubepods.slice/kubepods-burstable.slice/cri-containerd-" + id + ".scope\n",
+			"/kubepods.slice/kubepods-burstable.slice/cri-containerd-" + id + ".scope", id},
+		{"systemd service", "0::/system.slice/NetworkManager.service\n", "/system.slice/NetworkManager.service", ""},
+		{"user session", "0::/user.slice/user-1000.slice/session-3.scope\n", "/user.slice/user-1000.slice/session-3.scope", ""},
+		{"hybrid prefers unified", "1:name=systemd:/init.scope\n0::/system.slice/ssh.service\n", "/system.slice/ssh.service", ""},
+		{"v1 root only", "3:cpu,cpuacct:/\n", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := parseProcCgroup(tt.content)
+			if path != tt.wantPath {
+				t.Errorf("parseProcCgroup() = %q, want %q", path, tt.wantPath)
+			}
+			if got := containerIDFromCgroup(path); got != tt.wantID {
+				t.Errorf("containerIDFromCgroup(%q) = %q, want %q", path, got, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestRebootWithFallbacks(t *testing.T) {
+	commands := [][]string{{"systemctl", "reboot", "-i"}, {"reboot"}, {"shutdown", "-r", "now"}}
+	denied := errors.New("exit status 1 (output: Failed to set wall message, ignoring: Interactive authentication required.)")
+	notPermitted := errors.New("exit status 1 (output: reboot: Operation not permitted)")
+	missing := errors.New(`exec: "shutdown": executable file not found in $PATH`)
+
+	tests := []struct {
+		name          string
+		errs          map[string]error
+		canReboot     bool
+		wantErr       error
+		wantForbidden bool
+		wantTried     []string
+	}{
+		{"first command works", map[string]error{}, true, nil, false, []string{"systemctl"}},
+		{"falls back to reboot", map[string]error{"systemctl": missing}, true, nil, false, []string{"systemctl", "reboot"}},
+		{"every fallback denied", map[string]error{"systemctl": denied, "reboot": notPermitted, "shutdown": notPermitted}, true, notPermitted, true,
+			[]string{"systemctl", "reboot", "shutdown"}},
+		{"mixed failures without the capability", map[string]error{"systemctl": denied, "reboot": notPermitted, "shutdown": missing}, false, missing, true,
+			[]string{"systemctl", "reboot", "shutdown"}},
+		{"mixed failures with the capability", map[string]error{"systemctl": denied, "reboot": notPermitted, "shutdown": missing}, true, missing, false,
+			[]string{"systemctl", "reboot", "shutdown"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tried []string
+			run := func(name string, args ...string) error {
+				tried = append(tried, name)
+				return tt.errs[name]
+			}
+
+			err := rebootWithFallbacks(commands, run, tt.canReboot)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("rebootWithFallbacks() = %v, want success", err)
+			}
+			if tt.wantErr != nil && (err == nil || !strings.Contains(err.Error(), tt.wantErr.Error())) {
+				t.Errorf("rebootWithFallbacks() = %v, want it to report %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, errRebootNotPermitted); got != tt.wantForbidden {
+				t.Errorf("errors.Is(errRebootNotPermitted) = %v, want %v", got, tt.wantForbidden)
+			}
+			if !slices.Equal(tried, tt.wantTried) {
+				t.Errorf("tried %q, want %q", tried, tt.wantTried)
+			}
+		})
+	}
+}
+
+func TestInterfaceTransition(t *testing.T) {
+	up := interfaceState{status: "up", carrier: true}
+	tests := []struct {
+		name     string
+		previous map[string]interfaceState
+		current  map[string]interfaceState
+		wantFrom string
+		wantTo   string
+	}{
+		{"cable unplugged", map[string]interfaceState{"eth0": up}, map[string]interfaceState{"eth0": {status: "up"}}, "up", "up (no carrier)"},
+		{"brought down", map[string]interfaceState{"eth0": up}, map[string]interfaceState{"eth0": {status: "down"}}, "up", "down"},
+		{"hotplugged", map[string]interfaceState{}, map[string]interfaceState{"eth0": up}, "absent", "up"},
+		{"removed", map[string]interfaceState{"eth0": up}, map[string]interfaceState{}, "up", "removed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := InterfaceEvent{Name: "eth0", Time: "2024-05-01T12:00:00Z"}
+			want := InterfaceTransition{Interface: "eth0", From: tt.wantFrom, To: tt.wantTo, Time: event.Time}
+			if got := interfaceTransition(tt.previous, tt.current, event); got != want {
+				t.Errorf("interfaceTransition() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestInterfaceHistoryCap(t *testing.T) {
+	tests := []struct {
+		name      string
+		recorded  int
+		wantFirst int
+	}{
+		{"under the cap", 3, 0},
+		{"at the cap", maxInterfaceHistory, 0},
+		{"oldest evicted", maxInterfaceHistory + 25, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			for i := range tt.recorded {
+				app.recordInterfaceTransition(InterfaceTransition{Interface: "eth0", From: "up", To: "down", Time: strconv.Itoa(i)})
+			}
+
+			history := app.InterfaceHistory()
+			if want := min(tt.recorded, maxInterfaceHistory); len(history) != want {
+				t.Fatalf("history has %d entries, want %d", len(history), want)
+			}
+			for i, transition := range history {
+				if want := strconv.Itoa(tt.wantFirst + i); transition.Time != want {
+					t.Fatalf("entry %d is transition %s, want %s (oldest first)", i, transition.Time, want)
+				}
+			}
+		})
+	}
+
+	t.Run("handler", func(t *testing.T) {
+		app := newTestApp(t)
+		rec := httptest.NewRecorder()
+		app.getInterfaceHistoryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/interfaces/history", nil))
+		if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+			t.Errorf("empty history = %s, want []", body)
+		}
+	})
+}
+
+func TestProcessesNDJSON(t *testing.T) {
+	fakeCommands(t, map[string]string{"ps": "cat <<'EOF'\n" + psAuxFixture + "EOF"})
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+	}{
+		{"ndjson", "application/x-ndjson", "application/x-ndjson"},
+		{"default array", "application/json", "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			req := httptest.NewRequest(http.MethodGet, "/api/processes", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			app.getProcessesHandler(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+
+			var processes []Process
+			if tt.wantContentType == "application/json" {
+				if err := json.Unmarshal(rec.Body.Bytes(), &processes); err != nil {
+					t.Fatalf("default response is not a JSON array: %v", err)
+				}
+			} else {
+				scanner := bufio.NewScanner(rec.Body)
+				for scanner.Scan() {
+					var process Process
+					if err := json.Unmarshal(scanner.Bytes(), &process); err != nil {
+						t.Fatalf("line %q is not a Process: %v", scanner.Text(), err)
+					}
+					processes = append(processes, process)
+				}
+			}
+
+			// kthreadd is filtered out by default
+			pids := []int{}
+			for _, process := range processes {
+				pids = append(pids, process.PID)
+			}
+			if want := []int{1, 612, 1042, 1200}; !slices.Equal(pids, want) {
+				t.Errorf("pids = %v, want %v", pids, want)
+			}
+		})
+	}
+}
+
+func TestRunHealSteps(t *testing.T) {
+	tests := []struct {
+		name          string
+		recoverAfter  int
+		failStep      string
+		wantRecovered string
+		wantSteps     []HealStepResult
+	}{
+		{"reapply restores", 1, "", "reapply", []HealStepResult{{Step: "reapply", Internet: true}}},
+		{"reconnect restores", 2, "", "reconnect", []HealStepResult{
+			{Step: "reapply"},
+			{Step: "reconnect", Internet: true},
+		}},
+		{"nothing helps", 0, "", "", []HealStepResult{{Step: "reapply"}, {Step: "reconnect"}}},
+		{"failed step still checked", 1, "reapply", "reapply", []HealStepResult{
+			{Step: "reapply", Error: "reapply failed", Internet: true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			step := func(name string) healStep {
+				return healStep{name: name, run: func() error {
+					ran = append(ran, name)
+					if name == tt.failStep {
+						return errors.New(name + " failed")
+					}
+					return nil
+				}}
+			}
+			// Connectivity comes back once the recoverAfter'th step has run
+			online := func() bool { return tt.recoverAfter > 0 && len(ran) >= tt.recoverAfter }
+
+			recovered, steps := runHealSteps([]healStep{step("reapply"), step("reconnect")}, online)
+			if recovered != tt.wantRecovered {
+				t.Errorf("recovered by %q, want %q", recovered, tt.wantRecovered)
+			}
+			if !slices.Equal(steps, tt.wantSteps) {
+				t.Errorf("steps = %+v, want %+v", steps, tt.wantSteps)
+			}
+		})
+	}
+}
+
+func TestBuildWiFiHealSteps(t *testing.T) {
+	calls := fakeCommands(t, map[string]string{"nmcli": `case "$*" in *down*) exit 10 ;; esac`})
+	steps := buildWiFiHealSteps("wlan0", "Office")
+
+	tests := []struct {
+		step      string
+		wantCalls []string
+	}{
+		{"reapply", []string{"nmcli device reapply wlan0"}},
+		{"reconnect", []string{"nmcli connection down id Office", "nmcli connection up id Office"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.step, func(t *testing.T) {
+			before := len(calls())
+			if steps[i].name != tt.step {
+				t.Fatalf("step %d = %s, want %s", i, steps[i].name, tt.step)
+			}
+			if err := steps[i].run(); err != nil {
+				t.Errorf("run() = %v, want a failed down to be tolerated", err)
+			}
+			if got := calls()[before:]; !slices.Equal(got, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestNormalizeBasePath(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"cm", "/cm"},
+		{"/cm/", "/cm"},
+		{" /tools/cm/ ", "/tools/cm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := normalizeBasePath(tt.value); got != tt.want {
+				t.Errorf("normalizeBasePath(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutesUnderBasePath(t *testing.T) {
+	app := newTestApp(t)
+	app.basePath = "/cm"
+	routes := app.routes()
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+		wantBody     []string
+	}{
+		{"home page uses prefixed assets", "/cm/", http.StatusOK, "", []string{
+			`href="/cm/static/styles.css"`, `src="/cm/static/app.js"`, `href="/cm/processes"`,
+		}},
+		{"api under prefix", "/cm/api/version", http.StatusOK, "", nil},
+		{"static under prefix", "/cm/static/styles.css", http.StatusOK, "", nil},
+		{"bare prefix redirects", "/cm", http.StatusMovedPermanently, "/cm/", nil},
+		{"unprefixed api is gone", "/api/version", http.StatusNotFound, "", nil},
+		{"unprefixed static is gone", "/static/styles.css", http.StatusNotFound, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %.200s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body is missing %s", want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadEntropy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    EntropyStatus
+		wantErr bool
+	}{
+		{"healthy pool", "3021\n", EntropyStatus{Available: 3021, Threshold: lowEntropyThreshold}, false},
+		{"at threshold", "256\n", EntropyStatus{Available: 256, Threshold: lowEntropyThreshold}, false},
+		{"starved at boot", "97\n", EntropyStatus{Available: 97, Threshold: lowEntropyThreshold, Low: true}, false},
+		{"garbage", "lots\n", EntropyStatus{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "entropy_avail")
+			writeTestFile(t, path, tt.content)
+
+			got, err := readEntropy(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readEntropy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readEntropy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("handler", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("entropy is only reported on Linux")
+		}
+		useProcFixture(t, map[string]string{"stat": "cpu  1 2 3 4\n", "sys/kernel/random/entropy_avail": "97\n"})
+		rec := httptest.NewRecorder()
+		newTestApp(t).getEntropyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/system/entropy", nil))
+
+		var got EntropyStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s (%v)", rec.Code, rec.Body, err)
+		}
+		if !got.Low || got.Available != 97 {
+			t.Errorf("entropy = %+v, want 97 flagged low", got)
+		}
+	})
+}
+
+func TestWPSConnectRequiresWpaCli(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	rec := httptest.NewRecorder()
+	newTestApp(t).wpsConnectHandler(rec, httptest.NewRequest(http.MethodPost, "/api/wifi/wps", nil))
+
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "wpa_cli") {
+		t.Errorf("status = %d, body %s; want 503 naming wpa_cli", rec.Code, rec.Body)
+	}
+}
+
+func TestStartWPSPushButton(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"accepted", "echo OK", ""},
+		{"rejected", "echo FAIL", "rejected WPS request: FAIL"},
+		{"no supplicant", "echo \"Failed to connect to non-global ctrl_ifname: wlan0\"; exit 255", "failed to start WPS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{"wpa_cli": tt.script})
+			err := startWPSPushButton("wlan0")
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("startWPSPushButton() = %v, want %q", err, tt.wantErr)
+			}
+			if want := []string{"wpa_cli -i wlan0 wps_pbc"}; !slices.Equal(calls(), want) {
+				t.Errorf("calls = %q, want %q", calls(), want)
+			}
+		})
+	}
+}
+
+func TestWpaStatus(t *testing.T) {
+	fakeCommands(t, map[string]string{"wpa_cli": "printf 'bssid=aa:bb:cc:dd:ee:01\\nssid=HomeAP\\nwpa_state=COMPLETED\\nip_address=192.168.1.20\\n'"})
+	status, err := wpaStatus("wlan0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status["wpa_state"] != "COMPLETED" || status["ssid"] != "HomeAP" {
+		t.Errorf("wpaStatus() = %v, want a completed association to HomeAP", status)
+	}
+}
+
+func TestWaitForWPSConnection(t *testing.T) {
+	scanning := map[string]string{"wpa_state": "SCANNING"}
+	completed := map[string]string{"wpa_state": "COMPLETED", "ssid": "HomeAP"}
+
+	tests := []struct {
+		name          string
+		states        []map[string]string
+		cancel        bool
+		wantSSID      string
+		wantConnected bool
+		wantPolls     int
+	}{
+		{"already associated", []map[string]string{completed}, false, "HomeAP", true, 1},
+		{"completes on third poll", []map[string]string{scanning, {"wpa_state": "ASSOCIATING"}, completed}, false, "HomeAP", true, 3},
+		{"times out", []map[string]string{scanning}, false, "", false, 0},
+		{"client gives up", []map[string]string{scanning}, true, "", false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			polls := 0
+			status := func() (map[string]string, error) {
+				state := tt.states[min(polls, len(tt.states)-1)]
+				polls++
+				return state, nil
+			}
+			ssid, connected := waitForWPSConnection(ctx, status, 50*time.Millisecond, time.Millisecond)
+			if ssid != tt.wantSSID || connected != tt.wantConnected {
+				t.Errorf("waitForWPSConnection() = %q, %v, want %q, %v", ssid, connected, tt.wantSSID, tt.wantConnected)
+			}
+			if tt.wantPolls > 0 && polls != tt.wantPolls {
+				t.Errorf("polled %d times, want %d", polls, tt.wantPolls)
+			}
+		})
+	}
+}
+
+const meminfoFixture = `MemTotal:        3884292 kB
+MemFree:          412340 kB
+MemAvailable:    2741104 kB
+Buffers:          154820 kB
+Cached:          2010532 kB
+SwapCached:            0 kB
+Shmem:             48212 kB
+Slab:             231056 kB
+SReclaimable:     170944 kB
+HugePages_Total:       0
+`
+
+func TestMemoryInfoFromMeminfo(t *testing.T) {
+	const kib = 1024
+	tests := []struct {
+		name    string
+		content string
+		want    MemoryInfo
+	}{
+		{"full breakdown", meminfoFixture, MemoryInfo{
+			Total:       3884292 * kib,
+			Free:        412340 * kib,
+			Available:   2741104 * kib,
+			Used:        (3884292 - 2741104) * kib,
+			Buffers:     154820 * kib,
+			Cached:      2010532 * kib,
+			Slab:        231056 * kib,
+			Reclaimable: 170944 * kib,
+			Shmem:       48212 * kib,
+		}},
+		{"old kernel without MemAvailable", "MemTotal: 1000 kB\nMemFree: 200 kB\n", MemoryInfo{
+			Total: 1000 * kib,
+			Free:  200 * kib,
+			Used:  1000 * kib,
+		}},
+		{"empty", "", MemoryInfo{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := memoryInfoFromMeminfo(parseMeminfo(tt.content)); got != tt.want {
+				t.Errorf("memoryInfoFromMeminfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMeminfoUnits(t *testing.T) {
+	values := parseMeminfo(meminfoFixture)
+	tests := []struct {
+		key  string
+		want uint64
+	}{
+		{"MemTotal", 3884292 * 1024},
+		{"SwapCached", 0},
+		{"HugePages_Total", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := values[tt.key]
+			if !ok || got != tt.want {
+				t.Errorf("%s = %d (present %v), want %d", tt.key, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterKernelThreads(t *testing.T) {
+	processes, err := parsePsAuxOutput(psAuxFixture + "root          17  0.0  0.0      0     0 ?        I<   Oct13   0:00 [kworker/0:1H-kblockd]\n" +
+		"pi          1300  0.0  0.1   6000  2000 pts/0    S+   Oct13   0:00 grep [n]ginx\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		include bool
+		want    []int
+	}{
+		{"userspace only", false, []int{1, 612, 1042, 1200, 1300}},
+		{"with kernel threads", true, []int{1, 2, 612, 1042, 1200, 17, 1300}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := processes
+			if !tt.include {
+				got = filterKernelThreads(processes)
+			}
+			pids := []int{}
+			for _, process := range got {
+				pids = append(pids, process.PID)
+			}
+			if !slices.Equal(pids, tt.want) {
+				t.Errorf("pids = %v, want %v", pids, tt.want)
+			}
+		})
+	}
+
+	t.Run("query toggle", func(t *testing.T) {
+		fakeCommands(t, map[string]string{"ps": "cat <<'EOF'\n" + psAuxFixture + "EOF"})
+		for query, wantKthreadd := range map[string]bool{"": false, "?kernel=false": false, "?kernel=true": true} {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/processes"+query, nil)
+			newTestApp(t).getProcessesHandler(rec, req)
+			if got := strings.Contains(rec.Body.String(), "[kthreadd]"); got != wantKthreadd {
+				t.Errorf("%q includes kthreadd = %v, want %v", query, got, wantKthreadd)
+			}
+		}
+	})
+}
+
+func TestMACPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		wantOK   bool
+		wantScan bool
+		wantConf []string
+	}{
+		{"random", "random", true, true, []string{"wifi.scan-rand-mac-address=yes", "wifi.cloned-mac-address=random"}},
+		{"stable", "stable", true, true, []string{"wifi.scan-rand-mac-address=yes", "wifi.cloned-mac-address=stable"}},
+		{"permanent", "permanent", true, false, []string{"wifi.scan-rand-mac-address=no", "wifi.cloned-mac-address=permanent"}},
+		{"unknown", "preserve", false, false, nil},
+		{"case sensitive", "Random", false, false, nil},
+		{"empty", "", false, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, ok := macPolicyFor(tt.policy)
+			if ok != tt.wantOK {
+				t.Fatalf("macPolicyFor(%q) ok = %v, want %v", tt.policy, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if policy.ScanRandomMAC != tt.wantScan || policy.ClonedMACAddress != tt.policy {
+				t.Errorf("macPolicyFor(%q) = %+v", tt.policy, policy)
+			}
+
+			conf := macPolicyConf(policy)
+			for _, want := range tt.wantConf {
+				if !strings.Contains(conf, want+"\n") {
+					t.Errorf("drop-in is missing %s:\n%s", want, conf)
+				}
+			}
+
+			// What's written must read back as the same policy
+			path := filepath.Join(t.TempDir(), "90-cm-utils-mac-policy.conf")
+			if err := writeMACPolicy(path, policy); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := readMACPolicy(path); err != nil || got != policy {
+				t.Errorf("readMACPolicy() = %+v, %v, want %+v", got, err, policy)
+			}
+		})
+	}
+
+	t.Run("defaults without a drop-in", func(t *testing.T) {
+		want := MACPolicy{Policy: "default", ScanRandomMAC: true, ClonedMACAddress: "preserve"}
+		if got, err := readMACPolicy(filepath.Join(t.TempDir(), "missing.conf")); err != nil || got != want {
+			t.Errorf("readMACPolicy() = %+v, %v, want %+v", got, err, want)
+		}
+	})
+
+	t.Run("handler rejects invalid policy", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		app := &App{nmcliAvailable: true}
+		app.setMACPolicyHandler(rec, httptest.NewRequest(http.MethodPost, "/api/wifi/mac-policy", strings.NewReader(`{"policy":"sometimes"}`)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rec.Code)
+		}
+	})
+}
+
+func TestReadWiFiRfkill(t *testing.T) {
+	radio := func(kind, soft, hard string) map[string]string {
+		return map[string]string{"type": kind, "soft": soft, "hard": hard}
+	}
+
+	tests := []struct {
+		name     string
+		switches map[string]map[string]string
+		want     RfkillState
+	}{
+		{"unblocked", map[string]map[string]string{"rfkill0": radio("wlan", "0", "0")}, RfkillState{}},
+		{"soft blocked", map[string]map[string]string{"rfkill0": radio("wlan", "1", "0")}, RfkillState{Soft: true}},
+		{"hard switch", map[string]map[string]string{"rfkill0": radio("wlan", "0", "1")}, RfkillState{Hard: true}},
+		{"both", map[string]map[string]string{"rfkill0": radio("wlan", "1", "1")}, RfkillState{Soft: true, Hard: true}},
+		{"bluetooth ignored", map[string]map[string]string{
+			"rfkill0": radio("bluetooth", "1", "1"),
+			"rfkill1": radio("wlan", "0", "0"),
+		}, RfkillState{}},
+		{"any blocked radio counts", map[string]map[string]string{
+			"rfkill1": radio("wlan", "0", "0"),
+			"rfkill2": radio("wlan", "1", "0"),
+		}, RfkillState{Soft: true}},
+		{"no rfkill class", nil, RfkillState{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "rfkill")
+			for name, files := range tt.switches {
+				for file, content := range files {
+					writeTestFile(t, filepath.Join(base, name, file), content+"\n")
+				}
+			}
+
+			got := readWiFiRfkill(base)
+			if got != tt.want {
+				t.Errorf("readWiFiRfkill() = %+v, want %+v", got, tt.want)
+			}
+			if got.Blocked() != (tt.want.Soft || tt.want.Hard) {
+				t.Errorf("Blocked() = %v for %+v", got.Blocked(), got)
+			}
+		})
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	valid := signSessionCookie("s3cret", now.Add(sessionTTL))
+	expiry, signature, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  bool
+	}{
+		{"valid", "s3cret", valid, true},
+		{"expired", "s3cret", signSessionCookie("s3cret", now.Add(-time.Minute)), false},
+		{"expiry extended", "s3cret", strconv.FormatInt(now.Add(365*24*time.Hour).Unix(), 10) + "." + signature, false},
+		{"signature altered", "s3cret", expiry + "." + strings.Repeat("0", len(signature)), false},
+		{"signed with a rotated token", "n3w-token", valid, false},
+		{"not hex", "s3cret", expiry + ".zz", false},
+		{"no signature", "s3cret", expiry, false},
+		{"empty", "s3cret", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validSessionCookie(tt.key, tt.value, now); got != tt.want {
+				t.Errorf("validSessionCookie(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCookie  bool
+	}{
+		{"json login", "application/json", `{"token":"s3cret"}`, http.StatusOK, true},
+		{"form login redirects", "application/x-www-form-urlencoded", "token=s3cret", http.StatusSeeOther, true},
+		{"wrong token", "application/json", `{"token":"guess"}`, http.StatusUnauthorized, false},
+		{"wrong token on the form", "application/x-www-form-urlencoded", "token=guess", http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.authToken = "s3cret"
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			app.loginHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			cookies := rec.Result().Cookies()
+			if got := len(cookies) == 1 && cookies[0].Name == sessionCookieName; got != tt.wantCookie {
+				t.Fatalf("session cookie set = %v, want %v (%v)", got, tt.wantCookie, cookies)
+			}
+			if !tt.wantCookie {
+				return
+			}
+			if !cookies[0].HttpOnly {
+				t.Error("session cookie is not HttpOnly")
+			}
+
+			// The cookie alone must get past requireAuth
+			protected := httptest.NewRequest(http.MethodGet, "/api/wifi/saved", nil)
+			protected.AddCookie(cookies[0])
+			if !requestAuthenticated(protected, "s3cret", time.Now()) {
+				t.Error("the issued cookie does not authenticate requests")
+			}
+		})
+	}
+}
+
+func TestParseWireGuardDump(t *testing.T) {
+	handshake := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Unix()
+	dump := "wg0\tcHJpdmF0ZQ==\tc2VydmVyLXB1Yg==\t51820\toff\n" +
+		fmt.Sprintf("wg0\tcGVlci1vbmU=\t(none)\t203.0.113.9:51820\t10.8.0.2/32,fd00::2/128\t%d\t18244\t9352\t25\n", handshake) +
+		"wg0\tcGVlci10d28=\t(none)\t(none)\t(none)\t0\t0\t0\toff\n" +
+		"wg1\tcHJpdmF0ZTI=\taHViLXB1Yg==\t0\t0x1234\n"
+
+	want := []WireGuardInterface{
+		{Name: "wg0", PublicKey: "c2VydmVyLXB1Yg==", ListenPort: 51820, Peers: []WireGuardPeer{
+			{
+				PublicKey:           "cGVlci1vbmU=",
+				Endpoint:            "203.0.113.9:51820",
+				AllowedIPs:          []string{"10.8.0.2/32", "fd00::2/128"},
+				LatestHandshake:     time.Unix(handshake, 0).Format(time.RFC3339),
+				RxBytes:             18244,
+				TxBytes:             9352,
+				PersistentKeepalive: 25,
+			},
+			{PublicKey: "cGVlci10d28=", AllowedIPs: []string{}},
+		}},
+		{Name: "wg1", PublicKey: "aHViLXB1Yg==", Peers: []WireGuardPeer{}},
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   []WireGuardInterface
+	}{
+		{"interfaces and peers", dump, want},
+		{"no interfaces", "", []WireGuardInterface{}},
+		{"peer without its interface line", "wg9\tcGVlcg==\t(none)\t(none)\t(none)\t0\t0\t0\toff\n", []WireGuardInterface{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseWireGuardDump(tt.output)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWireGuardDump() = %+v, want %+v", got, tt.want)
+			}
+			if body, _ := json.Marshal(got); strings.Contains(string(body), "cHJpdmF0ZQ") {
+				t.Error("the private key leaked into the response")
+			}
+		})
+	}
+}
+
+func TestWireGuardNamePattern(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"wg0", true},
+		{"office-vpn.1", true},
+		{"", false},
+		{"sixteen-chars-xx", false},
+		{"../wg0", false},
+		{"wg0;reboot", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wireGuardNamePattern.MatchString(tt.name); got != tt.want {
+				t.Errorf("valid(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottleDetection(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   []string
+		second  []string
+		wantOK  bool
+		wantNow bool
+	}{
+		{"counters grew", []string{"12", "3"}, []string{"12", "7"}, true, true},
+		{"counters unchanged", []string{"12", "3"}, []string{"12", "3"}, true, false},
+		{"no throttle counters (ARM)", nil, nil, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			writeTestFile(t, filepath.Join(base, "cpuidle", "current_driver"), "intel_idle\n")
+			sample := func(counts []string) (uint64, bool) {
+				for i, count := range counts {
+					writeTestFile(t, filepath.Join(base, fmt.Sprintf("cpu%d", i), "thermal_throttle", "core_throttle_count"), count+"\n")
+				}
+				return readThrottleCount(base)
+			}
+
+			app := newTestApp(t)
+			total, ok := sample(tt.first)
+			if ok != tt.wantOK {
+				t.Fatalf("readThrottleCount() ok = %v, want %v", ok, tt.wantOK)
+			}
+			// The first sample is only a baseline, however high the boot-time counters are
+			if app.sampleThrottling(total, ok) {
+				t.Error("first sample reported throttling")
+			}
+			if got := app.sampleThrottling(sample(tt.second)); got != tt.wantNow {
+				t.Errorf("second sample throttled = %v, want %v", got, tt.wantNow)
+			}
+		})
+	}
+
+	t.Run("sums every core", func(t *testing.T) {
+		base := t.TempDir()
+		for i, count := range []string{"5", "0", "11"} {
+			writeTestFile(t, filepath.Join(base, fmt.Sprintf("cpu%d", i), "thermal_throttle", "core_throttle_count"), count+"\n")
+		}
+		if total, ok := readThrottleCount(base); total != 16 || !ok {
+			t.Errorf("readThrottleCount() = %d, %v, want 16, true", total, ok)
+		}
+	})
+}
+
+func TestAutoscanWiFi(t *testing.T) {
+	app := newTestApp(t)
+	var scans atomic.Int32
+	scan := func(ctx context.Context, device string) ([]WiFiNetwork, error) {
+		scans.Add(1)
+		return slices.Clone(scanFixture), nil
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.autoscanWiFi(ctx, 10*time.Millisecond, scan)
+		close(stopped)
+	}()
+
+	device := defaultScanDevice()
+	waitFor("the first background scan to fill the cache", func() bool {
+		networks, _ := app.cachedScan(device)
+		return len(networks) == len(scanFixture)
+	})
+	_, firstAt := app.cachedScan(device)
+	waitFor("the cache to be refreshed", func() bool {
+		_, at := app.cachedScan(device)
+		return at.After(firstAt)
+	})
+
+	// A scan already running when the connect starts may finish; none may start after it
+	endConnect := app.beginConnect()
+	time.Sleep(20 * time.Millisecond)
+	paused := scans.Load()
+	time.Sleep(100 * time.Millisecond)
+	if got := scans.Load(); got != paused {
+		t.Errorf("%d scans ran during a connect attempt", got-paused)
+	}
+	endConnect()
+	waitFor("scanning to resume after the connect", func() bool { return scans.Load() > paused })
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("autoscan did not stop when its context was cancelled")
+	}
+
+	if networks, _ := app.cachedScan(device + "-other"); networks != nil {
+		t.Errorf("cache for another device = %v, want none", networks)
+	}
+}
+
+func TestWiFiNetworksScanCacheAge(t *testing.T) {
+	if readWiFiRfkill(sysClassRfkillPath).Blocked() {
+		t.Skip("this machine's WiFi radio is blocked")
+	}
+	t.Setenv("CM_WIFI_AUTOSCAN_INTERVAL", "60s")
+
+	tests := []struct {
+		name     string
+		age      time.Duration
+		wantScan bool
+	}{
+		{"fresh cache is served", 30 * time.Second, false},
+		{"cache within two intervals is served", 110 * time.Second, false},
+		{"stalled cache is rescanned", 3 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeCommands(t, map[string]string{"nmcli": fakeNmcliScan("Error: Scanning not allowed while already scanning.", nmcliScanFixture)})
+			app := &App{nmcliAvailable: true}
+			app.storeScan(defaultScanDevice(), []WiFiNetwork{{SSID: "Cached", Signal: "50"}}, time.Now().Add(-tt.age))
+
+			rec := httptest.NewRecorder()
+			app.getWiFiNetworksHandler(rec, httptest.NewRequest(http.MethodGet, "/api/wifi/networks", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body)
+			}
+
+			scanned := slices.ContainsFunc(calls(), func(call string) bool { return strings.Contains(call, "rescan") })
+			if scanned != tt.wantScan {
+				t.Errorf("scanned = %v, want %v (calls %q)", scanned, tt.wantScan, calls())
+			}
+			if cached := strings.Contains(rec.Body.String(), `"Cached"`); cached == tt.wantScan {
+				t.Errorf("served cached networks = %v, want %v (body %s)", cached, !tt.wantScan, rec.Body)
+			}
+			if hasAge := rec.Header().Get("X-Scan-Age") != ""; hasAge == tt.wantScan {
+				t.Errorf("X-Scan-Age set = %v, want %v", hasAge, !tt.wantScan)
+			}
+		})
+	}
+}
+
+func TestWifiAutoscanInterval(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", 0},
+		{"90s", 90 * time.Second},
+		{"1s", minWiFiAutoscanInterval},
+		{"0s", 0},
+		{"often", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("CM_WIFI_AUTOSCAN_INTERVAL", tt.env)
+			captureLog(t)
+			if got := wifiAutoscanInterval(); got != tt.want {
+				t.Errorf("wifiAutoscanInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffProcesses(t *testing.T) {
+	baseline := []Process{
+		{PID: 1, Name: "systemd", CPU: "0.0", Memory: "0.3"},
+		{PID: 612, Name: "NetworkManager", CPU: "0.1", Memory: "0.5"},
+		{PID: 1042, Name: "python3", CPU: "2.5", Memory: "4.1"},
+		{PID: 1200, Name: "nginx", CPU: "0.3", Memory: "1.2"},
+	}
+	current := []Process{
+		{PID: 1, Name: "systemd", CPU: "0.0", Memory: "0.3"},
+		{PID: 612, Name: "NetworkManager", CPU: "3.0", Memory: "0.5"},
+		{PID: 1042, Name: "python3", CPU: "48.0", Memory: "4.1"},
+		// The PID was reused by a different program, so nginx exited and this one started
+		{PID: 1200, Name: "sh", CPU: "0.0", Memory: "0.1"},
+		{PID: 2301, Name: "rsync", CPU: "12.0", Memory: "0.8"},
+	}
+
+	tests := []struct {
+		name        string
+		before      []Process
+		after       []Process
+		wantStarted []string
+		wantExited  []string
+		wantChanged []string
+	}{
+		{"after an incident", baseline, current, []string{"1200 sh", "2301 rsync"}, []string{"1200 nginx"}, []string{"1042 python3"}},
+		{"nothing changed", baseline, baseline, []string{}, []string{}, []string{}},
+		{"empty baseline", nil, baseline[:1], []string{"1 systemd"}, []string{}, []string{}},
+	}
+
+	describe := func(pid int, name string) string { return fmt.Sprintf("%d %s", pid, name) }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffProcesses(tt.before, tt.after)
+			started, exited, changed := []string{}, []string{}, []string{}
+			for _, p := range diff.Started {
+				started = append(started, describe(p.PID, p.Name))
+			}
+			for _, p := range diff.Exited {
+				exited = append(exited, describe(p.PID, p.Name))
+			}
+			for _, c := range diff.Changed {
+				changed = append(changed, describe(c.PID, c.Name))
+			}
+
+			if !slices.Equal(started, tt.wantStarted) {
+				t.Errorf("started = %v, want %v", started, tt.wantStarted)
+			}
+			if !slices.Equal(exited, tt.wantExited) {
+				t.Errorf("exited = %v, want %v", exited, tt.wantExited)
+			}
+			if !slices.Equal(changed, tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestPrimaryAddresses(t *testing.T) {
+	cidr := func(value string) net.Addr {
+		ip, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		return ipNet
+	}
+
+	tests := []struct {
+		name     string
+		addrs    []net.Addr
+		wantIPv4 string
+		wantIPv6 string
+	}{
+		{"dual stack", []net.Addr{cidr("fe80::ba27:ebff:fe12:3456/64"), cidr("192.168.1.20/24"), cidr("2001:db8::20/64")}, "192.168.1.20", "2001:db8::20"},
+		{"link-local only", []net.Addr{cidr("fe80::ba27:ebff:fe12:3456/64"), cidr("10.0.0.5/8")}, "10.0.0.5", "fe80::ba27:ebff:fe12:3456"},
+		{"first of several", []net.Addr{cidr("192.168.1.20/24"), cidr("192.168.1.21/24")}, "192.168.1.20", ""},
+		{"loopback skipped", []net.Addr{cidr("127.0.0.1/8"), cidr("::1/128")}, "", ""},
+		{"no address yet", nil, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipv4, ipv6 := primaryAddresses(tt.addrs)
+			if ipv4 != tt.wantIPv4 || ipv6 != tt.wantIPv6 {
+				t.Errorf("primaryAddresses() = %q, %q, want %q, %q", ipv4, ipv6, tt.wantIPv4, tt.wantIPv6)
+			}
+		})
+	}
+}
+
+func TestCurrentWiFiAddresses(t *testing.T) {
+	// Any interface with an IPv4 address can stand in for the WiFi device
+	var device, wantIPv4 string
+	interfaces, _ := net.Interfaces()
+	for _, iface := range interfaces {
+		addrs, _ := iface.Addrs()
+		if ipv4, _ := primaryAddresses(addrs); ipv4 != "" {
+			device, wantIPv4 = iface.Name, ipv4
+			break
+		}
+	}
+	if device == "" {
+		t.Skip("no interface with an IPv4 address")
+	}
+
+	tests := []struct {
+		name     string
+		device   string
+		wantIPv4 string
+	}{
+		{"addressed device", device, wantIPv4},
+		{"device without an address", "nosuchdev0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommands(t, map[string]string{"nmcli": fmt.Sprintf(`case "$*" in
+*"connection show --active"*) echo 'Office:802-11-wireless:%s' ;;
+*"dev wifi list"*) echo 'yes:Office:82:WPA2' ;;
+esac`, tt.device)})
+
+			current, err := getCurrentWiFi()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current.SSID != "Office" || current.IPv4 != tt.wantIPv4 {
+				t.Errorf("getCurrentWiFi() = %+v, want Office with IPv4 %q", current, tt.wantIPv4)
+			}
+		})
+	}
+}
+
+func TestRunHealthChecks(t *testing.T) {
+	fixed := func(name, status string) healthCheck {
+		return healthCheck{name: name, run: func(context.Context) (string, string) { return status, name + " is " + status }}
+	}
+	hung := healthCheck{name: "temperature", run: func(ctx context.Context) (string, string) {
+		time.Sleep(time.Second)
+		return healthOK, "too late"
+	}}
+
+	tests := []struct {
+		name       string
+		checks     []healthCheck
+		wantStatus string
+	}{
+		{"all ok", []healthCheck{fixed("network", healthOK), fixed("disk", healthOK)}, healthOK},
+		{"one warning", []healthCheck{fixed("network", healthOK), fixed("disk", healthWarn), fixed("memory", healthOK)}, healthWarn},
+		{"one critical", []healthCheck{fixed("network", healthOK), fixed("disk", healthCritical), fixed("memory", healthOK)}, healthCritical},
+		{"critical outranks warnings", []healthCheck{fixed("dns", healthWarn), fixed("entropy", healthCritical), fixed("cpu", healthWarn)}, healthCritical},
+		{"timed-out check is critical", []healthCheck{fixed("network", healthOK), hung}, healthCritical},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			report := runHealthChecks(context.Background(), tt.checks, 50*time.Millisecond)
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("report took %v, want slow checks cut off at the timeout", elapsed)
+			}
+			if report.Status != tt.wantStatus {
+				t.Errorf("overall status = %s, want %s (%+v)", report.Status, tt.wantStatus, report.Checks)
+			}
+			// Every check is reported, in order
+			for i, check := range report.Checks {
+				if check.Name != tt.checks[i].name {
+					t.Errorf("check %d = %s, want %s", i, check.Name, tt.checks[i].name)
+				}
+			}
+		})
+	}
+}
+
+func TestDNSLookupHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		failure    string
+		err        error
+		wantStatus string
+		wantDetail string
+	}{
+		{"resolves", healthCritical, nil, healthOK, "Resolved gateway.local to 10.0.0.1, 10.0.0.2"},
+		{"configured name fails", healthCritical, errors.New("no such host"), healthCritical, "Failed to resolve gateway.local: no such host"},
+		{"default name fails", healthWarn, errors.New("no such host"), healthWarn, "Failed to resolve gateway.local: no such host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := func(string) ([]string, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return []string{"10.0.0.1", "10.0.0.2"}, nil
+			}
+			status, detail := dnsLookupHealth("gateway.local", tt.failure, lookup)
+			if status != tt.wantStatus || detail != tt.wantDetail {
+				t.Errorf("dnsLookupHealth() = %s, %q, want %s, %q", status, detail, tt.wantStatus, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestStatsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+
+	app := newTestApp(t)
+	app.statsFile = path
+	app.startTime = time.Now().Add(-90 * time.Second)
+	app.stats = Stats{Starts: 3, RebootsRequested: 1, UptimeSeconds: 1000}
+	app.countConnect(true)
+	app.countConnect(true)
+	app.countConnect(false)
+	app.saveStats()
+
+	got := loadStats(path)
+	want := Stats{Starts: 3, WiFiConnects: 2, WiFiConnectFailures: 1, RebootsRequested: 1}
+	uptime := got.UptimeSeconds
+	got.UptimeSeconds = 0
+	if got != want {
+		t.Errorf("loadStats() = %+v, want %+v", got, want)
+	}
+	if uptime < 1090 || uptime > 1100 {
+		t.Errorf("uptime = %ds, want the saved total plus this run's 90s", uptime)
+	}
+}
+
+func TestLoadStatsStartsFresh(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.json")
+	writeTestFile(t, corrupt, `{"starts": 4, "wifi_conn`)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"persistence off", ""},
+		{"missing file", filepath.Join(dir, "missing.json")},
+		{"corrupt file", corrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captureLog(t)
+			if got := loadStats(tt.path); got != (Stats{}) {
+				t.Errorf("loadStats() = %+v, want zero counters", got)
+			}
+		})
+	}
+
+	t.Run("nothing written without a file", func(t *testing.T) {
+		app := newTestApp(t)
+		app.saveStats()
+		if entries, _ := os.ReadDir(app.stateDir); len(entries) != 0 {
+			t.Errorf("state dir has %d entries, want none", len(entries))
+		}
+	})
+}
+
+func TestPortCheckHandler(t *testing.T) {
+	open := httptest.NewServer(http.NotFoundHandler())
+	defer open.Close()
+	openHost, openPort, _ := net.SplitHostPort(open.Listener.Addr().String())
+
+	// A listener that has been closed leaves a port nothing answers on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantOpen   bool
+		wantError  bool
+	}{
+		{"open port", fmt.Sprintf(`{"host":%q,"port":%s,"timeout_ms":1000}`, openHost, openPort), http.StatusOK, true, false},
+		{"closed port", fmt.Sprintf(`{"host":"127.0.0.1","port":%d,"timeout_ms":1000}`, closedPort), http.StatusOK, false, true},
+		{"port out of range", `{"host":"127.0.0.1","port":70000}`, http.StatusBadRequest, false, false},
+		{"port zero", `{"host":"127.0.0.1","port":0}`, http.StatusBadRequest, false, false},
+		{"invalid host", `{"host":"-rf /","port":443}`, http.StatusBadRequest, false, false},
+		{"timeout too long", `{"host":"127.0.0.1","port":443,"timeout_ms":60000}`, http.StatusBadRequest, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newTestApp(t).portCheckHandler(rec, httptest.NewRequest(http.MethodPost, "/api/network/port-check", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var result PortCheckResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Open != tt.wantOpen || (result.Error != "") != tt.wantError {
+				t.Errorf("result = %+v, want open=%v with error=%v", result, tt.wantOpen, tt.wantError)
+			}
+		})
+	}
+}
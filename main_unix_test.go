@@ -0,0 +1,59 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestListenOnInheritedFD(t *testing.T) {
+	prebound, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prebound.Close()
+	file, err := prebound.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// listen closes the descriptor it takes over, so hand it one no *os.File owns
+	fd, err := syscall.Dup(int(file.Fd()))
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CM_LISTEN_FD", strconv.Itoa(fd))
+	t.Setenv("LISTEN_FDS", "")
+	listener, err := listen("127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if listener.Addr().String() != prebound.Addr().String() {
+		t.Fatalf("listening on %s, want the inherited %s", listener.Addr(), prebound.Addr())
+	}
+	if value, ok := os.LookupEnv("CM_LISTEN_FD"); ok {
+		t.Errorf("CM_LISTEN_FD = %q still set, want it cleared for child processes", value)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "inherited") })}
+	go server.Serve(listener)
+	defer server.Close()
+
+	resp, err := http.Get("http://" + prebound.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "inherited" {
+		t.Errorf("body = %q, want the server on the inherited listener", body)
+	}
+}
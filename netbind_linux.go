@@ -0,0 +1,26 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// deviceDialer returns a dialer whose sockets are bound to device with SO_BINDTODEVICE, so
+// traffic leaves through that interface even when the default route points elsewhere
+func deviceDialer(device string, timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			var bindErr error
+			if err := c.Control(func(fd uintptr) {
+				bindErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, device)
+			}); err != nil {
+				return err
+			}
+			return bindErr
+		},
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import (
+	"net"
+	"time"
+)
+
+// deviceDialer binds to device's first IPv4 address where SO_BINDTODEVICE isn't available.
+// Routing may still pick another interface, but the source address is the device's.
+func deviceDialer(device string, timeout time.Duration) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if iface, err := net.InterfaceByName(device); err == nil {
+		if addrs, err := interfaceIPv4Addrs(*iface); err == nil && len(addrs) > 0 {
+			dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(addrs[0])}
+		}
+	}
+	return dialer
+}
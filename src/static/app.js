@@ -1,3 +1,6 @@
+// BASE_PATH is injected by the page templates when the app is served under CM_BASE_PATH
+const BASE_PATH = window.CM_BASE_PATH || '';
+
 class NetworkManager {
     constructor() {
         this.currentSSID = null;
@@ -16,7 +19,7 @@ class NetworkManager {
 
     async loadVersion() {
         try {
-            const response = await fetch('/api/version');
+            const response = await fetch(BASE_PATH + '/api/version');
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
@@ -32,7 +35,7 @@ class NetworkManager {
 
     async checkNmcliStatus() {
         try {
-            const response = await fetch('/api/nmcli/status');
+            const response = await fetch(BASE_PATH + '/api/nmcli/status');
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
@@ -53,7 +56,7 @@ class NetworkManager {
 
     async checkSystemHealth() {
         try {
-            const response = await fetch('/api/health');
+            const response = await fetch(BASE_PATH + '/api/health');
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
@@ -355,7 +358,7 @@ class NetworkManager {
         listEl.innerHTML = '';
 
         try {
-            const response = await fetch('/api/interfaces');
+            const response = await fetch(BASE_PATH + '/api/interfaces');
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
@@ -492,7 +495,7 @@ class NetworkManager {
 
     async loadCurrentWiFi() {
         try {
-            const response = await fetch('/api/wifi/current');
+            const response = await fetch(BASE_PATH + '/api/wifi/current');
             if (!response.ok) {
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
@@ -532,8 +535,8 @@ class NetworkManager {
         try {
             // Load both current WiFi and scan for networks
             const [currentResponse, scanResponse] = await Promise.all([
-                fetch('/api/wifi/current'),
-                fetch('/api/wifi/scan')
+                fetch(BASE_PATH + '/api/wifi/current'),
+                fetch(BASE_PATH + '/api/wifi/scan')
             ]);
 
             if (!currentResponse.ok) {
@@ -748,7 +751,7 @@ class NetworkManager {
         submitBtn.textContent = 'Connecting...';
 
         try {
-            const response = await fetch('/api/wifi/connect', {
+            const response = await fetch(BASE_PATH + '/api/wifi/connect', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
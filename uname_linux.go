@@ -0,0 +1,37 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// unameKernelInfo reads the uname(2) fields straight from the kernel
+func unameKernelInfo() (KernelInfo, bool) {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return KernelInfo{}, false
+	}
+	return kernelInfoFromUtsname(&uts), true
+}
+
+func kernelInfoFromUtsname(uts *syscall.Utsname) KernelInfo {
+	return KernelInfo{
+		System:   utsnameToString(uts.Sysname),
+		Release:  utsnameToString(uts.Release),
+		Version:  utsnameToString(uts.Version),
+		Machine:  utsnameToString(uts.Machine),
+		Hostname: utsnameToString(uts.Nodename),
+	}
+}
+
+// utsnameToString converts a NUL-terminated utsname field. The element type is int8 on most
+// architectures but uint8 on arm, ppc64 and riscv64, hence the type parameter.
+func utsnameToString[T int8 | uint8](field [65]T) string {
+	buf := make([]byte, 0, len(field))
+	for _, c := range field {
+		if c == 0 {
+			break
+		}
+		buf = append(buf, byte(c))
+	}
+	return string(buf)
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func fillUtsname[T int8 | uint8](field *[65]T, value string) {
+	for i := 0; i < len(value); i++ {
+		field[i] = T(value[i])
+	}
+}
+
+func TestKernelInfoFromUtsname(t *testing.T) {
+	var uts syscall.Utsname
+	fillUtsname(&uts.Sysname, "Linux")
+	fillUtsname(&uts.Nodename, "controlmate")
+	fillUtsname(&uts.Release, "6.1.0-rpi7-rpi-v8")
+	fillUtsname(&uts.Version, "#1 SMP PREEMPT Debian 1:6.1.63-1+rpt1")
+	fillUtsname(&uts.Machine, "aarch64")
+
+	want := KernelInfo{
+		System:   "Linux",
+		Release:  "6.1.0-rpi7-rpi-v8",
+		Version:  "#1 SMP PREEMPT Debian 1:6.1.63-1+rpt1",
+		Machine:  "aarch64",
+		Hostname: "controlmate",
+	}
+	if got := kernelInfoFromUtsname(&uts); got != want {
+		t.Errorf("kernelInfoFromUtsname() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUtsnameToString(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"short", "x86_64", "x86_64"},
+		{"full width", "abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklm", "abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var field [65]int8
+			fillUtsname(&field, tt.value)
+			if got := utsnameToString(field); got != tt.want {
+				t.Errorf("utsnameToString(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
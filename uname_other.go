@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// unameKernelInfo has no syscall to use here; getKernelInfo falls back to uname(1)
+func unameKernelInfo() (KernelInfo, bool) {
+	return KernelInfo{}, false
+}